@@ -18,7 +18,7 @@ type Config struct {
 	LogLevel log.LogLevel `mapstructure:"LOG_LEVEL"`
 
 	// Rate limiter configuration
-	RateLimiterConfig rlconfig.RateLimiterConfig
+	RateLimiterConfig *rlconfig.RateLimiterConfig
 }
 
 var config = &Config{}
@@ -53,12 +53,12 @@ func loadConfig() {
 
 	log.SetLogger(NewLogger(config.LogLevel))
 
-	err = rlconfig.LoadConfig()
+	rateLimiterConfig, err := rlconfig.LoadConfig()
 	if err != nil {
 		panic("Error loading config")
 	}
 
-	config.RateLimiterConfig = *rlconfig.GetConfig()
+	config.RateLimiterConfig = rateLimiterConfig
 
 	log.Log(log.Info, "Config loaded successfully")
 }
@@ -1,18 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	rlconfig "github.com/eliasfeijo/go-rate-limiter/config"
 	"github.com/eliasfeijo/go-rate-limiter/log"
 	"github.com/eliasfeijo/go-rate-limiter/middleware"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/spf13/viper"
 )
 
 func main() {
 	loadConfig()
 
-	rateLimiterMiddleware := middleware.NewRateLimitMiddleware(&config.RateLimiterConfig)
+	rateLimiterMiddleware := middleware.NewRateLimitMiddleware(config.RateLimiterConfig)
+	defer rateLimiterMiddleware.Close()
+
+	// Reload the rate limiter when the .env or rules file changes, or on SIGHUP
+	stopWatching, err := rlconfig.Watch(viper.GetViper(), config.RateLimiterConfig, rateLimiterMiddleware.Reload, syscall.SIGHUP)
+	if err != nil {
+		log.Log(log.Error, "Error watching the config:", err)
+	} else {
+		defer stopWatching()
+	}
 
 	r := chi.NewRouter()
 	r.Use(chimiddleware.Logger)
@@ -21,6 +38,20 @@ func main() {
 		w.Write([]byte("Request accepted"))
 	})
 
-	log.Log(log.Info, "Starting server on port "+config.Port)
-	http.ListenAndServe(":"+config.Port, r)
+	// Shut the server down on SIGINT or SIGTERM, so the rate limiter is closed (saving its snapshot)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: ":" + config.Port, Handler: r}
+	go func() {
+		log.Log(log.Info, "Starting server on port "+config.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Log(log.Error, "Error serving:", err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+	log.Log(log.Info, "Shutting the server down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
 }
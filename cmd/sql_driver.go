@@ -0,0 +1,4 @@
+package main
+
+// The driver of the sql store strategy's default configuration, which requires cgo
+import _ "github.com/mattn/go-sqlite3"
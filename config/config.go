@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
@@ -19,20 +20,123 @@ type TokenConfig struct {
 	LimitInSeconds uint
 	// Token block duration in seconds (the amount of time the token is blocked for after exceeding the max requests)
 	BlockInSeconds uint
+	// Algorithm used to limit the token (defaults to the RateLimiterConfig Algorithm when empty)
+	Algorithm string
 }
 
 // A map of tokens configurations
 type MapTokenConfig map[string]*TokenConfig
 
+// RouteRule limits the requests matching an HTTP method and a path pattern with its own limits
+type RouteRule struct {
+	// Name of the rule, which also keeps its counters apart from the other rules' ones
+	Name string
+	// HTTP methods the rule applies to (any method when empty)
+	Methods []string
+	// Path pattern the rule applies to, a chi route pattern such as /users/{id} or /api/*
+	Pattern string
+	// Headers the requests must have with these exact values for the rule to apply
+	Headers map[string]string
+	// Max requests per IP address (or key)
+	MaxRequests uint
+	// Limit duration in seconds (the amount of time the max requests are allowed in)
+	LimitInSeconds uint
+	// Block duration in seconds (the amount of time the IP address is blocked for after exceeding the max requests)
+	BlockInSeconds uint
+	// Algorithm used to limit the requests (defaults to the RateLimiterConfig Algorithm when empty)
+	Algorithm string
+	// Whether the requests matching the rule aren't limited at all
+	Unlimited bool
+}
+
+// A list of route rules, the first one matching a request being applied to it
+type RouteRules []*RouteRule
+
 type RedisConfig struct {
+	// Redis deployment mode (standalone, sentinel or cluster)
+	Mode string `mapstructure:"RATE_LIMITER_REDIS_MODE"`
 	// Redis host
 	Host string `mapstructure:"RATE_LIMITER_REDIS_HOST"`
 	// Redis port
 	Port string `mapstructure:"RATE_LIMITER_REDIS_PORT"`
+	// Addresses of the sentinels, or of the cluster seed nodes, separated by a comma (defaults to the host and port)
+	Addresses []string `mapstructure:"RATE_LIMITER_REDIS_ADDRESSES"`
+	// Name of the master monitored by the sentinels
+	SentinelMaster string `mapstructure:"RATE_LIMITER_REDIS_SENTINEL_MASTER"`
+	// Password of the sentinels
+	SentinelPassword string `mapstructure:"RATE_LIMITER_REDIS_SENTINEL_PASSWORD"`
+	// Redis ACL username
+	Username string `mapstructure:"RATE_LIMITER_REDIS_USERNAME"`
 	// Redis password
 	Password string `mapstructure:"RATE_LIMITER_REDIS_PASSWORD"`
-	// Redis database
+	// Redis database (not supported by Redis Cluster)
 	DB int `mapstructure:"RATE_LIMITER_REDIS_DB"`
+	// Whether to connect to Redis over TLS
+	TLS bool `mapstructure:"RATE_LIMITER_REDIS_TLS"`
+	// Path of the PEM encoded CA certificates verifying the Redis servers (defaults to the system's ones)
+	TLSCAFile string `mapstructure:"RATE_LIMITER_REDIS_TLS_CA_FILE"`
+	// Paths of the PEM encoded client certificate and key, for mutual TLS
+	TLSCertFile string `mapstructure:"RATE_LIMITER_REDIS_TLS_CERT_FILE"`
+	TLSKeyFile  string `mapstructure:"RATE_LIMITER_REDIS_TLS_KEY_FILE"`
+	// Whether to skip the verification of the Redis servers' certificates (only meant for testing)
+	TLSInsecureSkipVerify bool `mapstructure:"RATE_LIMITER_REDIS_TLS_INSECURE_SKIP_VERIFY"`
+	// How requests are handled while Redis is unavailable (fail_open, fail_closed or fallback)
+	FailurePolicy string `mapstructure:"RATE_LIMITER_REDIS_FAILURE_POLICY"`
+	// Consecutive Redis failures after which it's considered unavailable
+	FailureThreshold uint `mapstructure:"RATE_LIMITER_REDIS_FAILURE_THRESHOLD"`
+	// Time in seconds before Redis is tried again once unavailable, doubled after every failed try
+	RetryBackoffInSeconds uint `mapstructure:"RATE_LIMITER_REDIS_RETRY_BACKOFF_IN_SECONDS"`
+	// Max time in seconds before Redis is tried again
+	RetryMaxBackoffInSeconds uint `mapstructure:"RATE_LIMITER_REDIS_RETRY_MAX_BACKOFF_IN_SECONDS"`
+}
+
+// GossipConfig configures the node of the gossip store strategy, which shares its counters with
+// its peers without Redis
+type GossipConfig struct {
+	// Unique ID of the node among its peers (defaults to a random one)
+	NodeID string `mapstructure:"RATE_LIMITER_GOSSIP_NODE_ID"`
+	// Address (or gossip endpoint URL) the node is reached on by its peers, as it's listed in their
+	// peers (defaults to the address it listens on)
+	Address string `mapstructure:"RATE_LIMITER_GOSSIP_ADDRESS"`
+	// Address the node listens on for the gossip of its peers (e.g.: :7946), unless its handler is mounted on another server
+	BindAddress string `mapstructure:"RATE_LIMITER_GOSSIP_BIND_ADDRESS"`
+	// Addresses (or gossip endpoint URLs) of the other nodes, separated by a comma
+	Peers []string `mapstructure:"RATE_LIMITER_GOSSIP_PEERS"`
+	// Interval in milliseconds between two rounds of gossip
+	IntervalInMilliseconds uint `mapstructure:"RATE_LIMITER_GOSSIP_INTERVAL_IN_MILLISECONDS"`
+	// Secret shared by the nodes, authenticating the gossip they send to each other (required to
+	// receive gossip)
+	Secret string `mapstructure:"RATE_LIMITER_GOSSIP_SECRET"`
+}
+
+// RemoteConfig configures the node of the remote store strategy, which owns a share of the keys in
+// a consistent hash ring of the instances and forwards the decisions of the other keys to their owner
+type RemoteConfig struct {
+	// Address the node is reached on by its peers (e.g.: 10.0.0.1:7947), which identifies it in the
+	// ring (defaults to the address it listens on)
+	Address string `mapstructure:"RATE_LIMITER_REMOTE_ADDRESS"`
+	// Address the node listens on for the decisions forwarded by its peers (defaults to Address)
+	BindAddress string `mapstructure:"RATE_LIMITER_REMOTE_BIND_ADDRESS"`
+	// Addresses of the other nodes of the ring, as they're configured on them, separated by a comma
+	Peers []string `mapstructure:"RATE_LIMITER_REMOTE_PEERS"`
+	// Max time in milliseconds to wait for the owner of a key to take its decision
+	TimeoutInMilliseconds uint `mapstructure:"RATE_LIMITER_REMOTE_TIMEOUT_IN_MILLISECONDS"`
+	// Secret shared by the nodes of the ring, authenticating the decisions they forward to each other
+	Secret string `mapstructure:"RATE_LIMITER_REMOTE_SECRET"`
+}
+
+// SQLConfig configures the database of the sql store strategy
+type SQLConfig struct {
+	// Name of the database/sql driver, which must be imported by the program (e.g.: sqlite3)
+	Driver string `mapstructure:"RATE_LIMITER_SQL_DRIVER"`
+	// Data source name of the database, in the format of the driver
+	DSN string `mapstructure:"RATE_LIMITER_SQL_DSN"`
+	// SQL dialect of the database (sqlite, postgres or mysql), inferred from the driver by default
+	Dialect string `mapstructure:"RATE_LIMITER_SQL_DIALECT"`
+	// Table holding the counters, created (and upgraded) on startup
+	Table string `mapstructure:"RATE_LIMITER_SQL_TABLE"`
+	// Interval in seconds between two deletions of the expired counters (0 disables them)
+	CleanupIntervalInSeconds uint `mapstructure:"RATE_LIMITER_SQL_CLEANUP_INTERVAL_IN_SECONDS"`
 }
 
 type RateLimiterConfig struct {
@@ -48,58 +152,166 @@ type RateLimiterConfig struct {
 	MapTokenConfigTuple string `mapstructure:"RATE_LIMITER_TOKENS_CONFIG_TUPLE"`
 	// The strategy to use for the store
 	StoreStrategy string `mapstructure:"RATE_LIMITER_STORE_STRATEGY"`
+	// Max hits leased from Redis at once by the hybrid store strategy
+	HybridBatchSize uint `mapstructure:"RATE_LIMITER_HYBRID_BATCH_SIZE"`
+	// Max percentage of the hits left in the window leased from Redis at once by the hybrid store strategy
+	HybridMaxSharePercent uint `mapstructure:"RATE_LIMITER_HYBRID_MAX_SHARE_PERCENT"`
+	// The algorithm used to limit IP addresses, and tokens that don't configure their own
+	Algorithm string `mapstructure:"RATE_LIMITER_ALGORITHM"`
+	// Max time in seconds a request may be held back by the leaky bucket algorithm (0 means it's only bounded by the max requests)
+	LeakyBucketMaxWaitInSeconds uint `mapstructure:"RATE_LIMITER_LEAKY_BUCKET_MAX_WAIT_IN_SECONDS"`
+	// Whether to send the legacy X-RateLimit-* response headers instead of the IETF RateLimit-* ones
+	LegacyHeaders bool `mapstructure:"RATE_LIMITER_LEGACY_HEADERS"`
+	// The CIDRs (or IP addresses) of the proxies trusted to report the client IP address, separated by a comma
+	TrustedProxies []string `mapstructure:"RATE_LIMITER_TRUSTED_PROXIES"`
+	// The headers the client IP address is read from when the request comes from a trusted proxy, in order of precedence and separated by a comma
+	ClientIPHeaders []string `mapstructure:"RATE_LIMITER_CLIENT_IP_HEADERS"`
+	// Max amount of keys (IP addresses, tokens and route keys) whose counters are kept in memory, the least recently used ones being evicted first (0 means unlimited)
+	MaxKeys uint `mapstructure:"RATE_LIMITER_MAX_KEYS"`
+	// File the in-memory counters are snapshotted to, and restored from on startup (empty disables the snapshots)
+	SnapshotFile string `mapstructure:"RATE_LIMITER_SNAPSHOT_FILE"`
+	// Interval in seconds between two snapshots of the in-memory counters (0 only snapshots them when the rate limiter is closed)
+	SnapshotIntervalInSeconds uint `mapstructure:"RATE_LIMITER_SNAPSHOT_INTERVAL_IN_SECONDS"`
 
 	// A map of tokens and their respective max requests, limit and block durations in seconds
 	MapTokenConfig `mapstructure:"RATE_LIMITER_TOKENS_CONFIG_TUPLE"`
 
+	// The rules limiting the requests of specific routes, separated by a semicolon
+	RouteRules RouteRules `mapstructure:"RATE_LIMITER_ROUTE_RULES"`
+
+	// Path of a YAML or JSON rules file, loaded on top of the other settings
+	RulesFile string `mapstructure:"RATE_LIMITER_RULES_FILE"`
+
 	// Redis configuration
 	RedisConfig `mapstructure:",squash"`
+
+	// Gossip configuration
+	GossipConfig `mapstructure:",squash"`
+
+	// Remote configuration
+	RemoteConfig `mapstructure:",squash"`
+
+	// SQL configuration
+	SQLConfig `mapstructure:",squash"`
 }
 
-var config = &RateLimiterConfig{}
+// LoadConfig loads the config from the environment variables and the config file of viper's global
+// instance, see Load
+func LoadConfig() (*RateLimiterConfig, error) {
+	return Load(viper.GetViper())
+}
 
-func LoadConfig() (err error) {
-	viper.AutomaticEnv()
+// Load loads the config from the environment variables and the config file (if any) of a viper
+// instance, and from the rules file (if any). The defaults are set on the instance.
+func Load(v *viper.Viper) (*RateLimiterConfig, error) {
+	v.AutomaticEnv()
 
 	// Set defaults
-	viper.SetDefault("RATE_LIMITER_IP_ADDRESS_MAX_REQUESTS", 2)
-	viper.SetDefault("RATE_LIMITER_IP_ADDRESS_LIMIT_IN_SECONDS", 1)
-	viper.SetDefault("RATE_LIMITER_IP_ADDRESS_BLOCK_IN_SECONDS", 5)
-	viper.SetDefault("RATE_LIMITER_TOKENS_HEADER_KEY", "API_KEY")
-	viper.SetDefault("RATE_LIMITER_TOKENS_CONFIG_TUPLE", "")
-	viper.SetDefault("RATE_LIMITER_STORE_STRATEGY", "in_memory")
-	viper.SetDefault("RATE_LIMITER_REDIS_HOST", "localhost")
-	viper.SetDefault("RATE_LIMITER_REDIS_PORT", "6379")
-	viper.SetDefault("RATE_LIMITER_REDIS_PASSWORD", "")
-	viper.SetDefault("RATE_LIMITER_REDIS_DB", 0)
-
-	err = viper.ReadInConfig()
+	v.SetDefault("RATE_LIMITER_IP_ADDRESS_MAX_REQUESTS", 2)
+	v.SetDefault("RATE_LIMITER_IP_ADDRESS_LIMIT_IN_SECONDS", 1)
+	v.SetDefault("RATE_LIMITER_IP_ADDRESS_BLOCK_IN_SECONDS", 5)
+	v.SetDefault("RATE_LIMITER_TOKENS_HEADER_KEY", "API_KEY")
+	v.SetDefault("RATE_LIMITER_TOKENS_CONFIG_TUPLE", "")
+	v.SetDefault("RATE_LIMITER_ROUTE_RULES", "")
+	v.SetDefault("RATE_LIMITER_RULES_FILE", "")
+	v.SetDefault("RATE_LIMITER_STORE_STRATEGY", "in_memory")
+	v.SetDefault("RATE_LIMITER_HYBRID_BATCH_SIZE", 10)
+	v.SetDefault("RATE_LIMITER_HYBRID_MAX_SHARE_PERCENT", 10)
+	v.SetDefault("RATE_LIMITER_ALGORITHM", "fixed_window")
+	v.SetDefault("RATE_LIMITER_LEAKY_BUCKET_MAX_WAIT_IN_SECONDS", 0)
+	v.SetDefault("RATE_LIMITER_LEGACY_HEADERS", false)
+	v.SetDefault("RATE_LIMITER_TRUSTED_PROXIES", "")
+	v.SetDefault("RATE_LIMITER_CLIENT_IP_HEADERS", "X-Forwarded-For")
+	v.SetDefault("RATE_LIMITER_MAX_KEYS", 1000000)
+	v.SetDefault("RATE_LIMITER_SNAPSHOT_FILE", "")
+	v.SetDefault("RATE_LIMITER_SNAPSHOT_INTERVAL_IN_SECONDS", 60)
+	v.SetDefault("RATE_LIMITER_REDIS_MODE", "standalone")
+	v.SetDefault("RATE_LIMITER_REDIS_HOST", "localhost")
+	v.SetDefault("RATE_LIMITER_REDIS_PORT", "6379")
+	v.SetDefault("RATE_LIMITER_REDIS_ADDRESSES", "")
+	v.SetDefault("RATE_LIMITER_REDIS_SENTINEL_MASTER", "")
+	v.SetDefault("RATE_LIMITER_REDIS_SENTINEL_PASSWORD", "")
+	v.SetDefault("RATE_LIMITER_REDIS_USERNAME", "")
+	v.SetDefault("RATE_LIMITER_REDIS_PASSWORD", "")
+	v.SetDefault("RATE_LIMITER_REDIS_DB", 0)
+	v.SetDefault("RATE_LIMITER_REDIS_TLS", false)
+	v.SetDefault("RATE_LIMITER_REDIS_TLS_CA_FILE", "")
+	v.SetDefault("RATE_LIMITER_REDIS_TLS_CERT_FILE", "")
+	v.SetDefault("RATE_LIMITER_REDIS_TLS_KEY_FILE", "")
+	v.SetDefault("RATE_LIMITER_REDIS_TLS_INSECURE_SKIP_VERIFY", false)
+	v.SetDefault("RATE_LIMITER_REDIS_FAILURE_POLICY", "fail_open")
+	v.SetDefault("RATE_LIMITER_REDIS_FAILURE_THRESHOLD", 5)
+	v.SetDefault("RATE_LIMITER_REDIS_RETRY_BACKOFF_IN_SECONDS", 1)
+	v.SetDefault("RATE_LIMITER_REDIS_RETRY_MAX_BACKOFF_IN_SECONDS", 30)
+	v.SetDefault("RATE_LIMITER_GOSSIP_NODE_ID", "")
+	v.SetDefault("RATE_LIMITER_GOSSIP_ADDRESS", "")
+	v.SetDefault("RATE_LIMITER_GOSSIP_BIND_ADDRESS", "")
+	v.SetDefault("RATE_LIMITER_GOSSIP_PEERS", "")
+	v.SetDefault("RATE_LIMITER_GOSSIP_INTERVAL_IN_MILLISECONDS", 100)
+	v.SetDefault("RATE_LIMITER_GOSSIP_SECRET", "")
+	v.SetDefault("RATE_LIMITER_REMOTE_ADDRESS", "")
+	v.SetDefault("RATE_LIMITER_REMOTE_BIND_ADDRESS", "")
+	v.SetDefault("RATE_LIMITER_REMOTE_PEERS", "")
+	v.SetDefault("RATE_LIMITER_REMOTE_TIMEOUT_IN_MILLISECONDS", 500)
+	v.SetDefault("RATE_LIMITER_REMOTE_SECRET", "")
+	v.SetDefault("RATE_LIMITER_SQL_DRIVER", "sqlite3")
+	v.SetDefault("RATE_LIMITER_SQL_DSN", "rate_limiter.db")
+	v.SetDefault("RATE_LIMITER_SQL_DIALECT", "")
+	v.SetDefault("RATE_LIMITER_SQL_TABLE", "rate_limiter_counters")
+	v.SetDefault("RATE_LIMITER_SQL_CLEANUP_INTERVAL_IN_SECONDS", 60)
+
+	cfg, err := readConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	logConfig(cfg)
+	return cfg, nil
+}
+
+// readConfig reads the config file (if any), the environment variables and the rules file (if any)
+// into a new config
+func readConfig(v *viper.Viper) (*RateLimiterConfig, error) {
+	err := v.ReadInConfig()
 	if err != nil {
-		if err2, ok := err.(*os.PathError); !ok {
-			err = err2
+		var notFound viper.ConfigFileNotFoundError
+		if _, ok := err.(*os.PathError); !ok && !errors.As(err, &notFound) {
 			log.Log(log.Error, "Error reading config file")
-			return
+			return nil, err
 		}
 	}
 
-	err = viper.Unmarshal(config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+	cfg := &RateLimiterConfig{}
+	err = v.Unmarshal(cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
 		tokensMapHookFunc(),
+		routeRulesHookFunc(),
 		mapstructure.StringToTimeDurationHookFunc(),
 		mapstructure.StringToSliceHookFunc(","),
 	)))
+	if err != nil {
+		log.Log(log.Error, "Error unmarshalling config:", err)
+		return nil, err
+	}
+	if cfg.RulesFile != "" {
+		if err = LoadRulesFile(cfg.RulesFile, cfg); err != nil {
+			log.Log(log.Error, "Error loading the rules file:\n"+err.Error())
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
 
-	log.Log(log.Debug, "IP Address Max Requests:", config.IpAddressMaxRequests)
-	log.Log(log.Debug, "IP Address Limit In Seconds:", config.IpAddressLimitInSeconds)
-	log.Log(log.Debug, "IP Address Block In Seconds:", config.IpAddressBlockInSeconds)
-	for token, tokenConfig := range config.MapTokenConfig {
+func logConfig(cfg *RateLimiterConfig) {
+	log.Log(log.Debug, "IP Address Max Requests:", cfg.IpAddressMaxRequests)
+	log.Log(log.Debug, "IP Address Limit In Seconds:", cfg.IpAddressLimitInSeconds)
+	log.Log(log.Debug, "IP Address Block In Seconds:", cfg.IpAddressBlockInSeconds)
+	log.Log(log.Debug, "Algorithm:", cfg.Algorithm)
+	for token, tokenConfig := range cfg.MapTokenConfig {
 		log.Log(log.Debug, "Token:", token)
 		log.Log(log.Debug, tokenConfig)
 	}
-	return
-}
-
-func GetConfig() *RateLimiterConfig {
-	return config
+	for _, routeRule := range cfg.RouteRules {
+		log.Log(log.Debug, "Route rule:", routeRule)
+	}
 }
 
 func tokensMapHookFunc() mapstructure.DecodeHookFuncType {
@@ -126,10 +338,14 @@ func tokensMapHookFunc() mapstructure.DecodeHookFuncType {
 
 		// Loop through the tokens config tuples
 		for _, tuple := range tuples {
+			// Skip the empty tuples (e.g.: no tokens are configured)
+			if strings.TrimSpace(tuple) == "" {
+				continue
+			}
 			// Split the tokens config tuple into token and config
 			parsed := strings.Split(tuple, ":")
-			// Check that the token config tuple is valid
-			if len(parsed) != 4 {
+			// Check that the token config tuple is valid (the algorithm is optional)
+			if len(parsed) != 4 && len(parsed) != 5 {
 				return nil, fmt.Errorf("Invalid token config tuple: %s", tuple)
 			}
 			token := parsed[0]
@@ -145,10 +361,15 @@ func tokensMapHookFunc() mapstructure.DecodeHookFuncType {
 			if err != nil {
 				return nil, fmt.Errorf("Invalid token config tuple: %s", tuple)
 			}
+			Algorithm := ""
+			if len(parsed) == 5 {
+				Algorithm = strings.TrimSpace(parsed[4])
+			}
 			MapTokenConfig[token] = &TokenConfig{
 				MaxRequests:    uint(MaxRequests),
 				LimitInSeconds: uint(LimitInSeconds),
 				BlockInSeconds: uint(BlockInSeconds),
+				Algorithm:      Algorithm,
 			}
 		}
 
@@ -156,11 +377,95 @@ func tokensMapHookFunc() mapstructure.DecodeHookFuncType {
 	}
 }
 
+// routeRulesHookFunc parses the route rules, separated by a semicolon. Every rule is made of its
+// name, methods (separated by a comma, or * for any method), path pattern, and then either its
+// max requests, limit and block durations in seconds and optionally its algorithm, or the word
+// unlimited, separated by spaces (e.g.: login POST /login 5 60 300; health GET /health unlimited).
+func routeRulesHookFunc() mapstructure.DecodeHookFuncType {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{},
+	) (interface{}, error) {
+		// Check that the data is string
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+
+		// Check that the target type is our custom type
+		if t != reflect.TypeOf(RouteRules{}) {
+			return data, nil
+		}
+
+		routeRules := RouteRules{}
+		for _, tuple := range strings.Split(data.(string), ";") {
+			parsed := strings.Fields(tuple)
+			if len(parsed) == 0 {
+				continue
+			}
+			if len(parsed) != 4 && len(parsed) != 6 && len(parsed) != 7 {
+				return nil, fmt.Errorf("Invalid route rule tuple: %s", tuple)
+			}
+			routeRule := &RouteRule{
+				Name:    parsed[0],
+				Pattern: parsed[2],
+			}
+			if parsed[1] != "*" {
+				for _, method := range strings.Split(parsed[1], ",") {
+					routeRule.Methods = append(routeRule.Methods, strings.ToUpper(method))
+				}
+			}
+			if len(parsed) == 4 {
+				if parsed[3] != "unlimited" {
+					return nil, fmt.Errorf("Invalid route rule tuple: %s", tuple)
+				}
+				routeRule.Unlimited = true
+				routeRules = append(routeRules, routeRule)
+				continue
+			}
+			var limits [3]uint64
+			for i := range limits {
+				limit, err := strconv.ParseUint(parsed[3+i], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid route rule tuple: %s", tuple)
+				}
+				limits[i] = limit
+			}
+			routeRule.MaxRequests = uint(limits[0])
+			routeRule.LimitInSeconds = uint(limits[1])
+			routeRule.BlockInSeconds = uint(limits[2])
+			if len(parsed) == 7 {
+				routeRule.Algorithm = parsed[6]
+			}
+			routeRules = append(routeRules, routeRule)
+		}
+
+		return routeRules, nil
+	}
+}
+
+func (r *RouteRule) String() string {
+	if r.Unlimited {
+		return fmt.Sprintf("Name: %s, Methods: %v, Pattern: %s, Unlimited", r.Name, r.Methods, r.Pattern)
+	}
+	return fmt.Sprintf(
+		"Name: %s, Methods: %v, Pattern: %s, Max Requests: %d, Limit In Seconds: %d, Block In Seconds: %d, Algorithm: %s",
+		r.Name,
+		r.Methods,
+		r.Pattern,
+		r.MaxRequests,
+		r.LimitInSeconds,
+		r.BlockInSeconds,
+		r.Algorithm,
+	)
+}
+
 func (t *TokenConfig) String() string {
 	return fmt.Sprintf(
-		"Max Requests: %d, Limit In Seconds: %d, Block In Seconds: %d",
+		"Max Requests: %d, Limit In Seconds: %d, Block In Seconds: %d, Algorithm: %s",
 		t.MaxRequests,
 		t.LimitInSeconds,
 		t.BlockInSeconds,
+		t.Algorithm,
 	)
 }
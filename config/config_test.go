@@ -0,0 +1,29 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteRulesHookFunc(t *testing.T) {
+	hook := routeRulesHookFunc()
+	data := "login POST,put /login 5 60 300 ; health * /health unlimited; users GET /users/{id:[0-9]+} 10 1 0 gcra;"
+	routeRules, err := hook(reflect.TypeOf(""), reflect.TypeOf(RouteRules{}), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RouteRules{
+		{Name: "login", Methods: []string{"POST", "PUT"}, Pattern: "/login", MaxRequests: 5, LimitInSeconds: 60, BlockInSeconds: 300},
+		{Name: "health", Pattern: "/health", Unlimited: true},
+		{Name: "users", Methods: []string{"GET"}, Pattern: "/users/{id:[0-9]+}", MaxRequests: 10, LimitInSeconds: 1, Algorithm: "gcra"},
+	}
+	if !reflect.DeepEqual(routeRules, expected) {
+		t.Errorf("Parsed %v, expected %v", routeRules, expected)
+	}
+
+	for _, invalid := range []string{"login POST /login 5 60", "health * /health limited", "login POST /login 5 sixty 300"} {
+		if _, err := hook(reflect.TypeOf(""), reflect.TypeOf(RouteRules{}), invalid); err == nil {
+			t.Errorf("Expected an error parsing %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// The JSON Schema of the rules files, which editors can also use to validate and complete them
+//
+//go:embed rules.schema.json
+var rulesSchemaJSON string
+
+var rulesSchema = jsonschema.MustCompileString("rules.schema.json", rulesSchemaJSON)
+
+// RulesError is an error found in a rules file, located at the offending value
+type RulesError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *RulesError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// RulesErrors are all the errors found in a rules file, ordered by their location
+type RulesErrors []*RulesError
+
+func (e RulesErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+type rulesFile struct {
+	Defaults *rulesLimit           `yaml:"defaults"`
+	Tiers    map[string]rulesLimit `yaml:"tiers"`
+	Tokens   map[string]yaml.Node  `yaml:"tokens"`
+	Rules    []rulesRule           `yaml:"rules"`
+}
+
+type rulesLimit struct {
+	Tier           string `yaml:"tier"`
+	Algorithm      string `yaml:"algorithm"`
+	MaxRequests    *uint  `yaml:"max_requests"`
+	LimitInSeconds *uint  `yaml:"limit_in_seconds"`
+	BlockInSeconds *uint  `yaml:"block_in_seconds"`
+}
+
+type rulesRule struct {
+	rulesLimit `yaml:",inline"`
+	Name       string `yaml:"name"`
+	Match      struct {
+		Methods []string          `yaml:"methods"`
+		Path    string            `yaml:"path"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"match"`
+	Unlimited bool `yaml:"unlimited"`
+}
+
+// LoadRulesFile loads a YAML or JSON rules file into the config, see ParseRules
+func LoadRulesFile(path string, config *RateLimiterConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ParseRules(path, data, config)
+}
+
+// ParseRules validates a YAML or JSON rules file against its JSON Schema and loads it into the
+// config: the defaults replace the IP address limit, the tokens are added to (or replace) the
+// configured ones, and the rules are matched before the configured route rules. The errors are
+// returned as RulesErrors, located at the line and column of the offending values.
+func ParseRules(file string, data []byte, config *RateLimiterConfig) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if len(root.Content) == 0 {
+		return RulesErrors{{File: file, Line: 1, Column: 1, Message: "the rules file is empty"}}
+	}
+	document := root.Content[0]
+
+	if errs := validateRules(file, document); len(errs) > 0 {
+		return errs
+	}
+
+	var rules rulesFile
+	if err := document.Decode(&rules); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return rules.apply(file, document, config)
+}
+
+// validateRules validates the document against the JSON Schema, converting the validation errors
+// into RulesErrors located by their JSON pointer in the document
+func validateRules(file string, document *yaml.Node) RulesErrors {
+	err := rulesSchema.Validate(jsonValue(document))
+	var validationError *jsonschema.ValidationError
+	if !errors.As(err, &validationError) {
+		return nil
+	}
+	var errs RulesErrors
+	for _, leaf := range leafErrors(validationError) {
+		pointer := leaf.InstanceLocation
+		// Point at the offending property rather than at its object
+		if names := quotedNames.FindAllStringSubmatch(leaf.Message, -1); strings.HasSuffix(leaf.KeywordLocation, "/additionalProperties") && names != nil {
+			for _, name := range names {
+				errs = append(errs, rulesError(file, document, pointer+"/"+escapePointer(name[1]), true, "property "+name[0]+" is not allowed"))
+			}
+			continue
+		}
+		errs = append(errs, rulesError(file, document, pointer, false, describe(pointer, leaf.Message)))
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line || errs[i].Line == errs[j].Line && errs[i].Column < errs[j].Column
+	})
+	return errs
+}
+
+var quotedNames = regexp.MustCompile(`'([^']*)'`)
+
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+	return leaves
+}
+
+func describe(pointer string, message string) string {
+	if pointer == "" {
+		return message
+	}
+	return strings.TrimPrefix(pointer, "/") + ": " + message
+}
+
+func (rules *rulesFile) apply(file string, document *yaml.Node, config *RateLimiterConfig) error {
+	var errs RulesErrors
+	resolve := func(limit rulesLimit, base TokenConfig, pointer string) TokenConfig {
+		if limit.Tier != "" {
+			tier, ok := rules.Tiers[limit.Tier]
+			if !ok {
+				errs = append(errs, rulesError(file, document, pointer+"/tier", false, fmt.Sprintf("tier %q is not defined", limit.Tier)))
+				return base
+			}
+			base = tier.override(base)
+		}
+		return limit.override(base)
+	}
+
+	for name, tier := range rules.Tiers {
+		if tier.Tier != "" {
+			errs = append(errs, rulesError(file, document, "/tiers/"+escapePointer(name)+"/tier", false, "a tier can't refer to another tier"))
+		}
+	}
+
+	defaults := TokenConfig{
+		MaxRequests:    config.IpAddressMaxRequests,
+		LimitInSeconds: config.IpAddressLimitInSeconds,
+		BlockInSeconds: config.IpAddressBlockInSeconds,
+		Algorithm:      config.Algorithm,
+	}
+	if rules.Defaults != nil {
+		defaults = resolve(*rules.Defaults, defaults, "/defaults")
+	}
+
+	tokens := MapTokenConfig{}
+	for token, node := range rules.Tokens {
+		pointer := "/tokens/" + escapePointer(token)
+		// A token is limited either by the name of a tier or by a limit
+		if node.Kind == yaml.ScalarNode {
+			tier, ok := rules.Tiers[node.Value]
+			if !ok {
+				errs = append(errs, rulesError(file, document, pointer, false, fmt.Sprintf("tier %q is not defined", node.Value)))
+				continue
+			}
+			tokenConfig := tier.override(defaults)
+			tokens[token] = &tokenConfig
+			continue
+		}
+		var limit rulesLimit
+		if err := node.Decode(&limit); err != nil {
+			errs = append(errs, rulesError(file, document, pointer, false, err.Error()))
+			continue
+		}
+		tokenConfig := resolve(limit, defaults, pointer)
+		tokens[token] = &tokenConfig
+	}
+
+	names := map[string]bool{}
+	routeRules := RouteRules{}
+	for i, rule := range rules.Rules {
+		pointer := "/rules/" + strconv.Itoa(i)
+		if names[rule.Name] {
+			errs = append(errs, rulesError(file, document, pointer+"/name", false, fmt.Sprintf("rule %q is already defined", rule.Name)))
+		}
+		names[rule.Name] = true
+		limit := resolve(rule.rulesLimit, defaults, pointer)
+		routeRules = append(routeRules, &RouteRule{
+			Name:           rule.Name,
+			Methods:        rule.Match.Methods,
+			Pattern:        rule.Match.Path,
+			Headers:        rule.Match.Headers,
+			MaxRequests:    limit.MaxRequests,
+			LimitInSeconds: limit.LimitInSeconds,
+			BlockInSeconds: limit.BlockInSeconds,
+			Algorithm:      limit.Algorithm,
+			Unlimited:      rule.Unlimited,
+		})
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+		return errs
+	}
+
+	config.IpAddressMaxRequests = defaults.MaxRequests
+	config.IpAddressLimitInSeconds = defaults.LimitInSeconds
+	config.IpAddressBlockInSeconds = defaults.BlockInSeconds
+	config.Algorithm = defaults.Algorithm
+	if config.MapTokenConfig == nil {
+		config.MapTokenConfig = MapTokenConfig{}
+	}
+	for token, tokenConfig := range tokens {
+		config.MapTokenConfig[token] = tokenConfig
+	}
+	config.RouteRules = append(routeRules, config.RouteRules...)
+	return nil
+}
+
+// override returns the base limit with the fields set by the limit replaced
+func (limit rulesLimit) override(base TokenConfig) TokenConfig {
+	if limit.Algorithm != "" {
+		base.Algorithm = limit.Algorithm
+	}
+	if limit.MaxRequests != nil {
+		base.MaxRequests = *limit.MaxRequests
+	}
+	if limit.LimitInSeconds != nil {
+		base.LimitInSeconds = *limit.LimitInSeconds
+	}
+	if limit.BlockInSeconds != nil {
+		base.BlockInSeconds = *limit.BlockInSeconds
+	}
+	return base
+}
+
+// rulesError locates the value at the JSON pointer in the document, or its key when key is true,
+// falling back to the closest existing ancestor
+func rulesError(file string, document *yaml.Node, pointer string, key bool, message string) *RulesError {
+	node := document
+	if pointer != "" {
+		tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+		for i, token := range tokens {
+			next, keyNode := child(node, unescapePointer(token))
+			if next == nil {
+				break
+			}
+			node = next
+			if key && keyNode != nil && i == len(tokens)-1 {
+				node = keyNode
+			}
+		}
+	}
+	return &RulesError{File: file, Line: node.Line, Column: node.Column, Message: message}
+}
+
+// child returns the value (and key, for mappings) of a mapping or sequence node
+func child(node *yaml.Node, token string) (*yaml.Node, *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return node.Content[i+1], node.Content[i]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i], nil
+		}
+	case yaml.AliasNode:
+		return child(node.Alias, token)
+	}
+	return nil, nil
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+// jsonValue converts a YAML node into the JSON value validated by the schema. Mapping keys are
+// always strings, and scalars that aren't JSON values (e.g.: timestamps) are kept as strings.
+func jsonValue(node *yaml.Node) interface{} {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			return jsonValue(node.Content[0])
+		}
+		return nil
+	case yaml.AliasNode:
+		return jsonValue(node.Alias)
+	case yaml.MappingNode:
+		object := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			object[node.Content[i].Value] = jsonValue(node.Content[i+1])
+		}
+		return object
+	case yaml.SequenceNode:
+		array := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			array[i] = jsonValue(item)
+		}
+		return array
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return node.Value
+	}
+	switch value := value.(type) {
+	case nil, bool, string:
+		return value
+	case int:
+		return json.Number(strconv.Itoa(value))
+	case uint64:
+		return json.Number(strconv.FormatUint(value, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	return node.Value
+}
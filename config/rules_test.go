@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseRules_Sample(t *testing.T) {
+	data, err := os.ReadFile("../rules.sample.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &RateLimiterConfig{
+		IpAddressMaxRequests: 2,
+		MapTokenConfig:       MapTokenConfig{"env": {MaxRequests: 1, LimitInSeconds: 1}},
+		RouteRules:           RouteRules{{Name: "env", Pattern: "/env", Unlimited: true}},
+	}
+	if err := ParseRules("rules.sample.yaml", data, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.IpAddressMaxRequests != 100 || config.IpAddressLimitInSeconds != 60 || config.Algorithm != "sliding_window_counter" {
+		t.Errorf("Defaults were not applied: %+v", config)
+	}
+	expectedTokens := MapTokenConfig{
+		"env":    {MaxRequests: 1, LimitInSeconds: 1},
+		"abc123": {MaxRequests: 10, LimitInSeconds: 60, BlockInSeconds: 60, Algorithm: "token_bucket"},
+		"def456": {MaxRequests: 1000, LimitInSeconds: 60, Algorithm: "sliding_window_counter"},
+		"ghi789": {MaxRequests: 5000, LimitInSeconds: 60, Algorithm: "sliding_window_counter"},
+	}
+	if !reflect.DeepEqual(config.MapTokenConfig, expectedTokens) {
+		t.Errorf("Parsed tokens %v, expected %v", config.MapTokenConfig, expectedTokens)
+	}
+	expectedRules := RouteRules{
+		{Name: "login", Methods: []string{"POST"}, Pattern: "/login", MaxRequests: 5, LimitInSeconds: 60, BlockInSeconds: 300, Algorithm: "gcra"},
+		{Name: "health", Pattern: "/health", MaxRequests: 100, LimitInSeconds: 60, Algorithm: "sliding_window_counter", Unlimited: true},
+		{Name: "mobile-api", Pattern: "/api/*", Headers: map[string]string{"X-Client": "mobile"}, MaxRequests: 1000, LimitInSeconds: 60, Algorithm: "sliding_window_counter"},
+		{Name: "env", Pattern: "/env", Unlimited: true},
+	}
+	if !reflect.DeepEqual(config.RouteRules, expectedRules) {
+		t.Errorf("Parsed rules %v, expected %v", config.RouteRules, expectedRules)
+	}
+}
+
+func TestParseRules_JSON(t *testing.T) {
+	data := []byte(`{"version": 1, "tokens": {"abc123": {"max_requests": 3, "limit_in_seconds": 1}}}`)
+	config := &RateLimiterConfig{}
+	if err := ParseRules("rules.json", data, config); err != nil {
+		t.Fatal(err)
+	}
+	if config.MapTokenConfig["abc123"].MaxRequests != 3 {
+		t.Errorf("Token was not parsed from JSON: %v", config.MapTokenConfig)
+	}
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	data := []byte(`version: 1
+defaults:
+  max_requests: -1
+tokens:
+  abc123: gold
+rules:
+  - name: login
+    match:
+      path: login
+    limit: 60
+  - name: login
+    match:
+      path: /other
+      methods: [FETCH]
+`)
+	config := &RateLimiterConfig{IpAddressMaxRequests: 2}
+	err := ParseRules("rules.yaml", data, config)
+	var errs RulesErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected RulesErrors, got %v", err)
+	}
+	expected := []struct {
+		line   int
+		column int
+	}{
+		{3, 17},  // max_requests must be >= 0
+		{9, 13},  // path must start with /
+		{10, 5},  // limit is not allowed
+		{14, 17}, // FETCH is not a method
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got:\n%v", len(expected), err)
+	}
+	for i, e := range expected {
+		if errs[i].Line != e.line || errs[i].Column != e.column {
+			t.Errorf("Expected error %d at %d:%d, got %v", i, e.line, e.column, errs[i])
+		}
+	}
+	if config.IpAddressMaxRequests != 2 {
+		t.Error("Config was changed by an invalid rules file")
+	}
+
+	// The semantic errors are only reported once the file matches the schema
+	data = []byte(`version: 1
+tokens:
+  abc123: gold
+rules:
+  - name: login
+    match: {path: /login}
+  - name: login
+    match: {path: /other}
+`)
+	err = ParseRules("rules.yaml", data, config)
+	if !errors.As(err, &errs) || len(errs) != 2 || errs[0].Line != 3 || errs[1].Line != 7 {
+		t.Errorf("Expected the undefined tier and duplicate rule errors at lines 3 and 7, got:\n%v", err)
+	}
+}
+
+func TestParseRules_Syntax(t *testing.T) {
+	if err := ParseRules("rules.yaml", []byte("version: [1"), &RateLimiterConfig{}); err == nil {
+		t.Error("Expected a syntax error")
+	}
+}
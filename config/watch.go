@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// watchDebounce is how long the files must stay unchanged before being reloaded, as editors
+// usually write them in several steps
+const watchDebounce = 100 * time.Millisecond
+
+// Watch reloads the config from the viper instance it was loaded from (see Load) whenever its
+// config file or the rules file of the current config (as of the last successful reload) changes,
+// or the process receives one of the signals (e.g.: syscall.SIGHUP), and passes it to reload
+// (e.g.: the middleware's Reload). A config that can't be loaded, or that reload returns an error
+// for, is logged and discarded. The viper instance must not be used by anything else while it's
+// watched. Call stop to stop watching.
+func Watch(v *viper.Viper, current *RateLimiterConfig, reload func(*RateLimiterConfig) error, signals ...os.Signal) (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	files, err := watchFiles(watcher, nil, v.ConfigFileUsed(), current.RulesFile)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	if len(signals) > 0 {
+		signal.Notify(signalChan, signals...)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		debounce := time.NewTimer(watchDebounce)
+		debounce.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if files[filepath.Clean(event.Name)] && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					debounce.Reset(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Log(log.Error, "Error watching the config files:", err)
+			case sig := <-signalChan:
+				log.Log(log.Info, "Reloading the config on", sig)
+				files = rewatchFiles(watcher, files, v, reloadConfig(v, reload))
+			case <-debounce.C:
+				log.Log(log.Info, "Reloading the changed config")
+				files = rewatchFiles(watcher, files, v, reloadConfig(v, reload))
+			case <-done:
+				debounce.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signalChan)
+		close(done)
+		<-stopped
+		watcher.Close()
+	}, nil
+}
+
+// watchFiles watches the directories of the files (rather than the files, so they're still watched
+// after being replaced), no longer watching the ones of the previously watched files, and returns
+// the absolute paths of the files
+func watchFiles(watcher *fsnotify.Watcher, previous map[string]bool, names ...string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		file, err := filepath.Abs(name)
+		if err != nil {
+			return nil, err
+		}
+		files[file] = true
+		dirs[filepath.Dir(file)] = true
+	}
+	previousDirs := make(map[string]bool)
+	for file := range previous {
+		previousDirs[filepath.Dir(file)] = true
+	}
+	for dir := range dirs {
+		if previousDirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return nil, err
+		}
+	}
+	for dir := range previousDirs {
+		if !dirs[dir] {
+			watcher.Remove(dir)
+		}
+	}
+	return files, nil
+}
+
+// rewatchFiles watches the files of the reloaded config, keeping the previous ones when it was
+// rejected or they can't be watched
+func rewatchFiles(watcher *fsnotify.Watcher, files map[string]bool, v *viper.Viper, cfg *RateLimiterConfig) map[string]bool {
+	if cfg == nil {
+		return files
+	}
+	reloaded, err := watchFiles(watcher, files, v.ConfigFileUsed(), cfg.RulesFile)
+	if err != nil {
+		log.Log(log.Error, "Error watching the reloaded config files, keeping the current ones:", err)
+		return files
+	}
+	return reloaded
+}
+
+// reloadConfig reads the config again and passes it to reload, returning it unless it was rejected
+func reloadConfig(v *viper.Viper, reload func(*RateLimiterConfig) error) *RateLimiterConfig {
+	cfg, err := readConfig(v)
+	if err == nil {
+		err = reload(cfg)
+	}
+	if err != nil {
+		log.Log(log.Error, "Rejected the reloaded config, keeping the current one:\n"+err.Error())
+		return nil
+	}
+	logConfig(cfg)
+	log.Log(log.Info, "Config reloaded successfully")
+	return cfg
+}
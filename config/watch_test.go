@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	writeFile(t, envFile, "RATE_LIMITER_IP_ADDRESS_MAX_REQUESTS=10\nRATE_LIMITER_RULES_FILE="+rulesFile+"\n")
+	writeFile(t, rulesFile, "version: 1\ntokens:\n  abc123: {max_requests: 1}\n")
+	v := viper.New()
+	v.SetConfigFile(envFile)
+	v.SetConfigType("env")
+	cfg, err := Load(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan *RateLimiterConfig, 10)
+	var current atomic.Pointer[RateLimiterConfig]
+	current.Store(cfg)
+	stop, err := Watch(v, cfg, func(cfg *RateLimiterConfig) error {
+		current.Store(cfg)
+		reloaded <- cfg
+		return nil
+	}, syscall.SIGHUP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	writeFile(t, envFile, "RATE_LIMITER_IP_ADDRESS_MAX_REQUESTS=20\nRATE_LIMITER_RULES_FILE="+rulesFile+"\n")
+	if cfg := waitReload(t, reloaded); cfg.IpAddressMaxRequests != 20 {
+		t.Errorf("Reloaded %d max requests, expected 20", cfg.IpAddressMaxRequests)
+	}
+
+	writeFile(t, rulesFile, "version: 1\ntokens:\n  abc123: {max_requests: 2}\n")
+	if cfg := waitReload(t, reloaded); cfg.MapTokenConfig["abc123"].MaxRequests != 2 {
+		t.Errorf("Reloaded the token config %v, expected 2 max requests", cfg.MapTokenConfig["abc123"])
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, reloaded)
+
+	// An invalid rules file is never passed to reload
+	writeFile(t, rulesFile, "version: 1\ntokens:\n  abc123: {max_requests: -1}\n")
+	select {
+	case cfg := <-reloaded:
+		t.Errorf("Reloaded an invalid config %v", cfg)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if current.Load().MapTokenConfig["abc123"].MaxRequests != 2 {
+		t.Error("The invalid config replaced the current one")
+	}
+}
+
+func TestWatch_RulesFileChanged(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	newRulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	writeFile(t, envFile, "RATE_LIMITER_RULES_FILE="+rulesFile+"\n")
+	writeFile(t, rulesFile, "version: 1\ntokens:\n  abc123: {max_requests: 1}\n")
+	writeFile(t, newRulesFile, "version: 1\ntokens:\n  abc123: {max_requests: 2}\n")
+	v := viper.New()
+	v.SetConfigFile(envFile)
+	v.SetConfigType("env")
+	cfg, err := Load(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan *RateLimiterConfig, 10)
+	stop, err := Watch(v, cfg, func(cfg *RateLimiterConfig) error {
+		reloaded <- cfg
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	writeFile(t, envFile, "RATE_LIMITER_RULES_FILE="+newRulesFile+"\n")
+	if cfg := waitReload(t, reloaded); cfg.MapTokenConfig["abc123"].MaxRequests != 2 {
+		t.Fatalf("Reloaded the token config %v, expected the one of the new rules file", cfg.MapTokenConfig["abc123"])
+	}
+
+	// The new rules file is watched, while the previous one isn't anymore
+	writeFile(t, rulesFile, "version: 1\ntokens:\n  abc123: {max_requests: 5}\n")
+	select {
+	case cfg := <-reloaded:
+		t.Errorf("Reloaded %v when the previous rules file changed", cfg)
+	case <-time.After(500 * time.Millisecond):
+	}
+	writeFile(t, newRulesFile, "version: 1\ntokens:\n  abc123: {max_requests: 3}\n")
+	if cfg := waitReload(t, reloaded); cfg.MapTokenConfig["abc123"].MaxRequests != 3 {
+		t.Errorf("Reloaded the token config %v, expected 3 max requests", cfg.MapTokenConfig["abc123"])
+	}
+}
+
+func writeFile(t *testing.T, name string, data string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitReload(t *testing.T, reloaded chan *RateLimiterConfig) *RateLimiterConfig {
+	t.Helper()
+	select {
+	case cfg := <-reloaded:
+		return cfg
+	case <-time.After(5 * time.Second):
+		t.Fatal("The config was not reloaded")
+		return nil
+	}
+}
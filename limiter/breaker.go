@@ -0,0 +1,161 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// The states of a circuit breaker
+const (
+	// BreakerClosed lets every request through, as the backend is available
+	BreakerClosed = "closed"
+	// BreakerOpen doesn't let requests through until the backend is tried again
+	BreakerOpen = "open"
+	// BreakerHalfOpen lets a single request through to try the backend again
+	BreakerHalfOpen = "half_open"
+)
+
+// circuitBreaker stops sending requests to a backend after threshold consecutive failures, and
+// tries it again with a single request after a backoff, which doubles after every failed try up to
+// maxBackoff. It's safe for concurrent use.
+type circuitBreaker struct {
+	mutex      sync.Mutex
+	threshold  uint
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	state      string
+	failures   uint
+	backoff    time.Duration
+	retryAt    time.Time
+	since      time.Time
+	lastError  error
+}
+
+func newCircuitBreaker(threshold uint, minBackoff time.Duration, maxBackoff time.Duration) *circuitBreaker {
+	if threshold == 0 {
+		threshold = 1
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	return &circuitBreaker{
+		threshold:  threshold,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		state:      BreakerClosed,
+		backoff:    minBackoff,
+		since:      time.Now(),
+	}
+}
+
+// allow reports whether a request can be sent to the backend, in which case its outcome must be
+// reported with success or failure
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if now.Before(b.retryAt) {
+			return false
+		}
+		b.setState(BreakerHalfOpen, now)
+		return true
+	case BreakerHalfOpen:
+		// The backend is being tried by another request
+		return false
+	}
+	return true
+}
+
+// success reports a request handled by the backend, and whether it closed the breaker
+func (b *circuitBreaker) success(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures = 0
+	if b.state == BreakerClosed {
+		return false
+	}
+	b.backoff = b.minBackoff
+	b.setState(BreakerClosed, now)
+	return true
+}
+
+// failure reports a request the backend failed to handle, and whether it opened the breaker
+func (b *circuitBreaker) failure(err error, now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.lastError = err
+	b.failures++
+	switch b.state {
+	case BreakerClosed:
+		if b.failures < b.threshold {
+			return false
+		}
+	case BreakerHalfOpen:
+		b.backoff *= 2
+		if b.backoff > b.maxBackoff {
+			b.backoff = b.maxBackoff
+		}
+	case BreakerOpen:
+		return false
+	}
+	b.retryAt = now.Add(b.backoff)
+	b.setState(BreakerOpen, now)
+	return true
+}
+
+// abort reports a request whose outcome says nothing about the backend (e.g.: it was canceled),
+// letting the next request try the backend when it was the one trying it
+func (b *circuitBreaker) abort(now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.setState(BreakerOpen, now)
+	}
+}
+
+// trip opens the breaker right away (e.g.: the backend can't be reached on startup)
+func (b *circuitBreaker) trip(err error, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.lastError = err
+	b.failures = b.threshold
+	b.retryAt = now.Add(b.backoff)
+	b.setState(BreakerOpen, now)
+}
+
+func (b *circuitBreaker) setState(state string, now time.Time) {
+	if b.state != state {
+		b.state = state
+		b.since = now
+	}
+}
+
+// retryAfter returns the time left at now until the backend is tried again
+func (b *circuitBreaker) retryAfter(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerClosed || !now.Before(b.retryAt) {
+		return 0
+	}
+	return b.retryAt.Sub(now)
+}
+
+// health returns the state of the breaker
+func (b *circuitBreaker) health() BackendHealth {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	health := BackendHealth{
+		State:    b.state,
+		Since:    b.since,
+		Failures: b.failures,
+	}
+	if b.lastError != nil {
+		health.LastError = b.lastError.Error()
+	}
+	if b.state != BreakerClosed {
+		retryAt := b.retryAt
+		health.RetryAt = &retryAt
+	}
+	return health
+}
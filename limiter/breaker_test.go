@@ -0,0 +1,51 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(2, time.Second, 3*time.Second)
+	now := time.Now()
+	err := errors.New("connection refused")
+
+	if b.failure(err, now) || !b.allow(now) {
+		t.Fatal("Breaker opened before reaching the failure threshold")
+	}
+	if !b.failure(err, now) || b.allow(now) {
+		t.Fatal("Breaker did not open after reaching the failure threshold")
+	}
+	if health := b.health(); health.State != BreakerOpen || health.Failures != 2 || health.LastError != err.Error() || !health.RetryAt.Equal(now.Add(time.Second)) {
+		t.Errorf("health() returned %+v", health)
+	}
+
+	// A single request tries the backend again once the backoff elapsed, which doubles when it fails
+	now = now.Add(time.Second)
+	if !b.allow(now) || b.allow(now) {
+		t.Fatal("Breaker did not let a single request through after the backoff")
+	}
+	if !b.failure(err, now) || b.retryAfter(now) != 2*time.Second {
+		t.Errorf("Breaker retries after %s, expected the backoff to double to 2s", b.retryAfter(now))
+	}
+	now = now.Add(2 * time.Second)
+	b.allow(now)
+	if b.failure(err, now); b.retryAfter(now) != 3*time.Second {
+		t.Errorf("Breaker retries after %s, expected the max backoff of 3s", b.retryAfter(now))
+	}
+
+	// An aborted try lets the next request try the backend again
+	now = now.Add(3 * time.Second)
+	b.allow(now)
+	b.abort(now)
+	if !b.allow(now) {
+		t.Fatal("Breaker did not let a request through after the try was aborted")
+	}
+	if !b.success(now) || !b.allow(now) || b.health().State != BreakerClosed {
+		t.Error("Breaker did not close after a successful try")
+	}
+	if b.failure(err, now) {
+		t.Error("Breaker opened after a single failure once closed again")
+	}
+}
@@ -0,0 +1,67 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/store"
+)
+
+const (
+	// IpAddressRule is the rule applied to the requests without a configured token
+	IpAddressRule = "ip_address"
+	// TokenRule is the rule applied to the requests with a token of MapTokenConfig
+	TokenRule = "token"
+)
+
+// Decision is the outcome of a request checked by the RateLimiter
+type Decision struct {
+	// Whether the request is allowed
+	Allowed bool
+	// The max requests of the matched rule
+	Limit uint
+	// The duration the max requests of the matched rule are allowed in
+	Window time.Duration
+	// The requests left before the limit is reached
+	Remaining uint
+	// When no requests are counted against the limit anymore
+	Reset time.Time
+	// How long to wait before retrying a denied request
+	RetryAfter time.Duration
+	// How long an allowed request must be held back before being handled (e.g.: leaky bucket)
+	Delay time.Duration
+	// The rule that matched the request: IpAddressRule, TokenRule or the name of a route rule
+	Rule string
+	// Whether the IP address or token is currently blocked
+	Blocked bool
+	// Whether the request matched an unlimited route rule, in which case it isn't counted
+	Unlimited bool
+	// Whether the decision was taken by the failure policy, as the store is unavailable
+	Degraded bool
+	// Whether no store answered (e.g.: with the fail_open or fail_closed policy), in which case
+	// Remaining and Reset don't reflect the state of the limit
+	StateUnknown bool
+}
+
+func newDecision(result store.Result, rule rule, now time.Time) Decision {
+	decision := Decision{
+		Allowed: !result.Limited,
+		Limit:   rule.config.MaxRequests,
+		Window:  rule.config.Window(),
+		Delay:   result.Delay,
+		Rule:    rule.name,
+		Blocked: result.Blocked,
+	}
+	if !result.Limited && result.HitCount < rule.config.MaxRequests {
+		decision.Remaining = rule.config.MaxRequests - result.HitCount
+	}
+	if result.Limited {
+		decision.RetryAfter = result.RetryAfter
+	}
+	// A blocked key can't be used before the block is lifted, even if its limit resets earlier
+	resetAfter := result.ResetAfter
+	if decision.RetryAfter > resetAfter {
+		resetAfter = decision.RetryAfter
+	}
+	decision.Reset = now.Add(resetAfter)
+	return decision
+}
@@ -0,0 +1,133 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/log"
+	"github.com/eliasfeijo/go-rate-limiter/store"
+)
+
+// The failure policies, applied while Redis is unavailable
+const (
+	// FailOpenPolicy allows every request
+	FailOpenPolicy = "fail_open"
+	// FailClosedPolicy denies every request, until Redis is tried again
+	FailClosedPolicy = "fail_closed"
+	// FallbackPolicy limits the requests with in-memory stores local to the instance
+	FallbackPolicy = "fallback"
+)
+
+// The circuit breaker settings used when they aren't configured
+const (
+	defaultFailureThreshold = 5
+	defaultRetryBackoff     = time.Second
+	defaultRetryMaxBackoff  = 30 * time.Second
+)
+
+// Health is the health status of a RateLimiter
+type Health struct {
+	// Whether the decisions are taken by the configured store strategy, rather than by the failure policy
+	Healthy bool `json:"healthy"`
+	// The failure policy applied while Redis is unavailable
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// The state of Redis, only set with the redis and hybrid store strategies
+	Redis *BackendHealth `json:"redis,omitempty"`
+}
+
+// BackendHealth is the state of the circuit breaker of a backend
+type BackendHealth struct {
+	// BreakerClosed when the backend is available, BreakerOpen when it isn't, and BreakerHalfOpen
+	// when it's being tried again
+	State string `json:"state"`
+	// When the breaker entered its state
+	Since time.Time `json:"since"`
+	// The amount of consecutive failures
+	Failures uint `json:"failures"`
+	// The last failure
+	LastError string `json:"lastError,omitempty"`
+	// When the backend is tried again, unless the breaker is closed
+	RetryAt *time.Time `json:"retryAt,omitempty"`
+}
+
+// Health returns the health status of the limiter
+func (rl *RateLimiter) Health() Health {
+	if rl.breaker == nil {
+		return Health{Healthy: true}
+	}
+	backend := rl.breaker.health()
+	return Health{
+		Healthy:       backend.State == BreakerClosed,
+		FailurePolicy: rl.failurePolicy,
+		Redis:         &backend,
+	}
+}
+
+// setupRedis creates the Redis client (unless one was given) and its circuit breaker, opening it
+// right away when Redis can't be reached
+func (rl *RateLimiter) setupRedis(cfg config.RedisConfig) {
+	if rl.redis == nil {
+		client, err := store.NewRedisClient(cfg)
+		if err != nil {
+			panic(err)
+		}
+		rl.redis = client
+	}
+
+	rl.failurePolicy = cfg.FailurePolicy
+	switch rl.failurePolicy {
+	case FailOpenPolicy, FailClosedPolicy, FallbackPolicy:
+	case "":
+		rl.failurePolicy = FailOpenPolicy
+	default:
+		log.Logf(log.Warn, "Unknown failure policy %q, falling back to %s", cfg.FailurePolicy, FailOpenPolicy)
+		rl.failurePolicy = FailOpenPolicy
+	}
+	threshold := cfg.FailureThreshold
+	if threshold == 0 {
+		threshold = defaultFailureThreshold
+	}
+	backoff := time.Duration(cfg.RetryBackoffInSeconds) * time.Second
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+	maxBackoff := time.Duration(cfg.RetryMaxBackoffInSeconds) * time.Second
+	if maxBackoff == 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	rl.breaker = newCircuitBreaker(threshold, backoff, maxBackoff)
+	rl.fallback = store.NewShardedStore()
+	rl.fallback.SetMaxEntries(int(rl.Config().MaxKeys))
+
+	if err := store.PingRedis(context.Background(), rl.redis); err != nil {
+		log.Logf(log.Error, "Redis is unavailable, applying the %s policy: %s", rl.failurePolicy, err)
+		rl.breaker.trip(err, time.Now())
+	}
+}
+
+// degrade takes the decision of a hit with the failure policy
+func (rl *RateLimiter) degrade(ctx context.Context, ip string, token string, rule rule, now time.Time) store.Result {
+	switch rl.failurePolicy {
+	case FailClosedPolicy:
+		retryAfter := rl.breaker.retryAfter(now)
+		if retryAfter < time.Second {
+			retryAfter = time.Second
+		}
+		return store.Result{Limited: true, RetryAfter: retryAfter, ResetAfter: retryAfter}
+	case FallbackPolicy:
+		return takeStore(ctx, rl.fallback, ip, token, func() store.Store {
+			return newInMemoryStore(rule.algorithm, rule.config)
+		})
+	}
+	return store.Result{}
+}
+
+// clearFallback deletes the stores of the fallback policy, so they start over on the next outage
+func (rl *RateLimiter) clearFallback() {
+	if rl.fallback != nil {
+		rl.fallback.Filter(func(ip string, token string, s store.Store) bool {
+			return false
+		})
+	}
+}
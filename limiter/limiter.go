@@ -1,80 +1,361 @@
 package limiter
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/log"
 	"github.com/eliasfeijo/go-rate-limiter/mocks"
 	"github.com/eliasfeijo/go-rate-limiter/store"
+	"github.com/redis/go-redis/v9"
 )
 
+// RateLimiter is safe for concurrent use by multiple goroutines
 type RateLimiter struct {
-	Config         *config.RateLimiterConfig
-	Store          store.IpStore
-	mutex          sync.Mutex
+	config         atomic.Pointer[config.RateLimiterConfig]
+	reloadMutex    sync.Mutex
+	Store          *store.ShardedStore
 	onStoreCreated store.StoreCreatedCallback
+	onError        ErrorHandler
+	redis          redis.UniversalClient
+	// The circuit breaker of Redis, the failure policy and the stores of the fallback policy
+	breaker       *circuitBreaker
+	failurePolicy string
+	fallback      *store.ShardedStore
+	// The node of the gossip store strategy, which is closed with the RateLimiter unless it was given
+	gossip     *store.GossipNode
+	ownsGossip bool
+	// The node of the remote store strategy, which is closed with the RateLimiter unless it was given
+	remote     *store.RemoteNode
+	ownsRemote bool
+	// The database of the sql store strategy, which is closed with the RateLimiter unless it was given
+	sql     *store.SQLDatabase
+	ownsSQL bool
+	// The snapshot file of the in-memory stores, saved every interval until the RateLimiter is closed
+	snapshotFile string
+	snapshotStop chan struct{}
+	snapshotDone chan struct{}
 }
 
-func NewRateLimiter(config *config.RateLimiterConfig, store store.IpStore, storeCreatedCallback store.StoreCreatedCallback) *RateLimiter {
-	return &RateLimiter{
-		Config:         config,
-		Store:          store,
-		mutex:          sync.Mutex{},
-		onStoreCreated: storeCreatedCallback,
+// NewRateLimiter creates a RateLimiter with its own stores, panicking if the algorithms or route
+// rules of the configuration are invalid (which Reload rejects the same way). When the redis (or
+// hybrid) store strategy is configured without WithRedisClient, it creates a client for the Redis
+// server of the configuration, panicking if the configuration is invalid. Redis being unavailable
+// doesn't prevent the RateLimiter from being created, its failure policy being applied until it is.
+// Likewise, the gossip and remote store strategies create a node with their configuration unless
+// one is given by WithGossipNode or WithRemoteNode, panicking if it can't listen on its bind address,
+// and the sql store strategy opens the database of the configuration unless one is given by
+// WithSQLDatabase, panicking if it can't be migrated. When a snapshot file is configured, the
+// in-memory stores are restored from it, and saved to it every interval until it's closed.
+func NewRateLimiter(config *config.RateLimiterConfig, options ...Option) *RateLimiter {
+	if err := checkConfig(config); err != nil {
+		panic(err)
 	}
+	rl := &RateLimiter{
+		Store:   store.NewShardedStore(),
+		onError: logStoreError,
+	}
+	rl.config.Store(config)
+	for _, option := range options {
+		option(rl)
+	}
+	rl.Store.SetMaxEntries(int(config.MaxKeys))
+	if config.StoreStrategy == store.RedisStoreStrategy || config.StoreStrategy == store.HybridStoreStrategy {
+		rl.setupRedis(config.RedisConfig)
+	}
+	if config.StoreStrategy == store.GossipStoreStrategy && rl.gossip == nil {
+		node, err := store.NewGossipNode(config.GossipConfig)
+		if err != nil {
+			panic(err)
+		}
+		rl.gossip, rl.ownsGossip = node, true
+	}
+	if config.StoreStrategy == store.RemoteStoreStrategy {
+		if rl.remote == nil {
+			node, err := store.NewRemoteNode(config.RemoteConfig, newInMemoryStore)
+			if err != nil {
+				panic(err)
+			}
+			rl.remote, rl.ownsRemote = node, true
+		}
+		rl.remote.SetRules(rl.remoteRule)
+		rl.remote.Stores().SetMaxEntries(int(config.MaxKeys))
+	}
+	if config.StoreStrategy == store.SQLStoreStrategy && rl.sql == nil {
+		db, err := store.OpenSQLDatabase(config.SQLConfig)
+		if err != nil {
+			panic(err)
+		}
+		rl.sql, rl.ownsSQL = db, true
+	}
+	if config.SnapshotFile != "" {
+		rl.startSnapshots(config)
+	}
+	return rl
 }
 
+// Close saves the snapshot of the in-memory stores when it's configured, and stops the gossip or
+// remote node, or closes the database, created by the RateLimiter
+func (rl *RateLimiter) Close() error {
+	var errs []error
+	if rl.snapshotStop != nil {
+		errs = append(errs, rl.stopSnapshots())
+	}
+	if rl.ownsGossip {
+		errs = append(errs, rl.gossip.Close())
+	}
+	if rl.ownsRemote {
+		errs = append(errs, rl.remote.Close())
+	}
+	if rl.ownsSQL {
+		errs = append(errs, rl.sql.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Config returns the current configuration, which must not be modified
+func (rl *RateLimiter) Config() *config.RateLimiterConfig {
+	return rl.config.Load()
+}
+
+// Limit reports whether the request of the ip and token must be limited
 func (rl *RateLimiter) Limit(ip string, token string) bool {
-	// rl.mutex.Lock()
-	// defer rl.mutex.Unlock()
-
-	var s store.Store
-
-	if s, ok := rl.Store[ip][token]; !ok {
-		maxRequests := rl.Config.IpAddressMaxRequests
-		limitInSeconds := rl.Config.IpAddressLimitInSeconds
-		blockInSeconds := rl.Config.IpAddressBlockInSeconds
-		if token != "" {
-			maxRequests = rl.Config.MapTokenConfig[token].MaxRequests
-			limitInSeconds = rl.Config.MapTokenConfig[token].LimitInSeconds
-			blockInSeconds = rl.Config.MapTokenConfig[token].BlockInSeconds
+	return !rl.Decide(ip, token).Allowed
+}
+
+// Reserve works like Limit, but also returns how long the request must be held back before being
+// handled when its store delays requests instead of limiting them right away (e.g.: leaky bucket)
+func (rl *RateLimiter) Reserve(ip string, token string) (time.Duration, bool) {
+	decision := rl.Decide(ip, token)
+	return decision.Delay, !decision.Allowed
+}
+
+// Decide counts a request of the ip and token, and returns whether it's allowed along with the
+// state of the limit it was counted against. The ip can be any key identifying the client, such as
+// the ones extracted by the middleware's KeyFunc.
+func (rl *RateLimiter) Decide(ip string, token string) Decision {
+	return rl.DecideContext(context.Background(), ip, token)
+}
+
+// DecideContext works like Decide, the context bounding the calls to the stores implementing
+// store.ContextStore (e.g.: the context of the request, so Redis isn't waited for once the client
+// gave up or the request's deadline passed)
+func (rl *RateLimiter) DecideContext(ctx context.Context, ip string, token string) Decision {
+	return rl.decide(ctx, ip, token, tokenRule(rl.Config(), token))
+}
+
+func (rl *RateLimiter) decide(ctx context.Context, ip string, token string, rule rule) Decision {
+	result, degraded := rl.take(ctx, ip, token, rule)
+	decision := newDecision(result, rule, time.Now())
+	decision.Degraded = degraded
+	// The fallback policy is the only one taking the decision with a store
+	decision.StateUnknown = degraded && (rl.breaker == nil || rl.failurePolicy != FallbackPolicy)
+	return decision
+}
+
+// take counts a hit for the ip and token in their store, applying the failure policy instead
+// (in which case degraded is true) when the store fails or Redis is known to be unavailable.
+// The errors of the store are reported to the error handler, and the requests are allowed when
+// there's no failure policy (i.e.: the store strategy doesn't use Redis).
+func (rl *RateLimiter) take(ctx context.Context, ip string, token string, rule rule) (result store.Result, degraded bool) {
+	create := func() store.Store {
+		return rl.createStore(ip, token, rule)
+	}
+	if rl.breaker == nil {
+		result = takeStore(ctx, rl.Store, ip, token, create)
+		if result.Err != nil {
+			rl.onError(ctx, ip, token, result.Err)
+			return store.Result{}, true
 		}
-		rl.Store[ip] = make(store.TokenStore)
-		storeConfig := &store.StoreConfig{
-			MaxRequests:    maxRequests,
-			LimitInSeconds: limitInSeconds,
-			BlockInSeconds: blockInSeconds,
+		return result, false
+	}
+	now := time.Now()
+	if !rl.breaker.allow(now) {
+		return rl.degrade(ctx, ip, token, rule, now), true
+	}
+	result = takeStore(ctx, rl.Store, ip, token, create)
+	if result.Err != nil {
+		rl.onError(ctx, ip, token, result.Err)
+		if ctx.Err() != nil {
+			// The request was canceled or timed out, which says nothing about Redis
+			rl.breaker.abort(now)
+		} else if rl.breaker.failure(result.Err, now) {
+			log.Logf(log.Error, "Redis is unavailable, applying the %s policy: %s", rl.failurePolicy, result.Err)
 		}
-		switch rl.Config.StoreStrategy {
-		case "test":
-		case "mock":
-			s = mocks.NewMockStore()
-			fmt.Println(s)
-		case store.RedisStoreStrategy:
-			s = store.NewRedisStore(ip, token, storeConfig)
-		default:
-		case store.InMemoryStoreStrategy:
-			s = store.NewInMemoryStore(storeConfig)
+		return rl.degrade(ctx, ip, token, rule, now), true
+	}
+	if rl.breaker.success(now) {
+		log.Log(log.Info, "Redis is available again")
+		rl.clearFallback()
+	}
+	return result, false
+}
+
+// takeStore counts a hit for the ip and token in sharded stores, creating their store with create
+// if it doesn't exist yet. Stores implementing store.AtomicStore take the decision by themselves
+// (bounded by the context when they implement store.ContextStore), while the steps are taken one
+// by one for the other stores, only reporting whether the hit is limited and its delay. These
+// stores aren't hit when they're just created, so they must be created with the first hit counted
+// (unlike the stores of this module, which all take their hits atomically and start empty). Either
+// way, the store is locked while the decision is taken.
+func takeStore(ctx context.Context, stores *store.ShardedStore, ip string, token string, create func() store.Store) (result store.Result) {
+	stores.Do(ip, token, create, func(s store.Store, created bool) {
+		if s, ok := s.(store.ContextStore); ok {
+			result, _ = s.TakeContext(ctx)
+			return
 		}
-		if rl.onStoreCreated != nil {
-			s = rl.onStoreCreated(s)
+		if s, ok := s.(store.AtomicStore); ok {
+			result = s.Take()
+			return
 		}
-		rl.Store[ip][token] = s
-	} else {
+		result = takeSteps(s, created)
+	})
+	return
+}
+
+// takeSteps takes the decision of a store that doesn't implement store.AtomicStore
+func takeSteps(s store.Store, created bool) store.Result {
+	if !created {
 		if s.ShouldRefresh() {
 			s.Refresh()
 		} else {
 			if s.IsBlocked() {
-				return true
+				return store.Result{Limited: true, Blocked: true}
 			}
 			s.Hit()
 		}
 	}
-	s, _ = rl.Store[ip][token]
 	if s.ShouldLimit() {
 		s.Block()
-		return true
+		return store.Result{Limited: true}
+	}
+	if s, ok := s.(store.DelayedStore); ok {
+		return store.Result{Delay: s.Delay()}
+	}
+	return store.Result{}
+}
+
+// rule is the limit applied to the requests of a token
+type rule struct {
+	name      string
+	algorithm string
+	config    *store.StoreConfig
+}
+
+// tokenRule returns the rule of the token, which is the token's configuration when it has one
+func tokenRule(cfg *config.RateLimiterConfig, token string) rule {
+	r := rule{
+		name:      IpAddressRule,
+		algorithm: cfg.Algorithm,
+		config: &store.StoreConfig{
+			MaxRequests:      cfg.IpAddressMaxRequests,
+			LimitInSeconds:   cfg.IpAddressLimitInSeconds,
+			BlockInSeconds:   cfg.IpAddressBlockInSeconds,
+			MaxWaitInSeconds: cfg.LeakyBucketMaxWaitInSeconds,
+		},
+	}
+	if tokenConfig, ok := cfg.MapTokenConfig[token]; ok && token != "" {
+		r.name = TokenRule
+		r.config.MaxRequests = tokenConfig.MaxRequests
+		r.config.LimitInSeconds = tokenConfig.LimitInSeconds
+		r.config.BlockInSeconds = tokenConfig.BlockInSeconds
+		if tokenConfig.Algorithm != "" {
+			r.algorithm = tokenConfig.Algorithm
+		}
+	}
+	return r
+}
+
+// createStore creates the store of the ip and token applying the rule
+func (rl *RateLimiter) createStore(ip string, token string, rule rule) store.Store {
+	s := rl.newStore(ip, token, rule.algorithm, rule.config)
+	if rl.onStoreCreated != nil {
+		s = rl.onStoreCreated(s)
+	}
+	return s
+}
+
+// newStore creates the store implementing the given algorithm for the configured store strategy.
+// The hybrid store strategy only leases the hits of the fixed window algorithm, the other
+// algorithms being taken by their Redis store. The gossip store strategy implements the sliding
+// window counter algorithm, and the fixed window one for the other algorithms. The remote store
+// strategy forwards every algorithm to the in-memory store of the key's owner, while the sql store
+// strategy implements the fixed window algorithm for every algorithm.
+func (rl *RateLimiter) newStore(ip string, token string, algorithm string, storeConfig *store.StoreConfig) store.Store {
+	cfg := rl.Config()
+	switch cfg.StoreStrategy {
+	case "test":
+		return nil
+	case "mock":
+		return mocks.NewMockStore()
+	case store.HybridStoreStrategy:
+		if algorithm == "" || algorithm == store.FixedWindowAlgorithm {
+			return store.NewHybridStore(rl.redis, ip, token, storeConfig, store.LeaseConfig{
+				BatchSize:       cfg.HybridBatchSize,
+				MaxSharePercent: cfg.HybridMaxSharePercent,
+			})
+		}
+		return newRedisStore(rl.redis, ip, token, algorithm, storeConfig)
+	case store.SQLStoreStrategy:
+		return store.NewSQLStore(rl.sql, ip, token, storeConfig)
+	case store.RemoteStoreStrategy:
+		return store.NewRemoteStore(rl.remote, ip, token)
+	case store.GossipStoreStrategy:
+		return store.NewGossipStore(rl.gossip, ip, token, algorithm, storeConfig)
+	case store.RedisStoreStrategy:
+		return newRedisStore(rl.redis, ip, token, algorithm, storeConfig)
+	default:
+		return newInMemoryStore(algorithm, storeConfig)
+	}
+}
+
+// remoteRule returns the rule the keys owned by the remote node are limited with, as of the
+// current configuration
+func (rl *RateLimiter) remoteRule(ip string, token string) (string, *store.StoreConfig, bool) {
+	r, ok := keyRule(rl.Config(), ip, token)
+	return r.algorithm, r.config, ok
+}
+
+// newRedisStore creates the Redis store implementing the given algorithm
+func newRedisStore(client redis.UniversalClient, ip string, token string, algorithm string, storeConfig *store.StoreConfig) store.Store {
+	switch algorithm {
+	case store.TokenBucketAlgorithm:
+		return store.NewRedisTokenBucketStore(client, ip, token, storeConfig)
+	case store.SlidingWindowLogAlgorithm:
+		return store.NewRedisSlidingWindowLogStore(client, ip, token, storeConfig)
+	case store.SlidingWindowCounterAlgorithm:
+		return store.NewRedisSlidingWindowCounterStore(client, ip, token, storeConfig)
+	case store.GCRAAlgorithm:
+		return store.NewRedisGCRAStore(client, ip, token, storeConfig)
+	case store.LeakyBucketAlgorithm:
+		return store.NewRedisLeakyBucketStore(client, ip, token, storeConfig)
+	case "", store.FixedWindowAlgorithm:
+	default:
+		log.Logf(log.Warn, "Unknown algorithm %q, falling back to %s", algorithm, store.FixedWindowAlgorithm)
+	}
+	return store.NewRedisStore(client, ip, token, storeConfig)
+}
+
+// newInMemoryStore creates the in-memory store implementing the given algorithm
+func newInMemoryStore(algorithm string, storeConfig *store.StoreConfig) store.Store {
+	switch algorithm {
+	case store.TokenBucketAlgorithm:
+		return store.NewInMemoryTokenBucketStore(storeConfig)
+	case store.SlidingWindowLogAlgorithm:
+		return store.NewInMemorySlidingWindowLogStore(storeConfig)
+	case store.SlidingWindowCounterAlgorithm:
+		return store.NewInMemorySlidingWindowCounterStore(storeConfig)
+	case store.GCRAAlgorithm:
+		return store.NewInMemoryGCRAStore(storeConfig)
+	case store.LeakyBucketAlgorithm:
+		return store.NewInMemoryLeakyBucketStore(storeConfig)
+	case "", store.FixedWindowAlgorithm:
+	default:
+		log.Logf(log.Warn, "Unknown algorithm %q, falling back to %s", algorithm, store.FixedWindowAlgorithm)
 	}
-	return false
+	return store.NewInMemoryStore(storeConfig)
 }
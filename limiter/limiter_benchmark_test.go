@@ -0,0 +1,52 @@
+package limiter_test
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/limiter"
+	"github.com/eliasfeijo/go-rate-limiter/store"
+)
+
+// Run with `go test ./limiter -run ^$ -bench . -cpu 1,2,4,8` to see how the throughput scales with GOMAXPROCS
+
+func newBenchmarkRateLimiter() *limiter.RateLimiter {
+	return limiter.NewRateLimiter(&config.RateLimiterConfig{
+		IpAddressMaxRequests:    1 << 30,
+		IpAddressLimitInSeconds: 60,
+		IpAddressBlockInSeconds: 1,
+		StoreStrategy:           store.InMemoryStoreStrategy,
+		Algorithm:               store.FixedWindowAlgorithm,
+	})
+}
+
+// BenchmarkLimit_DistinctKeys hits 1024 IP addresses, as a server handling many clients would
+func BenchmarkLimit_DistinctKeys(b *testing.B) {
+	rl := newBenchmarkRateLimiter()
+	ips := make([]string, 1024)
+	for i := range ips {
+		ips[i] = "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+	}
+	var goroutine int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&goroutine, 1)) * 7919
+		for pb.Next() {
+			rl.Limit(ips[i%len(ips)], "")
+			i++
+		}
+	})
+}
+
+// BenchmarkLimit_SameKey hits a single IP address, the worst case for contention
+func BenchmarkLimit_SameKey(b *testing.B) {
+	rl := newBenchmarkRateLimiter()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rl.Limit("10.0.0.1", "")
+		}
+	})
+}
@@ -2,12 +2,21 @@ package limiter_test
 
 // Basic imports
 import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/eliasfeijo/go-rate-limiter/config"
 	"github.com/eliasfeijo/go-rate-limiter/limiter"
 	"github.com/eliasfeijo/go-rate-limiter/mocks"
 	"github.com/eliasfeijo/go-rate-limiter/store"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
@@ -34,16 +43,17 @@ func (suite *LimiterTestSuite) SetupTest() {
 }
 
 func (s *LimiterTestSuite) TestShouldCreateStoreWhenItDoesNotExist() {
-	rl := limiter.NewRateLimiter(s.rateLimiterConfig, make(store.IpStore), func(store store.Store) store.Store {
+	rl := limiter.NewRateLimiter(s.rateLimiterConfig, limiter.WithStoreCreatedCallback(func(store store.Store) store.Store {
 		mockStore := &mocks.MockStore{}
 		mockStore.On("ShouldLimit").Return(false)
 		return mockStore
-	})
+	}))
 	result := rl.Limit(ip, "")
 	assert.False(s.T(), result)
-	assert.NotNil(s.T(), rl.Store[ip])
-	assert.NotNil(s.T(), rl.Store[ip][""])
-	assert.IsType(s.T(), &mocks.MockStore{}, rl.Store[ip][""])
+	ipStore, ok := rl.Store.Get(ip, "")
+	assert.True(s.T(), ok)
+	assert.NotNil(s.T(), ipStore)
+	assert.IsType(s.T(), &mocks.MockStore{}, ipStore)
 }
 
 func (s *LimiterTestSuite) TestRefresh() {
@@ -57,10 +67,11 @@ func (s *LimiterTestSuite) TestRefresh() {
 	ipStore := make(store.IpStore)
 	ipStore[ip] = make(store.TokenStore)
 	ipStore[ip][""] = mockStore
-	rl := limiter.NewRateLimiter(s.rateLimiterConfig, ipStore, nil)
+	rl := limiter.NewRateLimiter(s.rateLimiterConfig, limiter.WithStores(ipStore))
 	result := rl.Limit(ip, "")
 	assert.False(s.T(), result)
-	store := rl.Store[ip][""].(*mocks.MockStore)
+	createdStore, _ := rl.Store.Get(ip, "")
+	store := createdStore.(*mocks.MockStore)
 	store.AssertCalled(s.T(), "ShouldRefresh")
 	store.AssertCalled(s.T(), "Refresh")
 	store.AssertNotCalled(s.T(), "IsBlocked")
@@ -79,10 +90,11 @@ func (s *LimiterTestSuite) TestIsBlocked() {
 	ipStore := make(store.IpStore)
 	ipStore[ip] = make(store.TokenStore)
 	ipStore[ip][""] = mockStore
-	rl := limiter.NewRateLimiter(s.rateLimiterConfig, ipStore, nil)
+	rl := limiter.NewRateLimiter(s.rateLimiterConfig, limiter.WithStores(ipStore))
 	result := rl.Limit(ip, "")
 	assert.True(s.T(), result)
-	store := rl.Store[ip][""].(*mocks.MockStore)
+	createdStore, _ := rl.Store.Get(ip, "")
+	store := createdStore.(*mocks.MockStore)
 	store.AssertCalled(s.T(), "ShouldRefresh")
 	store.AssertCalled(s.T(), "IsBlocked")
 	store.AssertNotCalled(s.T(), "Hit")
@@ -100,10 +112,11 @@ func (s *LimiterTestSuite) TestShouldLimitAndBlock() {
 	ipStore := make(store.IpStore)
 	ipStore[ip] = make(store.TokenStore)
 	ipStore[ip][""] = mockStore
-	rl := limiter.NewRateLimiter(s.rateLimiterConfig, ipStore, nil)
+	rl := limiter.NewRateLimiter(s.rateLimiterConfig, limiter.WithStores(ipStore))
 	result := rl.Limit(ip, "")
 	assert.True(s.T(), result)
-	store := rl.Store[ip][""].(*mocks.MockStore)
+	createdStore, _ := rl.Store.Get(ip, "")
+	store := createdStore.(*mocks.MockStore)
 	store.AssertCalled(s.T(), "ShouldRefresh")
 	store.AssertCalled(s.T(), "IsBlocked")
 	store.AssertCalled(s.T(), "Hit")
@@ -111,6 +124,476 @@ func (s *LimiterTestSuite) TestShouldLimitAndBlock() {
 	store.AssertCalled(s.T(), "Block")
 }
 
+func (s *LimiterTestSuite) TestTokenAlgorithm() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.MapTokenConfig = config.MapTokenConfig{
+		"abc123": {MaxRequests: 2, LimitInSeconds: 60, BlockInSeconds: 5, Algorithm: store.TokenBucketAlgorithm},
+	}
+	rl := limiter.NewRateLimiter(&cfg)
+	assert.False(s.T(), rl.Limit(ip, "abc123"))
+	assert.False(s.T(), rl.Limit(ip, ""))
+	tokenStore, _ := rl.Store.Get(ip, "abc123")
+	ipStore, _ := rl.Store.Get(ip, "")
+	assert.IsType(s.T(), &store.InMemoryTokenBucketStore{}, tokenStore)
+	assert.IsType(s.T(), &store.InMemoryStore{}, ipStore)
+	assert.False(s.T(), rl.Limit(ip, "abc123"))
+	assert.True(s.T(), rl.Limit(ip, "abc123"))
+	assert.True(s.T(), rl.Limit(ip, "abc123"))
+	assert.Equal(s.T(), uint(5), tokenStore.RemainingBlockTime())
+}
+
+func (s *LimiterTestSuite) TestDecide() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.Algorithm = store.SlidingWindowLogAlgorithm
+	cfg.IpAddressMaxRequests = 2
+	cfg.IpAddressLimitInSeconds = 10
+	cfg.IpAddressBlockInSeconds = 30
+	cfg.MapTokenConfig = map[string]*config.TokenConfig{
+		"abc123": {MaxRequests: 5, LimitInSeconds: 1, BlockInSeconds: 0},
+	}
+	rl := limiter.NewRateLimiter(&cfg)
+
+	start := time.Now()
+	decision := rl.Decide(ip, "")
+	assert.True(s.T(), decision.Allowed)
+	assert.Equal(s.T(), limiter.IpAddressRule, decision.Rule)
+	assert.Equal(s.T(), uint(2), decision.Limit)
+	assert.Equal(s.T(), uint(1), decision.Remaining)
+	assert.Zero(s.T(), decision.RetryAfter)
+	assert.WithinDuration(s.T(), start.Add(10*time.Second), decision.Reset, time.Second)
+
+	decision = rl.Decide(ip, "")
+	assert.True(s.T(), decision.Allowed)
+	assert.Equal(s.T(), uint(0), decision.Remaining)
+
+	decision = rl.Decide(ip, "")
+	assert.False(s.T(), decision.Allowed)
+	assert.True(s.T(), decision.Blocked)
+	assert.Equal(s.T(), uint(0), decision.Remaining)
+	assert.InDelta(s.T(), 30*time.Second, decision.RetryAfter, float64(time.Second))
+	assert.WithinDuration(s.T(), start.Add(30*time.Second), decision.Reset, time.Second)
+
+	decision = rl.Decide(ip, "abc123")
+	assert.True(s.T(), decision.Allowed)
+	assert.Equal(s.T(), limiter.TokenRule, decision.Rule)
+	assert.Equal(s.T(), uint(5), decision.Limit)
+	assert.Equal(s.T(), uint(4), decision.Remaining)
+}
+
+func (s *LimiterTestSuite) TestConcurrentLimit() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.IpAddressMaxRequests = 50
+	cfg.IpAddressLimitInSeconds = 60
+	rl := limiter.NewRateLimiter(&cfg)
+
+	// Every IP address is hit 100 times concurrently, so exactly half the hits are accepted
+	var accepted int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if !rl.Limit(strconv.Itoa(j), "") {
+					atomic.AddInt64(&accepted, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(s.T(), int64(500), accepted)
+	assert.Equal(s.T(), 10, rl.Store.Len())
+}
+
+func (s *LimiterTestSuite) TestReload() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.IpAddressMaxRequests = 2
+	cfg.IpAddressLimitInSeconds = 60
+	cfg.IpAddressBlockInSeconds = 0
+	cfg.MapTokenConfig = config.MapTokenConfig{
+		"abc123": {MaxRequests: 5, LimitInSeconds: 60},
+	}
+	cfg.RouteRules = config.RouteRules{
+		{Name: "login", Pattern: "/login", MaxRequests: 1, LimitInSeconds: 60},
+	}
+	rl := limiter.NewRateLimiter(&cfg)
+	login := limiter.Route{Method: "POST", Path: "/login"}
+	assert.True(s.T(), rl.Decide(ip, "").Allowed)
+	assert.True(s.T(), rl.Decide(ip, "abc123").Allowed)
+	assert.True(s.T(), rl.DecideRoute(ip, "", login).Allowed)
+
+	reloaded := cfg
+	reloaded.IpAddressMaxRequests = 3
+	reloaded.MapTokenConfig = nil
+	reloaded.RouteRules = config.RouteRules{
+		{Name: "login", Pattern: "/login", MaxRequests: 1, LimitInSeconds: 60, Algorithm: store.GCRAAlgorithm},
+	}
+	assert.NoError(s.T(), rl.Reload(&reloaded))
+	assert.Same(s.T(), &reloaded, rl.Config())
+
+	// The IP address keeps its hit with the new limit, while the stores of the removed token and
+	// of the rule whose algorithm changed start over
+	decision := rl.Decide(ip, "")
+	assert.Equal(s.T(), uint(3), decision.Limit)
+	assert.Equal(s.T(), uint(1), decision.Remaining)
+	decision = rl.Decide(ip, "abc123")
+	assert.Equal(s.T(), limiter.IpAddressRule, decision.Rule)
+	assert.Equal(s.T(), uint(2), decision.Remaining)
+	assert.True(s.T(), rl.DecideRoute(ip, "", login).Allowed)
+	assert.False(s.T(), rl.DecideRoute(ip, "", login).Allowed)
+
+	unsupported := reloaded
+	unsupported.MapTokenConfig = config.MapTokenConfig{
+		"abc123": {MaxRequests: 5, LimitInSeconds: 60, Algorithm: store.TokenBucketAlgorithm},
+	}
+	unsupported.StoreStrategy = store.SQLStoreStrategy
+	assert.ErrorContains(s.T(), rl.Reload(&unsupported), `the sql store strategy doesn't implement the algorithm "token_bucket" of the token "abc123"`)
+
+	invalid := reloaded
+	invalid.StoreStrategy = store.RedisStoreStrategy
+	invalid.Algorithm = "unknown"
+	invalid.RouteRules = config.RouteRules{
+		{Name: "login", Pattern: "/login"},
+		{Name: "login", Pattern: "/users/{id:[0-9}"},
+	}
+	err := rl.Reload(&invalid)
+	assert.ErrorContains(s.T(), err, "store strategy")
+	assert.ErrorContains(s.T(), err, "unknown algorithm")
+	assert.ErrorContains(s.T(), err, "duplicate route rule")
+	assert.ErrorContains(s.T(), err, "invalid pattern")
+	assert.Same(s.T(), &reloaded, rl.Config())
+	assert.False(s.T(), rl.DecideRoute(ip, "", login).Allowed)
+}
+
+func (s *LimiterTestSuite) TestInvalidConfig() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.RouteRules = config.RouteRules{
+		{Name: "users", Pattern: "/users/{id:[0-9}"},
+	}
+	assert.PanicsWithError(s.T(), `invalid pattern "/users/{id:[0-9}" of the route rule "users": error parsing regexp: missing closing ]: `+"`[0-9`", func() {
+		limiter.NewRateLimiter(&cfg)
+	})
+
+	// The algorithms must be implemented by the store strategy
+	cfg.StoreStrategy = store.GossipStoreStrategy
+	cfg.RouteRules = config.RouteRules{
+		{Name: "users", Pattern: "/users", Algorithm: store.SlidingWindowCounterAlgorithm},
+		{Name: "login", Pattern: "/login", Algorithm: store.GCRAAlgorithm},
+	}
+	assert.PanicsWithError(s.T(), `the gossip store strategy doesn't implement the algorithm "gcra" of the route rule "login"`, func() {
+		limiter.NewRateLimiter(&cfg)
+	})
+}
+
+func (s *LimiterTestSuite) TestRouteKeys() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.IpAddressMaxRequests = 1
+	cfg.IpAddressLimitInSeconds = 60
+	cfg.RouteRules = config.RouteRules{
+		{Name: "api", Pattern: "/api", MaxRequests: 1, LimitInSeconds: 60},
+		{Name: "api:ff", Pattern: "/api/ff", MaxRequests: 5, LimitInSeconds: 60},
+	}
+	rl := limiter.NewRateLimiter(&cfg)
+	api := limiter.Route{Method: "GET", Path: "/api"}
+
+	// The stores of the route rules are kept apart from the ones of the keys looking like them
+	assert.True(s.T(), rl.DecideRoute("ff::1", "", api).Allowed)
+	assert.True(s.T(), rl.Decide("route:api:ff::1", "").Allowed)
+
+	// Reloading the rule whose name prefixes the other one's keeps the store of the other rule
+	reloaded := cfg
+	reloaded.RouteRules = config.RouteRules{
+		cfg.RouteRules[0],
+		{Name: "api:ff", Pattern: "/api/ff", MaxRequests: 5, LimitInSeconds: 60, Algorithm: store.GCRAAlgorithm},
+	}
+	assert.NoError(s.T(), rl.Reload(&reloaded))
+	assert.False(s.T(), rl.DecideRoute("ff::1", "", api).Allowed)
+}
+
+func (s *LimiterTestSuite) TestRedisClients() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.RedisStoreStrategy
+	cfg.IpAddressMaxRequests = 1
+	cfg.IpAddressLimitInSeconds = 60
+
+	// Every limiter uses its own Redis server, so they don't share their counters
+	var limiters []*limiter.RateLimiter
+	for i := 0; i < 2; i++ {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(s.T()).Addr()})
+		defer client.Close()
+		limiters = append(limiters, limiter.NewRateLimiter(&cfg, limiter.WithRedisClient(client)))
+	}
+	assert.False(s.T(), limiters[0].Limit(ip, ""))
+	assert.True(s.T(), limiters[0].Limit(ip, ""))
+	assert.False(s.T(), limiters[1].Limit(ip, ""))
+}
+
+func (s *LimiterTestSuite) TestFailurePolicies() {
+	for _, policy := range []string{limiter.FailOpenPolicy, limiter.FailClosedPolicy, limiter.FallbackPolicy} {
+		server := miniredis.RunT(s.T())
+		cfg := *s.rateLimiterConfig
+		cfg.StoreStrategy = store.RedisStoreStrategy
+		cfg.IpAddressMaxRequests = 1
+		cfg.IpAddressLimitInSeconds = 60
+		cfg.RedisConfig = config.RedisConfig{
+			Addresses:             []string{server.Addr()},
+			FailurePolicy:         policy,
+			FailureThreshold:      1,
+			RetryBackoffInSeconds: 1,
+		}
+		rl := limiter.NewRateLimiter(&cfg)
+		assert.True(s.T(), rl.Health().Healthy, policy)
+		assert.True(s.T(), rl.Decide(ip, "").Allowed, policy)
+
+		server.Close()
+		first, second := rl.Decide(ip, ""), rl.Decide(ip, "")
+		assert.True(s.T(), first.Degraded, policy)
+		// Only the fallback policy takes the decision with a store
+		assert.Equal(s.T(), policy != limiter.FallbackPolicy, first.StateUnknown, policy)
+		health := rl.Health()
+		assert.False(s.T(), health.Healthy, policy)
+		assert.Equal(s.T(), limiter.BreakerOpen, health.Redis.State, policy)
+		switch policy {
+		case limiter.FailOpenPolicy:
+			assert.True(s.T(), first.Allowed)
+			assert.True(s.T(), second.Allowed)
+		case limiter.FailClosedPolicy:
+			assert.False(s.T(), first.Allowed)
+			assert.InDelta(s.T(), time.Second, first.RetryAfter, float64(time.Second))
+		case limiter.FallbackPolicy:
+			// The local store doesn't know about the hit counted by Redis
+			assert.True(s.T(), first.Allowed)
+			assert.False(s.T(), second.Allowed)
+		}
+
+		// Redis is tried again after the backoff, and its counters are used again once it's back
+		assert.NoError(s.T(), server.Restart())
+		time.Sleep(time.Second)
+		decision := rl.Decide(ip, "")
+		assert.False(s.T(), decision.Degraded, policy)
+		assert.False(s.T(), decision.StateUnknown, policy)
+		assert.False(s.T(), decision.Allowed, policy)
+		assert.True(s.T(), rl.Health().Healthy, policy)
+	}
+}
+
+func (s *LimiterTestSuite) TestDecideContext() {
+	server := miniredis.RunT(s.T())
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.RedisStoreStrategy
+	cfg.IpAddressMaxRequests = 1
+	cfg.IpAddressLimitInSeconds = 60
+	cfg.RedisConfig = config.RedisConfig{
+		Addresses:        []string{server.Addr()},
+		FailurePolicy:    limiter.FailClosedPolicy,
+		FailureThreshold: 1,
+	}
+	var errs []error
+	rl := limiter.NewRateLimiter(&cfg, limiter.WithErrorHandler(func(ctx context.Context, ip string, token string, err error) {
+		errs = append(errs, err)
+	}))
+
+	// A canceled request is denied by the failure policy, without opening the breaker
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	decision := rl.DecideContext(ctx, ip, "")
+	assert.True(s.T(), decision.Degraded)
+	assert.False(s.T(), decision.Allowed)
+	if assert.Len(s.T(), errs, 1) {
+		assert.ErrorIs(s.T(), errs[0], context.Canceled)
+	}
+	assert.True(s.T(), rl.Health().Healthy)
+	assert.True(s.T(), rl.DecideContext(context.Background(), ip, "").Allowed)
+
+	server.Close()
+	assert.True(s.T(), rl.Decide(ip, "").Degraded)
+	assert.Len(s.T(), errs, 2)
+	assert.False(s.T(), rl.Health().Healthy)
+}
+
+func (s *LimiterTestSuite) TestMaxKeys() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.MaxKeys = 640
+	rl := limiter.NewRateLimiter(&cfg)
+	for i := 0; i < 10000; i++ {
+		rl.Decide(strconv.Itoa(i), "")
+	}
+	stats := rl.Store.Stats()
+	assert.LessOrEqual(s.T(), stats.Entries, 640)
+	assert.Equal(s.T(), uint64(10000-stats.Entries), stats.Evictions)
+
+	// The cap can be reloaded
+	cfg.MaxKeys = 0
+	assert.NoError(s.T(), rl.Reload(&cfg))
+	for i := 0; i < 10000; i++ {
+		rl.Decide("reloaded:"+strconv.Itoa(i), "")
+	}
+	assert.Greater(s.T(), rl.Store.Len(), 10000)
+}
+
+func (s *LimiterTestSuite) TestHybridStoreStrategy() {
+	server := miniredis.RunT(s.T())
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.HybridStoreStrategy
+	cfg.HybridBatchSize = 2
+	cfg.IpAddressLimitInSeconds = 60
+	cfg.MapTokenConfig = config.MapTokenConfig{
+		"abc123": {MaxRequests: 1, LimitInSeconds: 60, Algorithm: store.GCRAAlgorithm},
+	}
+	cfg.RedisConfig = config.RedisConfig{Addresses: []string{server.Addr()}}
+	rl := limiter.NewRateLimiter(&cfg)
+
+	for i := 0; i < 3; i++ {
+		assert.True(s.T(), rl.Decide(ip, "").Allowed)
+	}
+	assert.False(s.T(), rl.Decide(ip, "").Allowed)
+	ipStore, _ := rl.Store.Get(ip, "")
+	assert.IsType(s.T(), &store.HybridStore{}, ipStore)
+
+	// The other algorithms are taken by their Redis store
+	assert.True(s.T(), rl.Decide(ip, "abc123").Allowed)
+	tokenStore, _ := rl.Store.Get(ip, "abc123")
+	assert.IsType(s.T(), &store.RedisGCRAStore{}, tokenStore)
+}
+
+func (s *LimiterTestSuite) TestGossipStoreStrategy() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.GossipStoreStrategy
+	cfg.IpAddressLimitInSeconds = 3600
+	nodes := make([]*store.GossipNode, 2)
+	for i := range nodes {
+		node, err := store.NewGossipNode(config.GossipConfig{BindAddress: "127.0.0.1:0", IntervalInMilliseconds: 10, Secret: "secret"})
+		s.Require().NoError(err)
+		defer node.Close()
+		nodes[i] = node
+	}
+	nodes[0].SetPeers([]string{nodes[1].Addr()})
+	nodes[1].SetPeers([]string{nodes[0].Addr()})
+	first := limiter.NewRateLimiter(&cfg, limiter.WithGossipNode(nodes[0]))
+	second := limiter.NewRateLimiter(&cfg, limiter.WithGossipNode(nodes[1]))
+
+	for i := 0; i < 3; i++ {
+		assert.True(s.T(), second.Decide(ip, "").Allowed)
+	}
+	ipStore, _ := second.Store.Get(ip, "")
+	assert.IsType(s.T(), &store.GossipStore{}, ipStore)
+
+	// The hits taken by the second limiter are gossiped to the first one
+	gossiped := store.NewGossipStore(nodes[0], ip, "", "", &store.StoreConfig{MaxRequests: 3, LimitInSeconds: 3600})
+	assert.Eventually(s.T(), func() bool {
+		return gossiped.HitCount() == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.False(s.T(), first.Decide(ip, "").Allowed)
+}
+
+func (s *LimiterTestSuite) TestRemoteStoreStrategy() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.RemoteStoreStrategy
+	cfg.IpAddressLimitInSeconds = 60
+	cfg.RemoteConfig = config.RemoteConfig{BindAddress: "127.0.0.1:0", Secret: "secret"}
+
+	// A single node owns every key
+	rl := limiter.NewRateLimiter(&cfg)
+	defer rl.Close()
+	for i := 0; i < 3; i++ {
+		assert.True(s.T(), rl.Decide(ip, "").Allowed)
+	}
+	assert.False(s.T(), rl.Decide(ip, "").Allowed)
+	ipStore, _ := rl.Store.Get(ip, "")
+	assert.IsType(s.T(), &store.RemoteStore{}, ipStore)
+
+	// The limiters of a ring forward their decisions to the owner of the key, sharing its limit
+	nodes := make([]*store.RemoteNode, 2)
+	for i := range nodes {
+		node, err := store.NewRemoteNode(cfg.RemoteConfig, func(algorithm string, config *store.StoreConfig) store.Store {
+			return store.NewInMemoryStore(config)
+		})
+		s.Require().NoError(err)
+		defer node.Close()
+		nodes[i] = node
+	}
+	nodes[0].SetPeers([]string{nodes[1].Addr()})
+	nodes[1].SetPeers([]string{nodes[0].Addr()})
+	limiters := []*limiter.RateLimiter{
+		limiter.NewRateLimiter(&cfg, limiter.WithRemoteNode(nodes[0])),
+		limiter.NewRateLimiter(&cfg, limiter.WithRemoteNode(nodes[1])),
+	}
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiters[i%2].Decide(ip, "").Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(s.T(), 3, allowed)
+}
+
+func (s *LimiterTestSuite) TestSQLStoreStrategy() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.SQLStoreStrategy
+	cfg.IpAddressLimitInSeconds = 60
+	cfg.SQLConfig = config.SQLConfig{
+		Driver: "sqlite3",
+		DSN:    filepath.Join(s.T().TempDir(), "rate_limiter.db") + "?_busy_timeout=5000",
+	}
+	rl := limiter.NewRateLimiter(&cfg)
+	for i := 0; i < 3; i++ {
+		assert.True(s.T(), rl.Decide(ip, "").Allowed)
+	}
+	ipStore, _ := rl.Store.Get(ip, "")
+	assert.IsType(s.T(), &store.SQLStore{}, ipStore)
+	s.Require().NoError(rl.Close())
+
+	// The counters survive a restart
+	rl = limiter.NewRateLimiter(&cfg)
+	defer rl.Close()
+	decision := rl.Decide(ip, "")
+	assert.False(s.T(), decision.Allowed)
+	assert.True(s.T(), decision.Blocked)
+}
+
+func (s *LimiterTestSuite) TestSnapshot() {
+	cfg := *s.rateLimiterConfig
+	cfg.StoreStrategy = store.InMemoryStoreStrategy
+	cfg.IpAddressLimitInSeconds = 60
+	cfg.IpAddressBlockInSeconds = 300
+	cfg.MapTokenConfig = config.MapTokenConfig{
+		"abc123": {MaxRequests: 5, LimitInSeconds: 60, Algorithm: store.TokenBucketAlgorithm},
+	}
+	cfg.SnapshotFile = filepath.Join(s.T().TempDir(), "snapshot")
+	rl := limiter.NewRateLimiter(&cfg)
+	for i := 0; i < 4; i++ {
+		rl.Decide(ip, "")
+	}
+	rl.Decide(ip, "abc123")
+	s.Require().NoError(rl.Close())
+
+	// The blocked IP address is still blocked after a restart
+	rl = limiter.NewRateLimiter(&cfg)
+	decision := rl.Decide(ip, "")
+	assert.False(s.T(), decision.Allowed)
+	assert.True(s.T(), decision.Blocked)
+	tokenStore, _ := rl.Store.Get(ip, "abc123")
+	assert.Equal(s.T(), uint(1), tokenStore.HitCount())
+	s.Require().NoError(rl.Close())
+
+	// The stores whose algorithm changed start over
+	cfg.MapTokenConfig = config.MapTokenConfig{
+		"abc123": {MaxRequests: 5, LimitInSeconds: 60, Algorithm: store.GCRAAlgorithm},
+	}
+	rl = limiter.NewRateLimiter(&cfg)
+	defer rl.Close()
+	restored, err := rl.RestoreSnapshot(cfg.SnapshotFile)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), 1, restored)
+}
+
 func TestLimiterTestSuite(t *testing.T) {
 	suite.Run(t, new(LimiterTestSuite))
 }
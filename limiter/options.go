@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"context"
+
+	"github.com/eliasfeijo/go-rate-limiter/log"
+	"github.com/eliasfeijo/go-rate-limiter/store"
+	"github.com/redis/go-redis/v9"
+)
+
+// Option configures a RateLimiter
+type Option func(rl *RateLimiter)
+
+// WithStores starts the RateLimiter with the stores of an IpStore
+func WithStores(ipStore store.IpStore) Option {
+	return func(rl *RateLimiter) {
+		rl.Store = store.NewShardedStoreFrom(ipStore)
+	}
+}
+
+// WithStoreCreatedCallback sets a callback called with every store created, whose return value
+// is used as the store instead (e.g.: to wrap or replace it)
+func WithStoreCreatedCallback(callback store.StoreCreatedCallback) Option {
+	return func(rl *RateLimiter) {
+		rl.onStoreCreated = callback
+	}
+}
+
+// WithRedisClient sets the client used by the redis store strategy, instead of connecting to the
+// Redis server of the configuration. It can be a *redis.Client, *redis.ClusterClient or
+// *redis.Ring, and its scripts are loaded when they're first run.
+func WithRedisClient(client redis.UniversalClient) Option {
+	return func(rl *RateLimiter) {
+		rl.redis = client
+	}
+}
+
+// WithGossipNode sets the node used by the gossip store strategy, instead of creating one with the
+// gossip configuration (e.g.: to mount its handler on another server). The node isn't closed by
+// the RateLimiter.
+func WithGossipNode(node *store.GossipNode) Option {
+	return func(rl *RateLimiter) {
+		rl.gossip = node
+	}
+}
+
+// WithRemoteNode sets the node used by the remote store strategy, instead of creating one with the
+// remote configuration (e.g.: to mount its handler on another server). The rules of the node are
+// set to the ones of the RateLimiter, and the node isn't closed by the RateLimiter.
+func WithRemoteNode(node *store.RemoteNode) Option {
+	return func(rl *RateLimiter) {
+		rl.remote = node
+	}
+}
+
+// WithSQLDatabase sets the database used by the sql store strategy, instead of opening the database
+// of the SQL configuration. The database isn't closed by the RateLimiter.
+func WithSQLDatabase(db *store.SQLDatabase) Option {
+	return func(rl *RateLimiter) {
+		rl.sql = db
+	}
+}
+
+// ErrorHandler is called with the errors of the stores (e.g.: Redis is unavailable, or the context
+// of the request was canceled), along with the context, ip and token of the request
+type ErrorHandler func(ctx context.Context, ip string, token string, err error)
+
+// WithErrorHandler sets the handler called with the errors of the stores, instead of logging them
+// (a nil handler ignores them)
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(rl *RateLimiter) {
+		if handler == nil {
+			handler = func(ctx context.Context, ip string, token string, err error) {}
+		}
+		rl.onError = handler
+	}
+}
+
+// logStoreError is the default ErrorHandler
+func logStoreError(ctx context.Context, ip string, token string, err error) {
+	log.Logf(log.Error, "Error taking the decision of %s: %s", ip, err)
+}
@@ -0,0 +1,153 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/store"
+)
+
+// Reload atomically replaces the configuration of the limiter without losing the counters of the
+// keys whose rule still exists: their stores take the new limits, unless the rule's algorithm
+// changed. The stores of the removed tokens and route rules (or the ones becoming unlimited) are
+// deleted, and created again with their new rule by the next request. An invalid configuration is
+// rejected, keeping the current one.
+func (rl *RateLimiter) Reload(cfg *config.RateLimiterConfig) error {
+	rl.reloadMutex.Lock()
+	defer rl.reloadMutex.Unlock()
+
+	current := rl.Config()
+	if err := validate(current, cfg); err != nil {
+		return err
+	}
+	rl.config.Store(cfg)
+	rl.Store.SetMaxEntries(int(cfg.MaxKeys))
+	if rl.fallback != nil {
+		rl.fallback.SetMaxEntries(int(cfg.MaxKeys))
+	}
+	if rl.remote != nil {
+		rl.remote.Stores().SetMaxEntries(int(cfg.MaxKeys))
+	}
+
+	// A store created by a request in the meantime may already apply the new rule, in which case
+	// it's either reconfigured with the same limits or deleted, losing a single hit at most
+	rl.Store.Filter(func(ip string, token string, s store.Store) bool {
+		oldRule, ok := keyRule(current, ip, token)
+		if !ok {
+			return false
+		}
+		newRule, ok := keyRule(cfg, ip, token)
+		if !ok || newRule.name != oldRule.name || newRule.algorithm != oldRule.algorithm {
+			return false
+		}
+		if s, ok := s.(store.ConfigurableStore); ok {
+			s.SetConfig(newRule.config)
+			return true
+		}
+		return *newRule.config == *oldRule.config
+	})
+	rl.clearFallback()
+	return nil
+}
+
+// keyRule returns the rule a store key was created with, which is the route rule named by its
+// token, or the rule of its token
+func keyRule(cfg *config.RateLimiterConfig, ip string, token string) (rule, bool) {
+	name, ok := strings.CutPrefix(token, routeTokenPrefix)
+	if !ok {
+		return tokenRule(cfg, token), true
+	}
+	for _, routeRule := range cfg.RouteRules {
+		if routeRule.Name == name {
+			if routeRule.Unlimited {
+				return rule{}, false
+			}
+			return newRouteRule(cfg, routeRule), true
+		}
+	}
+	return rule{}, false
+}
+
+// validate checks that a configuration is valid and can replace the current one
+func validate(current *config.RateLimiterConfig, cfg *config.RateLimiterConfig) error {
+	if cfg == nil {
+		return errors.New("the configuration is missing")
+	}
+	var errs []error
+	if cfg.StoreStrategy != current.StoreStrategy {
+		errs = append(errs, fmt.Errorf("the store strategy can't be changed from %q to %q without a restart", current.StoreStrategy, cfg.StoreStrategy))
+	}
+	return errors.Join(append(errs, checkConfig(cfg))...)
+}
+
+// checkConfig checks the algorithms and route rules of a configuration
+func checkConfig(cfg *config.RateLimiterConfig) error {
+	var errs []error
+	if err := checkAlgorithm(cfg.StoreStrategy, cfg.Algorithm); err != nil {
+		errs = append(errs, err)
+	}
+	for token, tokenConfig := range cfg.MapTokenConfig {
+		if err := checkAlgorithm(cfg.StoreStrategy, tokenConfig.Algorithm); err != nil {
+			errs = append(errs, fmt.Errorf("%w of the token %q", err, token))
+		}
+	}
+	names := make(map[string]bool)
+	for _, routeRule := range cfg.RouteRules {
+		if routeRule.Name == "" {
+			errs = append(errs, fmt.Errorf("the route rule of the pattern %q has no name", routeRule.Pattern))
+		} else if names[routeRule.Name] {
+			errs = append(errs, fmt.Errorf("duplicate route rule %q", routeRule.Name))
+		}
+		names[routeRule.Name] = true
+		if !strings.HasPrefix(routeRule.Pattern, "/") {
+			errs = append(errs, fmt.Errorf("the pattern %q of the route rule %q must start with /", routeRule.Pattern, routeRule.Name))
+		}
+		for _, segment := range strings.Split(routeRule.Pattern, "/") {
+			if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+				continue
+			}
+			if _, expr, found := strings.Cut(segment[1:len(segment)-1], ":"); found {
+				if _, err := regexp.Compile(expr); err != nil {
+					errs = append(errs, fmt.Errorf("invalid pattern %q of the route rule %q: %w", routeRule.Pattern, routeRule.Name, err))
+				}
+			}
+		}
+		if err := checkAlgorithm(cfg.StoreStrategy, routeRule.Algorithm); err != nil {
+			errs = append(errs, fmt.Errorf("%w of the route rule %q", err, routeRule.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkAlgorithm checks that the algorithm is known and implemented by the store strategy, an
+// empty one meaning the default
+func checkAlgorithm(storeStrategy string, algorithm string) error {
+	if !isAlgorithm(algorithm) {
+		return fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+	if algorithm == "" || algorithm == store.FixedWindowAlgorithm {
+		return nil
+	}
+	switch storeStrategy {
+	case store.SQLStoreStrategy:
+		return fmt.Errorf("the %s store strategy doesn't implement the algorithm %q", storeStrategy, algorithm)
+	case store.GossipStoreStrategy:
+		if algorithm != store.SlidingWindowCounterAlgorithm {
+			return fmt.Errorf("the %s store strategy doesn't implement the algorithm %q", storeStrategy, algorithm)
+		}
+	}
+	return nil
+}
+
+// isAlgorithm reports whether the algorithm is known, an empty one meaning the default
+func isAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case "", store.FixedWindowAlgorithm, store.TokenBucketAlgorithm, store.SlidingWindowLogAlgorithm,
+		store.SlidingWindowCounterAlgorithm, store.GCRAAlgorithm, store.LeakyBucketAlgorithm:
+		return true
+	}
+	return false
+}
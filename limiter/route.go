@@ -0,0 +1,155 @@
+package limiter
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/store"
+)
+
+// Route describes the request matched against the route rules
+type Route struct {
+	// HTTP method of the request
+	Method string
+	// URL path of the request
+	Path string
+	// chi route pattern the request was routed to, when it's known
+	Pattern string
+	// Headers of the request
+	Header http.Header
+}
+
+// DecideRoute works like Decide, but applies the first route rule matching the route instead of the
+// IP address and token configuration. The counters of every route rule are kept apart, and the
+// requests matching an unlimited rule are always allowed without being counted.
+func (rl *RateLimiter) DecideRoute(ip string, token string, route Route) Decision {
+	return rl.DecideRouteContext(context.Background(), ip, token, route)
+}
+
+// DecideRouteContext works like DecideRoute, the context bounding the calls to the stores, see
+// DecideContext
+func (rl *RateLimiter) DecideRouteContext(ctx context.Context, ip string, token string, route Route) Decision {
+	cfg := rl.Config()
+	routeRule := matchRoute(cfg, route)
+	if routeRule == nil {
+		return rl.decide(ctx, ip, token, tokenRule(cfg, token))
+	}
+	if routeRule.Unlimited {
+		return Decision{Allowed: true, Rule: routeRule.Name, Unlimited: true}
+	}
+	return rl.decide(ctx, ip, routeToken(routeRule), newRouteRule(cfg, routeRule))
+}
+
+// routeTokenPrefix prefixes the token of the stores of the route rules, whose control character
+// can't be sent in an HTTP header, so they're kept apart from the stores of the requests' tokens
+const routeTokenPrefix = "\x1froute:"
+
+// routeToken returns the token of the ip's store for a route rule, the ip being its key as is
+func routeToken(routeRule *config.RouteRule) string {
+	return routeTokenPrefix + routeRule.Name
+}
+
+// newRouteRule returns the rule applying the limits of a route rule
+func newRouteRule(cfg *config.RateLimiterConfig, routeRule *config.RouteRule) rule {
+	r := rule{
+		name:      routeRule.Name,
+		algorithm: routeRule.Algorithm,
+		config: &store.StoreConfig{
+			MaxRequests:      routeRule.MaxRequests,
+			LimitInSeconds:   routeRule.LimitInSeconds,
+			BlockInSeconds:   routeRule.BlockInSeconds,
+			MaxWaitInSeconds: cfg.LeakyBucketMaxWaitInSeconds,
+		},
+	}
+	if r.algorithm == "" {
+		r.algorithm = cfg.Algorithm
+	}
+	return r
+}
+
+// matchRoute returns the first route rule matching the route. A rule matches the chi route pattern
+// as is, or the path when the pattern isn't known (e.g.: the middleware isn't used with chi).
+func matchRoute(cfg *config.RateLimiterConfig, route Route) *config.RouteRule {
+	for _, routeRule := range cfg.RouteRules {
+		if len(routeRule.Methods) > 0 && !containsFold(routeRule.Methods, route.Method) {
+			continue
+		}
+		if !matchHeaders(routeRule.Headers, route.Header) {
+			continue
+		}
+		if route.Pattern != "" && route.Pattern == routeRule.Pattern {
+			return routeRule
+		}
+		if matchPattern(routeRule.Pattern, route.Path) {
+			return routeRule
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHeaders(expected map[string]string, header http.Header) bool {
+	for name, value := range expected {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPattern reports whether a path matches a chi route pattern: {name} matches a segment,
+// {name:regexp} a segment matching the regular expression, and a trailing * the rest of the path
+func matchPattern(pattern string, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range patternSegments {
+		if segment == "*" && i == len(patternSegments)-1 {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			_, expr, found := strings.Cut(segment[1:len(segment)-1], ":")
+			if found && !segmentRegexp(expr).MatchString(pathSegments[i]) {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
+
+var segmentRegexps sync.Map
+
+// segmentRegexp compiles the regular expression of a pattern segment once, anchoring it to
+// the whole segment. Invalid expressions never match.
+func segmentRegexp(expr string) *regexp.Regexp {
+	if re, ok := segmentRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		re = regexp.MustCompile(`[^\s\S]`)
+	}
+	segmentRegexps.Store(expr, re)
+	return re
+}
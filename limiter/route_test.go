@@ -0,0 +1,29 @@
+package limiter
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/", "/", true},
+		{"/login", "/login", true},
+		{"/login", "/login/", true},
+		{"/login", "/logout", false},
+		{"/users/{id}", "/users/42", true},
+		{"/users/{id}", "/users", false},
+		{"/users/{id}", "/users/42/posts", false},
+		{"/users/{id:[0-9]+}", "/users/42", true},
+		{"/users/{id:[0-9]+}", "/users/abc", false},
+		{"/api/*", "/api", true},
+		{"/api/*", "/api/users/42", true},
+		{"/api/*", "/apis", false},
+	}
+	for _, c := range cases {
+		if matchPattern(c.pattern, c.path) != c.expected {
+			t.Errorf("matchPattern(%q, %q) returned %t, expected %t", c.pattern, c.path, !c.expected, c.expected)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package limiter
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/log"
+	"github.com/eliasfeijo/go-rate-limiter/store"
+)
+
+// SaveSnapshot saves the state of the stores implementing store.SnapshotStore (i.e.: the in-memory
+// ones) to a snapshot file, skipping the expired ones, and returns how many were saved
+func (rl *RateLimiter) SaveSnapshot(path string) (int, error) {
+	cfg := rl.Config()
+	now := time.Now()
+	var entries []store.SnapshotEntry
+	var errs []error
+	rl.Store.RangeLocked(func(ip string, token string, s store.Store) bool {
+		snapshotStore, ok := s.(store.SnapshotStore)
+		if !ok {
+			return true
+		}
+		if s, ok := s.(store.ExpiringStore); ok && s.Expired(now) {
+			return true
+		}
+		rule, ok := keyRule(cfg, ip, token)
+		if !ok {
+			return true
+		}
+		state, err := snapshotStore.MarshalState()
+		if err != nil {
+			errs = append(errs, err)
+			return true
+		}
+		entries = append(entries, store.SnapshotEntry{IP: ip, Token: token, Algorithm: algorithmName(rule.algorithm), State: state})
+		return true
+	})
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+	return len(entries), store.SaveSnapshot(path, entries)
+}
+
+// RestoreSnapshot restores the stores saved in a snapshot file, replacing the existing ones, and
+// returns how many were restored. The stores whose rule doesn't exist anymore, or whose algorithm
+// changed, aren't restored.
+func (rl *RateLimiter) RestoreSnapshot(path string) (int, error) {
+	entries, err := store.LoadSnapshot(path)
+	if err != nil {
+		return 0, err
+	}
+	cfg := rl.Config()
+	restored := 0
+	for _, entry := range entries {
+		rule, ok := keyRule(cfg, entry.IP, entry.Token)
+		if !ok || algorithmName(rule.algorithm) != entry.Algorithm {
+			continue
+		}
+		s, ok := rl.createStore(entry.IP, entry.Token, rule).(store.SnapshotStore)
+		if !ok {
+			continue
+		}
+		if err := s.RestoreState(entry.State); err != nil {
+			log.Logf(log.Warn, "Error restoring the store of %s: %s", entry.IP, err)
+			continue
+		}
+		rl.Store.Set(entry.IP, entry.Token, s)
+		restored++
+	}
+	return restored, nil
+}
+
+// algorithmName returns the name of an algorithm, which is fixed_window when it isn't set
+func algorithmName(algorithm string) string {
+	if algorithm == "" {
+		return store.FixedWindowAlgorithm
+	}
+	return algorithm
+}
+
+// startSnapshots restores the snapshot file of the configuration, and saves it every snapshot
+// interval until the RateLimiter is closed
+func (rl *RateLimiter) startSnapshots(cfg *config.RateLimiterConfig) {
+	path := cfg.SnapshotFile
+	rl.snapshotFile = path
+	if restored, err := rl.RestoreSnapshot(path); err == nil {
+		log.Logf(log.Info, "Restored %d stores from the snapshot %s", restored, path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		// A corrupt snapshot is ignored, and replaced by the next one
+		log.Logf(log.Error, "Error restoring the snapshot %s: %s", path, err)
+	}
+
+	rl.snapshotStop, rl.snapshotDone = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(rl.snapshotDone)
+		if cfg.SnapshotIntervalInSeconds == 0 {
+			<-rl.snapshotStop
+			return
+		}
+		ticker := time.NewTicker(time.Duration(cfg.SnapshotIntervalInSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rl.snapshotStop:
+				return
+			case <-ticker.C:
+				if _, err := rl.SaveSnapshot(path); err != nil {
+					log.Logf(log.Error, "Error saving the snapshot %s: %s", path, err)
+				}
+			}
+		}
+	}()
+}
+
+// stopSnapshots stops saving the snapshot file every interval, and saves it a last time
+func (rl *RateLimiter) stopSnapshots() error {
+	close(rl.snapshotStop)
+	<-rl.snapshotDone
+	rl.snapshotStop = nil
+	_, err := rl.SaveSnapshot(rl.snapshotFile)
+	return err
+}
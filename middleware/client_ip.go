@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/eliasfeijo/go-rate-limiter/log"
+)
+
+// The headers the client IP address can be read from when the request comes from a trusted proxy
+const (
+	XForwardedForHeader  = "X-Forwarded-For"
+	XRealIPHeader        = "X-Real-IP"
+	ForwardedHeader      = "Forwarded"
+	CFConnectingIPHeader = "CF-Connecting-IP"
+)
+
+// clientIPResolver extracts the client IP address of a request. The headers set by proxies are
+// only read when the request comes from a trusted one, as anyone else can spoof them.
+type clientIPResolver struct {
+	trustedProxies []netip.Prefix
+	headers        []string
+}
+
+// newClientIPResolver parses the trusted proxies, given as CIDRs or single IP addresses, skipping
+// (and so not trusting) the invalid ones
+func newClientIPResolver(trustedProxies []string, headers []string) *clientIPResolver {
+	resolver := &clientIPResolver{}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				log.Logf(log.Error, "Invalid trusted proxy %q: %s", proxy, err)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		resolver.trustedProxies = append(resolver.trustedProxies, prefix.Masked())
+	}
+	for _, header := range headers {
+		if header = strings.TrimSpace(header); header != "" {
+			resolver.headers = append(resolver.headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return resolver
+}
+
+func (c *clientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the request's client. When the request comes from a trusted
+// proxy, the headers are tried in order and the first one holding a valid address wins. Otherwise,
+// or when none of them does, the address of the connection's peer is returned.
+func (c *clientIPResolver) clientIP(r *http.Request) string {
+	remoteAddr := strings.TrimSpace(r.RemoteAddr)
+	remote, ok := parseIP(remoteAddr)
+	if !ok {
+		host, _, _ := net.SplitHostPort(remoteAddr)
+		return host
+	}
+	if !c.isTrusted(remote) {
+		return remote.String()
+	}
+	for _, header := range c.headers {
+		var addr netip.Addr
+		switch header {
+		case XForwardedForHeader:
+			addr, ok = c.rightmostUntrusted(splitList(r.Header.Values(header)))
+		case ForwardedHeader:
+			addr, ok = c.rightmostUntrusted(forwardedFor(r.Header.Values(header)))
+		default:
+			addr, ok = parseIP(r.Header.Get(header))
+		}
+		if ok {
+			return addr.String()
+		}
+	}
+	return remote.String()
+}
+
+// rightmostUntrusted walks a proxy chain backwards, from the address closest to us, skipping the
+// trusted proxies. The first untrusted address is the client, as any address before it may have
+// been forged by the client itself. The walk stops at the first invalid address, since the chain
+// can't be trusted past it.
+func (c *clientIPResolver) rightmostUntrusted(chain []string) (netip.Addr, bool) {
+	var leftmost netip.Addr
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseIP(chain[i])
+		if !ok {
+			return netip.Addr{}, false
+		}
+		if !c.isTrusted(addr) {
+			return addr, true
+		}
+		leftmost = addr
+	}
+	// Every address belongs to a trusted proxy, so the first one made the request
+	return leftmost, leftmost.IsValid()
+}
+
+// splitList splits the comma separated values of a header
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			list = append(list, strings.TrimSpace(element))
+		}
+	}
+	return list
+}
+
+// forwardedFor returns the "for" parameter of every element of RFC 7239 Forwarded headers, e.g.:
+// for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711". Elements without one
+// are returned as empty strings, so they break the chain.
+func forwardedFor(values []string) []string {
+	var list []string
+	for _, element := range splitList(values) {
+		forValue := ""
+		for _, pair := range strings.Split(element, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && strings.EqualFold(name, "for") {
+				forValue = strings.Trim(value, `"`)
+			}
+		}
+		list = append(list, forValue)
+	}
+	return list
+}
+
+// parseIP parses an IP address with an optional port, IPv6 addresses being possibly enclosed in
+// brackets. IPv4-mapped IPv6 addresses are converted to IPv4 ones.
+func parseIP(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
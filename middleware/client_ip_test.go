@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver := newClientIPResolver(
+		[]string{"10.0.0.0/8", "192.168.1.10", "2001:db8::/32", "invalid"},
+		[]string{"X-Forwarded-For", "Forwarded", "x-real-ip"},
+	)
+	cases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		expected   string
+	}{
+		{"untrusted peer", "203.0.113.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}}, "203.0.113.1"},
+		{"trusted peer without headers", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"single proxy", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}}, "1.1.1.1"},
+		{"spoofed chain", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"6.6.6.6, 1.1.1.1, 10.0.0.2"}}, "1.1.1.1"},
+		{"multiple headers", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"6.6.6.6", "1.1.1.1, 192.168.1.10"}}, "1.1.1.1"},
+		{"only trusted proxies", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"invalid address stops the chain", "10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1, garbage"}, "X-Real-Ip": {"2.2.2.2"}}, "2.2.2.2"},
+		{"forwarded", "10.0.0.1:1234", map[string][]string{"Forwarded": {`for=6.6.6.6, for="[2001:db9::1]:4711";proto=https, for=10.0.0.2;by=10.0.0.1`}}, "2001:db9::1"},
+		{"forwarded obfuscated", "10.0.0.1:1234", map[string][]string{"Forwarded": {"for=_hidden"}}, "10.0.0.1"},
+		{"x-real-ip", "[2001:db8::1]:1234", map[string][]string{"X-Real-Ip": {"1.1.1.1"}}, "1.1.1.1"},
+		{"ipv4-mapped peer", "[::ffff:10.0.0.1]:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}}, "1.1.1.1"},
+		{"header not configured", "10.0.0.1:1234", map[string][]string{"Cf-Connecting-Ip": {"1.1.1.1"}}, "10.0.0.1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = c.remoteAddr
+			for header, values := range c.headers {
+				r.Header[header] = values
+			}
+			if ip := resolver.clientIP(r); ip != c.expected {
+				t.Errorf("clientIP() returned %s, expected %s", ip, c.expected)
+			}
+		})
+	}
+}
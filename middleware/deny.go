@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eliasfeijo/go-rate-limiter/limiter"
+)
+
+const denyMessage = "You have reached the maximum number of requests or actions allowed within a certain time frame"
+
+type decisionContextKey struct{}
+
+// DecisionFromContext returns the decision taken by the middleware for the request, which is
+// available to the deny handler and to the handlers of allowed requests
+func DecisionFromContext(ctx context.Context) (limiter.Decision, bool) {
+	decision, ok := ctx.Value(decisionContextKey{}).(limiter.Decision)
+	return decision, ok
+}
+
+// problem is an RFC 7807 problem details object, extended with the retry after and matched rule
+type problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail"`
+	RetryAfter int64  `json:"retryAfter"`
+	Rule       string `json:"rule,omitempty"`
+}
+
+// DefaultDenyHandler responds to denied requests with a 429 status code, and a problem+json body
+// when the client prefers JSON according to its Accept header, or a plain text one otherwise
+var DefaultDenyHandler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if !prefersJSON(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(denyMessage))
+		return
+	}
+	p := problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusTooManyRequests),
+		Status: http.StatusTooManyRequests,
+		Detail: denyMessage,
+	}
+	if decision, ok := DecisionFromContext(r.Context()); ok {
+		p.RetryAfter, _ = strconv.ParseInt(w.Header().Get("Retry-After"), 10, 64)
+		p.Rule = decision.Rule
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(p)
+})
+
+// prefersJSON reports whether the Accept header gives JSON a higher quality than plain text
+func prefersJSON(accept string) bool {
+	jsonQuality, textQuality := -1.0, -1.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/problem+json", "application/json":
+			jsonQuality = maxQuality(jsonQuality, quality)
+		case "text/plain", "text/*", "*/*":
+			textQuality = maxQuality(textQuality, quality)
+		}
+	}
+	return jsonQuality > 0 && jsonQuality > textQuality
+}
+
+func maxQuality(a float64, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
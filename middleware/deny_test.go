@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/go-chi/chi/v5"
+)
+
+func newDenyTestServer(t *testing.T, options ...Option) *httptest.Server {
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    1,
+		IpAddressLimitInSeconds: 60,
+		IpAddressBlockInSeconds: 30,
+		MapTokenConfig:          nil,
+		TokensHeaderKey:         "API_KEY",
+		StoreStrategy:           "in_memory",
+		Algorithm:               "gcra",
+		RedisConfig:             config.RedisConfig{},
+	}
+
+	middleware := NewRateLimitMiddleware(cfg, options...)
+
+	r := chi.NewRouter()
+	r.Use(middleware.Handler)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Request accepted"))
+	})
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func deniedRequest(t *testing.T, server *httptest.Server, accept string) *http.Response {
+	testRequest(t, server)
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != 429 {
+		t.Fatalf("Expected status code 429, got %d", resp.StatusCode)
+	}
+	return resp
+}
+
+func TestDefaultDenyHandler_ProblemJSON(t *testing.T) {
+	server := newDenyTestServer(t)
+	resp := deniedRequest(t, server, "application/json")
+
+	if resp.Header.Get("Content-Type") != "application/problem+json" {
+		t.Errorf("Expected a problem+json body, got %q", resp.Header.Get("Content-Type"))
+	}
+	var p problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != 429 || p.Title != "Too Many Requests" || p.RetryAfter != 60 || p.Rule != "ip_address" {
+		t.Errorf("Unexpected problem details: %+v", p)
+	}
+}
+
+func TestDefaultDenyHandler_PlainText(t *testing.T) {
+	server := newDenyTestServer(t)
+	resp := deniedRequest(t, server, "text/html,application/json;q=0.5,*/*;q=0.8")
+
+	if resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Expected a plain text body, got %q", resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestWithDenyHandler(t *testing.T) {
+	server := newDenyTestServer(t, WithDenyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, ok := DecisionFromContext(r.Context())
+		if !ok || decision.Allowed {
+			t.Error("Expected the denied decision to be in the request context")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})))
+
+	testRequest(t, server)
+	if resp, _ := testRequest(t, server); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the custom deny handler's status code, got %d", resp.StatusCode)
+	}
+}
+
+func TestWithDenyHandler_Nil(t *testing.T) {
+	// The default deny handler is kept, answering with 429
+	server := newDenyTestServer(t, WithDenyHandler(nil))
+	deniedRequest(t, server, "")
+}
+
+func TestPrefersJSON(t *testing.T) {
+	cases := map[string]bool{
+		"":                                   false,
+		"*/*":                                false,
+		"application/json":                   true,
+		"application/problem+json":           true,
+		"text/plain, application/json":       false,
+		"text/plain;q=0.5, application/json": true,
+		"application/json;q=0":               false,
+		"application/*":                      false,
+	}
+	for accept, expected := range cases {
+		if prefersJSON(accept) != expected {
+			t.Errorf("prefersJSON(%q) returned %t, expected %t", accept, !expected, expected)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/limiter"
+)
+
+// writeHeaders sets the rate limit headers of the decision on every response, unless the state of
+// the limit is unknown as no store answered (they'd claim the whole limit is left), and the
+// Retry-After header on denied ones. The IETF RateLimit-* headers carry the reset as the seconds
+// left until it, while the legacy X-RateLimit-* ones carry it as a Unix timestamp.
+func writeHeaders(h http.Header, decision limiter.Decision, legacy bool) {
+	if !decision.StateUnknown {
+		limit := strconv.FormatUint(uint64(decision.Limit), 10)
+		remaining := strconv.FormatUint(uint64(decision.Remaining), 10)
+		if legacy {
+			h.Set("X-RateLimit-Limit", limit)
+			h.Set("X-RateLimit-Remaining", remaining)
+			h.Set("X-RateLimit-Reset", strconv.FormatInt(decision.Reset.Unix(), 10))
+		} else {
+			h.Set("RateLimit-Limit", limit)
+			h.Set("RateLimit-Remaining", remaining)
+			h.Set("RateLimit-Reset", strconv.FormatInt(seconds(time.Until(decision.Reset)), 10))
+			h.Set("RateLimit-Policy", policy(decision))
+		}
+	}
+	if !decision.Allowed {
+		// Clients must wait at least a second, even when the store can't tell for how long
+		h.Set("Retry-After", strconv.FormatInt(int64(math.Max(1, float64(seconds(decision.RetryAfter)))), 10))
+	}
+}
+
+// policy formats the rule of the decision as a RateLimit-Policy structured field item,
+// e.g.: "ip_address";q=10;w=60
+func policy(decision limiter.Decision) string {
+	return strconv.Quote(decision.Rule) +
+		";q=" + strconv.FormatUint(uint64(decision.Limit), 10) +
+		";w=" + strconv.FormatInt(seconds(decision.Window), 10)
+}
+
+// seconds rounds d up to whole seconds, as the headers don't accept fractions
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
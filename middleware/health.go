@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthHandler responds with the health status of the rate limiter as JSON, with a 200 status
+// code when it's healthy, or a 503 one when its failure policy is being applied
+func (m *RateLimiterMiddleware) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := m.rateLimiter.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if health.Healthy {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
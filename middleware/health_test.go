@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/limiter"
+)
+
+func TestHealthHandler(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    1,
+		IpAddressLimitInSeconds: 60,
+		StoreStrategy:           "redis",
+		RedisConfig: config.RedisConfig{
+			Addresses:     []string{server.Addr()},
+			FailurePolicy: limiter.FailClosedPolicy,
+		},
+	}
+	middleware := NewRateLimitMiddleware(cfg)
+
+	recorder := httptest.NewRecorder()
+	middleware.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Health handler returned %d, expected 200", recorder.Code)
+	}
+
+	// Redis can't be reached on startup
+	server.Close()
+	middleware = NewRateLimitMiddleware(cfg)
+	recorder = httptest.NewRecorder()
+	middleware.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Health handler returned %d, expected 503", recorder.Code)
+	}
+	var health limiter.Health
+	if err := json.NewDecoder(recorder.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Healthy || health.FailurePolicy != limiter.FailClosedPolicy || health.Redis == nil || health.Redis.State != limiter.BreakerOpen || health.Redis.LastError == "" {
+		t.Errorf("Health handler returned %+v", health)
+	}
+}
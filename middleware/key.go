@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// KeyFunc extracts the key a request is limited by, reporting false when the request doesn't have
+// one, in which case it's limited by its client IP address instead. Keys of different sources are
+// prefixed by it (e.g.: "header:X-User-Id=42"), so they can't collide with each other.
+type KeyFunc func(r *http.Request) (string, bool)
+
+type clientIPContextKey struct{}
+
+// ClientIPFromContext returns the client IP address of the request, resolved by the middleware
+// before the key is extracted
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPContextKey{}).(string)
+	return ip, ok
+}
+
+// KeyByClientIP limits requests by their client IP address, which is the default
+func KeyByClientIP() KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		return ClientIPFromContext(r.Context())
+	}
+}
+
+// KeyByHeader limits requests by the value of a header
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		return prefixed("header:"+name, r.Header.Get(name))
+	}
+}
+
+// KeyByQuery limits requests by the value of a query parameter
+func KeyByQuery(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		return prefixed("query:"+name, r.URL.Query().Get(name))
+	}
+}
+
+// KeyByCookie limits requests by the value of a cookie
+func KeyByCookie(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return "", false
+		}
+		return prefixed("cookie:"+name, cookie.Value)
+	}
+}
+
+// KeyByPathParam limits requests by the value of a chi URL parameter. The parameters are only
+// known once the route is matched, so the middleware must be added to the route itself
+// (e.g.: r.With(m.Handler).Get("/users/{id}", ...)) rather than with r.Use.
+func KeyByPathParam(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		return prefixed("param:"+name, chi.URLParam(r, name))
+	}
+}
+
+// KeyByContext limits requests by a value of their context, such as the ID of the user set by an
+// authentication middleware
+func KeyByContext(key interface{}) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		value := r.Context().Value(key)
+		if value == nil {
+			return "", false
+		}
+		return prefixed(fmt.Sprintf("context:%v", key), fmt.Sprint(value))
+	}
+}
+
+// KeyByAll limits requests by the combination of several keys (e.g.: the user ID and the client IP
+// address), and only when all of them are found
+func KeyByAll(keyFuncs ...KeyFunc) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		keys := make([]string, 0, len(keyFuncs))
+		for _, keyFunc := range keyFuncs {
+			key, ok := keyFunc(r)
+			if !ok {
+				return "", false
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, "|"), len(keys) > 0
+	}
+}
+
+func prefixed(source string, value string) (string, bool) {
+	if value == "" {
+		return "", false
+	}
+	return source + "=" + value, true
+}
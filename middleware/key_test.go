@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/go-chi/chi/v5"
+)
+
+type userIDContextKey struct{}
+
+func TestKeyFuncs(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?api_key=abc", nil)
+	r.Header.Set("X-User-Id", "42")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	r = r.WithContext(context.WithValue(r.Context(), userIDContextKey{}, 7))
+	r = r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, "1.1.1.1"))
+
+	cases := []struct {
+		name     string
+		keyFunc  KeyFunc
+		expected string
+		ok       bool
+	}{
+		{"client ip", KeyByClientIP(), "1.1.1.1", true},
+		{"header", KeyByHeader("X-User-Id"), "header:X-User-Id=42", true},
+		{"missing header", KeyByHeader("X-Other"), "", false},
+		{"query", KeyByQuery("api_key"), "query:api_key=abc", true},
+		{"cookie", KeyByCookie("session"), "cookie:session=s1", true},
+		{"missing cookie", KeyByCookie("other"), "", false},
+		{"context", KeyByContext(userIDContextKey{}), "context:{}=7", true},
+		{"all", KeyByAll(KeyByHeader("X-User-Id"), KeyByClientIP()), "header:X-User-Id=42|1.1.1.1", true},
+		{"all with a missing key", KeyByAll(KeyByHeader("X-User-Id"), KeyByHeader("X-Other")), "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, ok := c.keyFunc(r)
+			if key != c.expected || ok != c.ok {
+				t.Errorf("KeyFunc returned (%q, %t), expected (%q, %t)", key, ok, c.expected, c.ok)
+			}
+		})
+	}
+}
+
+func TestRateLimiterMiddleware_ServeHTTP_KeyFunc(t *testing.T) {
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    1,
+		IpAddressLimitInSeconds: 60,
+		IpAddressBlockInSeconds: 0,
+		MapTokenConfig:          nil,
+		TokensHeaderKey:         "API_KEY",
+		StoreStrategy:           "in_memory",
+		Algorithm:               "gcra",
+		RedisConfig:             config.RedisConfig{},
+	}
+
+	middleware := NewRateLimitMiddleware(cfg, WithKeyFunc(KeyByPathParam("id")))
+
+	r := chi.NewRouter()
+	r.With(middleware.Handler).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+	// Every user has its own limit, even though the requests come from the same IP address
+	if status("/users/1") != 200 || status("/users/2") != 200 {
+		t.Error("Expected the first request of every user to be accepted")
+	}
+	if status("/users/1") != 429 {
+		t.Error("Expected the second request of the same user to be limited")
+	}
+	stored, ok := middleware.rateLimiter.Store.Get("param:id=2", "")
+	if !ok || stored == nil {
+		t.Error("Expected the store to be keyed by the extracted key")
+	}
+}
@@ -1,30 +1,66 @@
 package middleware
 
 import (
-	"net"
+	"context"
 	"net/http"
-	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/eliasfeijo/go-rate-limiter/config"
 	"github.com/eliasfeijo/go-rate-limiter/limiter"
-	"github.com/eliasfeijo/go-rate-limiter/store"
 )
 
 type RateLimiterMiddleware struct {
-	store       store.IpStore
-	handler     http.Handler
-	rateLimiter *limiter.RateLimiter
+	handler        http.Handler
+	rateLimiter    *limiter.RateLimiter
+	limiterOptions []limiter.Option
+	denyHandler    http.Handler
+	clientIP       atomic.Pointer[configuredClientIPResolver]
+	keyFunc        KeyFunc
 }
 
-func NewRateLimitMiddleware(config *config.RateLimiterConfig) *RateLimiterMiddleware {
-	if config.StoreStrategy == store.RedisStoreStrategy {
-		store.CreateRedisClient()
-	}
-	return &RateLimiterMiddleware{
-		store:       make(store.IpStore),
+// configuredClientIPResolver is the client IP resolver of a configuration
+type configuredClientIPResolver struct {
+	config   *config.RateLimiterConfig
+	resolver *clientIPResolver
+}
+
+// NewRateLimitMiddleware creates a middleware with its own RateLimiter, see limiter.NewRateLimiter
+func NewRateLimitMiddleware(config *config.RateLimiterConfig, options ...Option) *RateLimiterMiddleware {
+	m := &RateLimiterMiddleware{
 		handler:     http.DefaultServeMux,
-		rateLimiter: limiter.NewRateLimiter(config, make(store.IpStore), nil),
+		denyHandler: DefaultDenyHandler,
+		keyFunc:     KeyByClientIP(),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	m.rateLimiter = limiter.NewRateLimiter(config, m.limiterOptions...)
+	m.clientIPResolver(config)
+	return m
+}
+
+// Reload replaces the configuration of the rate limiter, see limiter.RateLimiter.Reload.
+// The store strategy and Redis configuration can't be changed without a restart.
+func (m *RateLimiterMiddleware) Reload(config *config.RateLimiterConfig) error {
+	return m.rateLimiter.Reload(config)
+}
+
+// Close releases the resources of the rate limiter, see limiter.RateLimiter.Close
+func (m *RateLimiterMiddleware) Close() error {
+	return m.rateLimiter.Close()
+}
+
+// clientIPResolver returns the client IP resolver of the configuration, creating it again when
+// the configuration was reloaded
+func (m *RateLimiterMiddleware) clientIPResolver(config *config.RateLimiterConfig) *clientIPResolver {
+	current := m.clientIP.Load()
+	if current != nil && current.config == config {
+		return current.resolver
 	}
+	resolver := newClientIPResolver(config.TrustedProxies, config.ClientIPHeaders)
+	m.clientIP.Store(&configuredClientIPResolver{config, resolver})
+	return resolver
 }
 
 func (m *RateLimiterMiddleware) Handler(next http.Handler) http.Handler {
@@ -35,17 +71,36 @@ func (m *RateLimiterMiddleware) Handler(next http.Handler) http.Handler {
 }
 
 func (m *RateLimiterMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ip, _, _ := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
-	token := r.Header.Get(m.rateLimiter.Config.TokensHeaderKey)
-	if m.rateLimiter.Limit(ip, token) {
-		cancelRequest(w)
+	config := m.rateLimiter.Config()
+	ip := m.clientIPResolver(config).clientIP(r)
+	r = r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip))
+	key, ok := m.keyFunc(r)
+	if !ok {
+		key = ip
+	}
+	token := r.Header.Get(config.TokensHeaderKey)
+	decision := m.rateLimiter.DecideRouteContext(r.Context(), key, token, route(r))
+	if !decision.Unlimited {
+		writeHeaders(w.Header(), decision, config.LegacyHeaders)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), decisionContextKey{}, decision))
+	if !decision.Allowed {
+		m.denyHandler.ServeHTTP(w, r)
 		return
 	}
+	if decision.Delay > 0 {
+		// Hold the request back until it's released, unless the request is canceled first (e.g.:
+		// the client gave up). Its slot in the queue is taken on purpose even then, so clients
+		// can't queue more requests by canceling them, and it's answered as unavailable in case
+		// the response still reaches someone (e.g.: the request timed out on the server).
+		timer := time.NewTimer(decision.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+	}
 	m.handler.ServeHTTP(w, r)
 }
-
-func cancelRequest(w http.ResponseWriter) {
-	w.WriteHeader(http.StatusTooManyRequests)
-	w.Write([]byte("You have reached the maximum number of requests or actions allowed within a certain time frame"))
-	return
-}
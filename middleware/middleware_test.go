@@ -1,12 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/limiter"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -95,3 +102,254 @@ func TestRateLimiterMiddleware_ServeHTTP_TooManyRequests(t *testing.T) {
 		t.Fatalf("Expected status code 429, got %d", resp.StatusCode)
 	}
 }
+
+func TestRateLimiterMiddleware_ServeHTTP_LeakyBucket(t *testing.T) {
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    2,
+		IpAddressLimitInSeconds: 1,
+		IpAddressBlockInSeconds: 0,
+		MapTokenConfig:          nil,
+		TokensHeaderKey:         "API_KEY",
+		StoreStrategy:           "in_memory",
+		Algorithm:               "leaky_bucket",
+		RedisConfig:             config.RedisConfig{},
+	}
+
+	// Create a new instance of the RateLimiterMiddleware
+	middleware := NewRateLimitMiddleware(cfg)
+
+	r := chi.NewRouter()
+	r.Use(middleware.Handler)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Request accepted"))
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// The queue holds two requests released half a second apart, so the third one is rejected
+	start := time.Now()
+	if resp, _ := testRequest(t, server); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+	statusCodes := make(chan int, 2)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := testRequest(t, server)
+			statusCodes <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statusCodes)
+
+	accepted, rejected := 1, 0
+	for statusCode := range statusCodes {
+		switch statusCode {
+		case http.StatusOK:
+			accepted++
+		case http.StatusTooManyRequests:
+			rejected++
+		}
+	}
+	if accepted != 2 || rejected != 1 {
+		t.Fatalf("Expected 2 accepted and 1 rejected requests, got %d and %d", accepted, rejected)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("Expected the second request to be held back for 500ms, took %s", elapsed)
+	}
+}
+
+func TestRateLimiterMiddleware_ServeHTTP_LeakyBucketCanceled(t *testing.T) {
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    2,
+		IpAddressLimitInSeconds: 10,
+		IpAddressBlockInSeconds: 0,
+		TokensHeaderKey:         "API_KEY",
+		StoreStrategy:           "in_memory",
+		Algorithm:               "leaky_bucket",
+	}
+	middleware := NewRateLimitMiddleware(cfg)
+	handled := 0
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+	}))
+	serve := func(ctx context.Context) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		return recorder.Code
+	}
+	if statusCode := serve(context.Background()); statusCode != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %d", statusCode)
+	}
+
+	// The request canceled while it's held back is answered without being handled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if statusCode := serve(ctx); statusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code 503 for the canceled request, got %d", statusCode)
+	}
+	if handled != 1 {
+		t.Errorf("Expected the canceled request not to be handled, %d requests were", handled)
+	}
+
+	// Its slot in the queue is still taken
+	if statusCode := serve(context.Background()); statusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status code 429 with the queue full, got %d", statusCode)
+	}
+}
+
+func TestRateLimiterMiddleware_ServeHTTP_Headers(t *testing.T) {
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    2,
+		IpAddressLimitInSeconds: 60,
+		IpAddressBlockInSeconds: 30,
+		MapTokenConfig:          nil,
+		TokensHeaderKey:         "API_KEY",
+		StoreStrategy:           "in_memory",
+		Algorithm:               "sliding_window_log",
+		RedisConfig:             config.RedisConfig{},
+	}
+
+	middleware := NewRateLimitMiddleware(cfg)
+
+	r := chi.NewRouter()
+	r.Use(middleware.Handler)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Request accepted"))
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, _ := testRequest(t, server)
+	expected := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    `"ip_address";q=2;w=60`,
+		"Retry-After":         "",
+	}
+	for header, value := range expected {
+		if resp.Header.Get(header) != value {
+			t.Errorf("Expected the %s header to be %q, got %q", header, value, resp.Header.Get(header))
+		}
+	}
+
+	testRequest(t, server)
+	resp, _ = testRequest(t, server)
+	if resp.StatusCode != 429 {
+		t.Fatalf("Expected status code 429, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected no remaining requests, got %q", resp.Header.Get("RateLimit-Remaining"))
+	}
+	// The oldest request leaves the window before the block is lifted
+	if resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("Expected the Retry-After header to be 60, got %q", resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestRateLimiterMiddleware_ServeHTTP_LegacyHeaders(t *testing.T) {
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    1,
+		IpAddressLimitInSeconds: 60,
+		IpAddressBlockInSeconds: 30,
+		MapTokenConfig:          nil,
+		TokensHeaderKey:         "API_KEY",
+		StoreStrategy:           "in_memory",
+		Algorithm:               "gcra",
+		LegacyHeaders:           true,
+		RedisConfig:             config.RedisConfig{},
+	}
+
+	middleware := NewRateLimitMiddleware(cfg)
+
+	r := chi.NewRouter()
+	r.Use(middleware.Handler)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Request accepted"))
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, _ := testRequest(t, server)
+	if resp.Header.Get("X-RateLimit-Limit") != "1" || resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected legacy headers: %v", resp.Header)
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < time.Now().Add(59*time.Second).Unix() || reset > time.Now().Add(61*time.Second).Unix() {
+		t.Errorf("Expected the X-RateLimit-Reset header to be a Unix timestamp a minute from now, got %q", resp.Header.Get("X-RateLimit-Reset"))
+	}
+	if resp.Header.Get("RateLimit-Limit") != "" || resp.Header.Get("RateLimit-Policy") != "" {
+		t.Error("Expected the IETF headers not to be sent along with the legacy ones")
+	}
+
+	resp, _ = testRequest(t, server)
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("Expected status code 429 with a Retry-After of 60, got %d with %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestRateLimiterMiddleware_ServeHTTP_RequestContext(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    3,
+		IpAddressLimitInSeconds: 60,
+		StoreStrategy:           "redis",
+		RedisConfig: config.RedisConfig{
+			Addresses:     []string{server.Addr()},
+			FailurePolicy: limiter.FailClosedPolicy,
+		},
+	}
+	var storeErr error
+	middleware := NewRateLimitMiddleware(cfg, WithLimiterOptions(limiter.WithErrorHandler(func(ctx context.Context, ip string, token string, err error) {
+		storeErr = err
+	})))
+
+	// The store is called with the context of the request, which the client already gave up on
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if !errors.Is(storeErr, context.Canceled) {
+		t.Errorf("Store returned %v, expected the request's context to be canceled", storeErr)
+	}
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("Canceled request returned %d, expected the failure policy to deny it", recorder.Code)
+	}
+}
+
+func TestRateLimiterMiddleware_ServeHTTP_DegradedHeaders(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    3,
+		IpAddressLimitInSeconds: 60,
+		StoreStrategy:           "redis",
+		RedisConfig: config.RedisConfig{
+			Addresses:     []string{server.Addr()},
+			FailurePolicy: limiter.FailOpenPolicy,
+		},
+	}
+	middleware := NewRateLimitMiddleware(cfg, WithLimiterOptions(limiter.WithErrorHandler(func(ctx context.Context, ip string, token string, err error) {})))
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	// The requests allowed while Redis is unavailable don't claim the whole limit is left
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected the fail_open policy to allow the request, got %d", recorder.Code)
+	}
+	for _, header := range []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"} {
+		if value := recorder.Header().Get(header); value != "" {
+			t.Errorf("Expected no %s header for a degraded decision, got %q", header, value)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/eliasfeijo/go-rate-limiter/limiter"
+	"github.com/redis/go-redis/v9"
+)
+
+// Option configures a RateLimiterMiddleware
+type Option func(m *RateLimiterMiddleware)
+
+// WithDenyHandler sets the handler responding to denied requests instead of DefaultDenyHandler,
+// which is kept when handler is nil. The rate limit headers are already set when it's called, and
+// the decision is available through DecisionFromContext.
+func WithDenyHandler(handler http.Handler) Option {
+	return func(m *RateLimiterMiddleware) {
+		if handler != nil {
+			m.denyHandler = handler
+		}
+	}
+}
+
+// WithKeyFunc sets the function extracting the key requests are limited by, instead of their
+// client IP address. Requests are still limited by their token's configuration when they have one.
+func WithKeyFunc(keyFunc KeyFunc) Option {
+	return func(m *RateLimiterMiddleware) {
+		m.keyFunc = keyFunc
+	}
+}
+
+// WithLimiterOptions sets the options of the middleware's RateLimiter
+func WithLimiterOptions(options ...limiter.Option) Option {
+	return func(m *RateLimiterMiddleware) {
+		m.limiterOptions = append(m.limiterOptions, options...)
+	}
+}
+
+// WithRedisClient sets the client used by the redis store strategy, see limiter.WithRedisClient
+func WithRedisClient(client redis.UniversalClient) Option {
+	return WithLimiterOptions(limiter.WithRedisClient(client))
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/eliasfeijo/go-rate-limiter/limiter"
+	"github.com/go-chi/chi/v5"
+)
+
+// route describes the request for the route rules, including the chi route pattern it's routed to
+func route(r *http.Request) limiter.Route {
+	return limiter.Route{Method: r.Method, Path: r.URL.Path, Pattern: routePattern(r), Header: r.Header}
+}
+
+// routePattern returns the chi route pattern of the request, or an empty string when the request
+// isn't handled by chi or doesn't match a route. When the middleware is added to the route itself
+// the request is already routed, otherwise the route is matched ahead of chi by the root router
+// (which is the one kept in the routing context, even within subrouters).
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+	patterns := rctx.RoutePatterns
+	if len(patterns) > 0 && !strings.HasSuffix(patterns[len(patterns)-1], "/*") {
+		return rctx.RoutePattern()
+	}
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	tctx := chi.NewRouteContext()
+	if !rctx.Routes.Match(tctx, r.Method, path) {
+		return ""
+	}
+	return tctx.RoutePattern()
+}
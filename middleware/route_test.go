@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRateLimiterMiddleware_ServeHTTP_RouteRules(t *testing.T) {
+	cfg := &config.RateLimiterConfig{
+		IpAddressMaxRequests:    2,
+		IpAddressLimitInSeconds: 60,
+		IpAddressBlockInSeconds: 0,
+		MapTokenConfig:          nil,
+		TokensHeaderKey:         "API_KEY",
+		StoreStrategy:           "in_memory",
+		Algorithm:               "gcra",
+		RouteRules: config.RouteRules{
+			{Name: "login", Methods: []string{"POST"}, Pattern: "/login", MaxRequests: 1, LimitInSeconds: 60},
+			{Name: "health", Pattern: "/health", Unlimited: true},
+			{Name: "users", Methods: []string{"GET"}, Pattern: "/api/users/{id}", MaxRequests: 1, LimitInSeconds: 60},
+		},
+		RedisConfig: config.RedisConfig{},
+	}
+
+	middleware := NewRateLimitMiddleware(cfg)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	r := chi.NewRouter()
+	r.Use(middleware.Handler)
+	r.Post("/login", ok)
+	r.Get("/login", ok)
+	r.Get("/health", ok)
+	r.Route("/api", func(r chi.Router) {
+		r.Get("/users/{id}", ok)
+	})
+
+	request := func(method string, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := request("POST", "/login"); w.Code != 200 || w.Header().Get("RateLimit-Policy") != `"login";q=1;w=60` {
+		t.Errorf("Expected the first login to be accepted by the login rule, got %d with %q", w.Code, w.Header().Get("RateLimit-Policy"))
+	}
+	if w := request("POST", "/login"); w.Code != 429 {
+		t.Errorf("Expected the second login to be limited, got %d", w.Code)
+	}
+	// Other methods fall back to the IP address limit, which is counted apart
+	if w := request("GET", "/login"); w.Code != 200 || w.Header().Get("RateLimit-Policy") != `"ip_address";q=2;w=60` {
+		t.Errorf("Expected GET /login to be accepted by the IP address rule, got %d with %q", w.Code, w.Header().Get("RateLimit-Policy"))
+	}
+	for i := 0; i < 5; i++ {
+		if w := request("GET", "/health"); w.Code != 200 || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("Expected the health check to be unlimited, got %d with %v", w.Code, w.Header())
+		}
+	}
+	// The route pattern is matched, so every user shares the same limit
+	if w := request("GET", "/api/users/1"); w.Code != 200 {
+		t.Errorf("Expected the first user request to be accepted, got %d", w.Code)
+	}
+	if w := request("GET", "/api/users/2"); w.Code != 429 {
+		t.Errorf("Expected the second user request to be limited, got %d", w.Code)
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	var pattern string
+	capture := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pattern = routePattern(r)
+			next.ServeHTTP(w, r)
+		})
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	r := chi.NewRouter()
+	r.Use(capture)
+	r.Get("/users/{id}", ok)
+	r.Route("/api", func(r chi.Router) {
+		r.Use(capture)
+		r.Get("/items/{id}", ok)
+	})
+	r.With(capture).Get("/inline/{id}", ok)
+
+	cases := map[string]string{
+		"/users/1":     "/users/{id}",
+		"/api/items/2": "/api/items/{id}",
+		"/inline/3":    "/inline/{id}",
+		"/missing":     "",
+	}
+	for path, expected := range cases {
+		pattern = "unset"
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		if pattern != expected {
+			t.Errorf("routePattern() returned %q for %s, expected %q", pattern, path, expected)
+		}
+	}
+}
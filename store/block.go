@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// inMemoryBlock implements the blocking methods shared by the in-memory stores
+// that keep their block as a deadline
+type inMemoryBlock struct {
+	blockedUntil time.Time
+	// The clock of the store embedding the block, which it takes its decisions as of
+	clock Clock
+}
+
+func newInMemoryBlock(config *StoreConfig) inMemoryBlock {
+	return inMemoryBlock{clock: config.clock()}
+}
+
+func (b *inMemoryBlock) IsBlocked() bool {
+	return b.clock.Now().Before(b.blockedUntil)
+}
+
+func (b *inMemoryBlock) RemainingBlockTime() uint {
+	remaining := b.blockedUntil.Sub(b.clock.Now())
+	if remaining <= 0 {
+		return 0
+	}
+	return uint(math.Ceil(remaining.Seconds()))
+}
+
+func (b *inMemoryBlock) block(config *StoreConfig) {
+	b.blockedUntil = b.clock.Now().Add(time.Duration(config.BlockInSeconds) * time.Second)
+}
+
+func (b *inMemoryBlock) unblock() {
+	b.blockedUntil = time.Time{}
+}
+
+// blockState is the block of a SnapshotStore embedding the block
+type blockState struct {
+	BlockedUntil time.Time `json:"blockedUntil"`
+}
+
+func (b *inMemoryBlock) state() blockState {
+	return blockState{b.blockedUntil}
+}
+
+func (b *inMemoryBlock) restore(state blockState) {
+	b.blockedUntil = state.BlockedUntil
+}
+
+// expired reports whether the store embedding the block is neither blocked nor counting hits as of now
+func (b *inMemoryBlock) expired(s timedStore, now time.Time) bool {
+	resetAfter, _ := s.timing(now)
+	return resetAfter <= 0 && !now.Before(b.blockedUntil)
+}
+
+// timedStore is implemented by the in-memory stores embedding the block
+type timedStore interface {
+	Store
+	// timing returns the time left at now until no hits are counted against the limit anymore,
+	// and until a hit would be accepted again (regardless of the block)
+	timing(now time.Time) (resetAfter time.Duration, retryAfter time.Duration)
+}
+
+// decide takes the decision of a store embedding the block: hit counts a hit and reports
+// whether it's limited, in which case the key is blocked
+func (b *inMemoryBlock) decide(s timedStore, config *StoreConfig, hit func() bool) Result {
+	if b.IsBlocked() {
+		return b.result(s, true)
+	}
+	if hit() {
+		b.block(config)
+		return b.result(s, true)
+	}
+	return b.result(s, false)
+}
+
+func (b *inMemoryBlock) result(s timedStore, limited bool) Result {
+	now := b.clock.Now()
+	resetAfter, retryAfter := s.timing(now)
+	result := Result{
+		Limited:            limited,
+		Blocked:            b.IsBlocked(),
+		HitCount:           s.HitCount(),
+		RemainingBlockTime: b.RemainingBlockTime(),
+		ResetAfter:         positive(resetAfter),
+	}
+	if limited {
+		result.RetryAfter = positive(maxDuration(retryAfter, b.blockedUntil.Sub(now)))
+	}
+	return result
+}
+
+// redisBlock implements the blocking methods shared by the Redis stores
+// that keep their block as a key expiring after the block duration
+type redisBlock struct {
+	client redis.UniversalClient
+	key    string
+}
+
+func (b *redisBlock) IsBlocked() bool {
+	return logged(b.IsBlockedContext(context.Background()))
+}
+
+func (b *redisBlock) IsBlockedContext(ctx context.Context) (bool, error) {
+	exists, err := b.client.Exists(ctx, b.key).Result()
+	return exists == 1, err
+}
+
+func (b *redisBlock) RemainingBlockTime() uint {
+	return logged(b.RemainingBlockTimeContext(context.Background()))
+}
+
+func (b *redisBlock) RemainingBlockTimeContext(ctx context.Context) (uint, error) {
+	ttl, err := b.client.PTTL(ctx, b.key).Result()
+	if err != nil || ttl <= 0 {
+		return 0, err
+	}
+	return uint(math.Ceil(ttl.Seconds())), nil
+}
+
+func (b *redisBlock) block(ctx context.Context, config *StoreConfig) error {
+	if config.BlockInSeconds == 0 {
+		return nil
+	}
+	return b.client.Set(ctx, b.key, true, time.Duration(config.BlockInSeconds)*time.Second).Err()
+}
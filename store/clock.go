@@ -0,0 +1,22 @@
+package store
+
+import "time"
+
+// Clock tells the time to the stores, which take every decision as of its Now
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clock returns the Clock of the config, which is the system clock unless one is set
+func (c *StoreConfig) clock() Clock {
+	if c.Clock == nil {
+		return systemClock{}
+	}
+	return c.Clock
+}
@@ -0,0 +1,191 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/store"
+	"github.com/eliasfeijo/go-rate-limiter/store/storetest"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
+)
+
+// inMemoryStores are the constructors of the in-memory stores of every algorithm
+var inMemoryStores = map[string]func(config *store.StoreConfig) store.Store{
+	store.FixedWindowAlgorithm: func(config *store.StoreConfig) store.Store {
+		return store.NewInMemoryStore(config)
+	},
+	store.TokenBucketAlgorithm: func(config *store.StoreConfig) store.Store {
+		return store.NewInMemoryTokenBucketStore(config)
+	},
+	store.SlidingWindowLogAlgorithm: func(config *store.StoreConfig) store.Store {
+		return store.NewInMemorySlidingWindowLogStore(config)
+	},
+	store.SlidingWindowCounterAlgorithm: func(config *store.StoreConfig) store.Store {
+		return store.NewInMemorySlidingWindowCounterStore(config)
+	},
+	store.GCRAAlgorithm: func(config *store.StoreConfig) store.Store {
+		return store.NewInMemoryGCRAStore(config)
+	},
+	store.LeakyBucketAlgorithm: func(config *store.StoreConfig) store.Store {
+		return store.NewInMemoryLeakyBucketStore(config)
+	},
+}
+
+func TestConformance_InMemory(t *testing.T) {
+	for algorithm, newStore := range inMemoryStores {
+		newStore := newStore
+		t.Run(algorithm, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T, clock store.Clock) storetest.Backend {
+				return storetest.Backend{
+					NewStore: func(ip string, token string, config *store.StoreConfig) store.Store {
+						return newStore(config)
+					},
+					Queued: algorithm == store.LeakyBucketAlgorithm,
+				}
+			})
+		})
+	}
+}
+
+func TestConformance_Redis(t *testing.T) {
+	stores := map[string]func(client redis.UniversalClient, ip string, token string, config *store.StoreConfig) store.Store{
+		store.FixedWindowAlgorithm: func(client redis.UniversalClient, ip string, token string, config *store.StoreConfig) store.Store {
+			return store.NewRedisStore(client, ip, token, config)
+		},
+		store.TokenBucketAlgorithm: func(client redis.UniversalClient, ip string, token string, config *store.StoreConfig) store.Store {
+			return store.NewRedisTokenBucketStore(client, ip, token, config)
+		},
+		store.SlidingWindowLogAlgorithm: func(client redis.UniversalClient, ip string, token string, config *store.StoreConfig) store.Store {
+			return store.NewRedisSlidingWindowLogStore(client, ip, token, config)
+		},
+		store.SlidingWindowCounterAlgorithm: func(client redis.UniversalClient, ip string, token string, config *store.StoreConfig) store.Store {
+			return store.NewRedisSlidingWindowCounterStore(client, ip, token, config)
+		},
+		store.GCRAAlgorithm: func(client redis.UniversalClient, ip string, token string, config *store.StoreConfig) store.Store {
+			return store.NewRedisGCRAStore(client, ip, token, config)
+		},
+		store.LeakyBucketAlgorithm: func(client redis.UniversalClient, ip string, token string, config *store.StoreConfig) store.Store {
+			return store.NewRedisLeakyBucketStore(client, ip, token, config)
+		},
+	}
+	for algorithm, newStore := range stores {
+		newStore := newStore
+		t.Run(algorithm, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T, clock store.Clock) storetest.Backend {
+				server, client := newConformanceRedis(t)
+				return storetest.Backend{
+					NewStore: func(ip string, token string, config *store.StoreConfig) store.Store {
+						return newStore(client, ip, token, config)
+					},
+					Advance: server.FastForward,
+					Shared:  true,
+					Queued:  algorithm == store.LeakyBucketAlgorithm,
+				}
+			})
+		})
+	}
+}
+
+func TestConformance_SQL(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock store.Clock) storetest.Backend {
+		db, err := store.OpenSQLDatabase(config.SQLConfig{
+			Driver: "sqlite3",
+			DSN:    filepath.Join(t.TempDir(), "rate_limiter.db") + "?_busy_timeout=5000",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return storetest.Backend{
+			NewStore: func(ip string, token string, config *store.StoreConfig) store.Store {
+				return store.NewSQLStore(db, ip, token, config)
+			},
+			Shared: true,
+		}
+	})
+}
+
+func TestConformance_Hybrid(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock store.Clock) storetest.Backend {
+		server, client := newConformanceRedis(t)
+		return storetest.Backend{
+			NewStore: func(ip string, token string, config *store.StoreConfig) store.Store {
+				return store.NewHybridStore(client, ip, token, config, store.LeaseConfig{BatchSize: 2})
+			},
+			Advance: server.FastForward,
+		}
+	})
+}
+
+func TestConformance_Gossip(t *testing.T) {
+	for _, algorithm := range []string{store.FixedWindowAlgorithm, store.SlidingWindowCounterAlgorithm} {
+		algorithm := algorithm
+		t.Run(algorithm, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T, clock store.Clock) storetest.Backend {
+				node, err := store.NewGossipNode(config.GossipConfig{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { node.Close() })
+				node.SetClock(clock)
+				return storetest.Backend{
+					NewStore: func(ip string, token string, config *store.StoreConfig) store.Store {
+						return store.NewGossipStore(node, ip, token, algorithm, config)
+					},
+				}
+			})
+		})
+	}
+}
+
+func TestConformance_Remote(t *testing.T) {
+	for algorithm := range inMemoryStores {
+		algorithm := algorithm
+		t.Run(algorithm, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T, clock store.Clock) storetest.Backend {
+				node, err := store.NewRemoteNode(config.RemoteConfig{BindAddress: "127.0.0.1:0", Secret: "secret"}, func(algorithm string, config *store.StoreConfig) store.Store {
+					return inMemoryStores[algorithm](config)
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { node.Close() })
+				node.Stores().SetClock(clock)
+				// The owner limits every key with the config its store was created with
+				rules := sync.Map{}
+				node.SetRules(func(ip string, token string) (string, *store.StoreConfig, bool) {
+					config, ok := rules.Load(ip + ":" + token)
+					if !ok {
+						return "", nil, false
+					}
+					return algorithm, config.(*store.StoreConfig), true
+				})
+				return storetest.Backend{
+					NewStore: func(ip string, token string, config *store.StoreConfig) store.Store {
+						rules.Store(ip+":"+token, config)
+						return store.NewRemoteStore(node, ip, token)
+					},
+					Shared: true,
+					Queued: algorithm == store.LeakyBucketAlgorithm,
+				}
+			})
+		})
+	}
+}
+
+// newConformanceRedis starts an in-process Redis server with the scripts of the stores loaded.
+// Its keys expire on its own clock, which is advanced with the one of the stores.
+func newConformanceRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	if err := store.LoadScripts(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"math"
+	"time"
+)
+
+// GossipStore counts the hits of a key in the counters of a GossipNode, shared with the other
+// nodes without Redis. It implements the sliding window counter algorithm when it's configured,
+// weighting the counter of the previous window like InMemorySlidingWindowCounterStore, and the
+// fixed window algorithm otherwise, on windows aligned on the clock so all the nodes share them.
+// The block is local to the node: the other nodes limit the key once they receive its hits.
+type GossipStore struct {
+	inMemoryBlock
+	node    *GossipNode
+	config  *StoreConfig
+	key     string
+	sliding bool
+	lastHit time.Time
+	limited bool
+	// The counts of the windows as of the last refresh, which this node doesn't count anymore as
+	// the counters only grow
+	refreshed map[gossipKey]uint
+}
+
+func NewGossipStore(node *GossipNode, ip string, token string, algorithm string, config *StoreConfig) *GossipStore {
+	return &GossipStore{
+		inMemoryBlock: newInMemoryBlock(config),
+		node:          node,
+		config:        config,
+		key:           redisKey(ip, token),
+		sliding:       algorithm == SlidingWindowCounterAlgorithm,
+	}
+}
+
+func (s *GossipStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *GossipStore) Take() Result {
+	return s.decide(s, s.config, func() bool {
+		s.take()
+		return s.limited
+	})
+}
+
+func (s *GossipStore) ShouldLimit() bool {
+	return s.limited
+}
+
+// ShouldRefresh always returns false, as the windows are rolled over by the clock
+func (s *GossipStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh forgets the hits counted so far in the windows weighted by the store, unblocks it and
+// takes a hit. The hits are only forgotten by this node, as the other nodes already counted them.
+func (s *GossipStore) Refresh() {
+	s.refreshed = nil
+	key, current, previous, _ := s.counts(s.clock.Now())
+	s.refreshed = map[gossipKey]uint{key: current, s.previousKey(key): previous}
+	s.unblock()
+	s.take()
+}
+
+func (s *GossipStore) Expired(now time.Time) bool {
+	return s.expired(s, now)
+}
+
+func (s *GossipStore) Block() {
+	s.block(s.config)
+}
+
+func (s *GossipStore) Hit() {
+	s.take()
+}
+
+// LastHit returns the last hit taken by this node
+func (s *GossipStore) LastHit() time.Time {
+	return s.lastHit
+}
+
+// HitCount returns the (estimated) amount of hits taken by all the nodes within the window, as
+// known by this node
+func (s *GossipStore) HitCount() uint {
+	_, current, previous, elapsed := s.counts(s.clock.Now())
+	return uint(math.Ceil(slidingWindowEstimate(current, previous, elapsed)))
+}
+
+func (s *GossipStore) timing(now time.Time) (time.Duration, time.Duration) {
+	_, current, previous, elapsed := s.counts(now)
+	if s.sliding {
+		return slidingWindowTiming(current, previous, elapsed, s.config)
+	}
+	if s.config.MaxRequests == 0 {
+		return 0, s.config.Window()
+	}
+	if current == 0 {
+		return 0, 0
+	}
+	windowEnd := time.Duration((1 - elapsed) * float64(s.config.Window()))
+	if current < s.config.MaxRequests {
+		return windowEnd, 0
+	}
+	return windowEnd, windowEnd
+}
+
+// take counts a new hit in the current window, flagging the store as limited (without counting
+// the hit) when the estimated count reached MaxRequests
+func (s *GossipStore) take() {
+	now := s.clock.Now()
+	key, current, previous, elapsed := s.counts(now)
+	s.lastHit = now
+	if slidingWindowEstimate(current, previous, elapsed)+1 > float64(s.config.MaxRequests) {
+		s.limited = true
+		return
+	}
+	s.node.increment(key)
+	s.limited = false
+}
+
+// counts returns the counter of the window containing now, the counts of this window and the
+// previous one (which is only weighted by the sliding window counter), and the fraction of the
+// window that has already elapsed
+func (s *GossipStore) counts(now time.Time) (gossipKey, uint, uint, float64) {
+	window := s.config.Window()
+	index, elapsed := slidingWindow(now, window)
+	length := window.Milliseconds()
+	key := gossipKey{Key: s.key, Start: index * length, Length: length}
+	current := s.count(key)
+	previous := uint(0)
+	if s.sliding {
+		previous = s.count(s.previousKey(key))
+	}
+	return key, current, previous, elapsed
+}
+
+// previousKey returns the counter of the window before the one of key
+func (s *GossipStore) previousKey(key gossipKey) gossipKey {
+	return gossipKey{Key: key.Key, Start: key.Start - key.Length, Length: key.Length}
+}
+
+// count returns the count of a counter, without the hits counted before the last refresh
+func (s *GossipStore) count(key gossipKey) uint {
+	count := uint(s.node.count(key))
+	if refreshed := s.refreshed[key]; refreshed < count {
+		return count - refreshed
+	}
+	return 0
+}
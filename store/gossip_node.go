@@ -0,0 +1,389 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/log"
+)
+
+// GossipPath is the path of the gossip endpoint of a GossipNode listening on its bind address
+const GossipPath = "/gossip"
+
+// The gossip settings used when they aren't configured
+const (
+	defaultGossipInterval = 100 * time.Millisecond
+	// Every node sends all of its counters (rather than the ones that changed) every so many
+	// rounds, so the peers catch up with the messages they missed
+	gossipFullSyncRounds = 10
+	// Max size of the gossip received from a peer
+	gossipMaxBodyBytes = 1 << 20
+)
+
+// GossipNode shares the counters of the gossip stores with its peers without Redis. Every counter
+// is a grow-only counter (a CRDT) per fixed window, made of a slot per node only incremented by
+// its node: every round, the node sends its own slots that changed to its peers over HTTP, and
+// merges the slots it receives by keeping their max, so the nodes converge to the same counts
+// whatever the order or duplication of the messages. Every node must list all the other nodes as
+// its peers, and the counters of the windows that can't be weighted anymore are dropped.
+//
+// The gossip is authenticated by the secret shared by the nodes, and only merged when it's sent
+// by one of the peers of the node, for the windows around the current one.
+//
+// The limit is enforced approximately: the hits taken by the other nodes since their last round
+// aren't known yet, so the nodes may admit up to the hits they take within an interval more than
+// the limit all together.
+type GossipNode struct {
+	id       string
+	from     string
+	secret   string
+	client   *http.Client
+	interval time.Duration
+
+	mutex    sync.Mutex
+	clock    Clock
+	peers    []string
+	counters map[gossipKey]map[string]uint64
+	changed  map[gossipKey]bool
+	rounds   uint
+
+	server *http.Server
+	addr   string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// gossipKey identifies the counter of a key in a fixed window
+type gossipKey struct {
+	Key string `json:"key"`
+	// The start and length of the window, in milliseconds
+	Start  int64 `json:"start"`
+	Length int64 `json:"length"`
+}
+
+// gossipMessage holds the slots of a node, sent from the gossip URL its peers know it by
+type gossipMessage struct {
+	Node     string          `json:"node"`
+	From     string          `json:"from"`
+	Counters []gossipCounter `json:"counters"`
+}
+
+type gossipCounter struct {
+	gossipKey
+	Count uint64 `json:"count"`
+}
+
+// NewGossipNode creates a node with the gossip configuration, listening on its bind address if it
+// has one (which requires a secret), and starts gossiping with its peers until it's closed
+func NewGossipNode(cfg config.GossipConfig) (*GossipNode, error) {
+	if cfg.BindAddress != "" && cfg.Secret == "" {
+		return nil, errors.New("the gossip node has a bind address but no secret")
+	}
+	id := cfg.NodeID
+	if id == "" {
+		random := make([]byte, 8)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		id = hex.EncodeToString(random)
+	}
+	interval := time.Duration(cfg.IntervalInMilliseconds) * time.Millisecond
+	if interval == 0 {
+		interval = defaultGossipInterval
+	}
+	n := &GossipNode{
+		id:       id,
+		secret:   cfg.Secret,
+		client:   &http.Client{Timeout: maxDuration(interval, time.Second)},
+		interval: interval,
+		clock:    systemClock{},
+		counters: make(map[gossipKey]map[string]uint64),
+		changed:  make(map[gossipKey]bool),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	n.SetPeers(cfg.Peers)
+	if cfg.Address != "" {
+		n.from = gossipURL(cfg.Address)
+	}
+
+	if cfg.BindAddress != "" {
+		listener, err := net.Listen("tcp", cfg.BindAddress)
+		if err != nil {
+			return nil, err
+		}
+		mux := http.NewServeMux()
+		mux.Handle(GossipPath, n.Handler())
+		n.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		n.addr = listener.Addr().String()
+		if n.from == "" {
+			n.from = gossipURL(n.addr)
+		}
+		go func() {
+			if err := n.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Logf(log.Error, "Error serving the gossip of node %s: %s", n.id, err)
+			}
+		}()
+	}
+	go n.run()
+	return n, nil
+}
+
+// SetClock replaces the clock the counters are dropped as of, which must be the one of the stores
+// counting their hits in the node (the system clock by default)
+func (n *GossipNode) SetClock(clock Clock) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.clock = clock
+}
+
+// ID returns the ID of the node
+func (n *GossipNode) ID() string {
+	return n.id
+}
+
+// Addr returns the address the node listens on, which is empty without a bind address
+func (n *GossipNode) Addr() string {
+	return n.addr
+}
+
+// SetPeers replaces the peers of the node, which are addresses (whose gossip endpoint is
+// GossipPath) or the URLs of their gossip endpoints
+func (n *GossipNode) SetPeers(peers []string) {
+	urls := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		peer = strings.TrimSpace(peer)
+		if peer == "" {
+			continue
+		}
+		urls = append(urls, gossipURL(peer))
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.peers = urls
+}
+
+// gossipURL returns the URL of the gossip endpoint of a peer, given its address or URL
+func gossipURL(peer string) string {
+	if !strings.Contains(peer, "://") {
+		return "http://" + peer + GossipPath
+	}
+	return peer
+}
+
+// Handler returns the handler receiving the gossip of the peers, to mount it on another server
+// instead of listening on a bind address. The requests without the secret of the node are
+// rejected (all of them when it has none), and so is the gossip of the nodes that aren't its peers.
+func (n *GossipNode) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if !n.authorized(r) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		var message gossipMessage
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, gossipMaxBodyBytes)).Decode(&message); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !n.merge(message) {
+			http.Error(w, "the gossip isn't sent by a peer", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// authorized reports whether a request carries the secret of the node, which must have one
+func (n *GossipNode) authorized(r *http.Request) bool {
+	if n.secret == "" {
+		return false
+	}
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(secret), []byte(n.secret)) == 1
+}
+
+// Close stops gossiping, and stops listening on the bind address
+func (n *GossipNode) Close() error {
+	select {
+	case <-n.stop:
+		return nil
+	default:
+	}
+	close(n.stop)
+	<-n.done
+	if n.server != nil {
+		return n.server.Close()
+	}
+	return nil
+}
+
+// count returns the sum of the slots of a counter
+func (n *GossipNode) count(key gossipKey) uint64 {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	count := uint64(0)
+	for _, slot := range n.counters[key] {
+		count += slot
+	}
+	return count
+}
+
+// increment increments the slot of the node in a counter
+func (n *GossipNode) increment(key gossipKey) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	slots, ok := n.counters[key]
+	if !ok {
+		slots = make(map[string]uint64)
+		n.counters[key] = slots
+	}
+	slots[n.id]++
+	n.changed[key] = true
+}
+
+// merge keeps the max of the slots of the message and the ones of the node, ignoring the counters
+// of the windows starting more than two windows away from now (which would never be dropped when
+// they're ahead), and reports whether the message is sent by one of the peers of the node
+func (n *GossipNode) merge(message gossipMessage) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if !n.isPeer(message.From) {
+		return false
+	}
+	if message.Node == "" || message.Node == n.id {
+		return true
+	}
+	nowMillis := n.clock.Now().UnixMilli()
+	for _, counter := range message.Counters {
+		length := counter.Length
+		if length <= 0 || counter.Start < nowMillis-2*length || counter.Start > nowMillis+2*length {
+			continue
+		}
+		slots, ok := n.counters[counter.gossipKey]
+		if !ok {
+			slots = make(map[string]uint64)
+			n.counters[counter.gossipKey] = slots
+		}
+		if counter.Count > slots[message.Node] {
+			slots[message.Node] = counter.Count
+		}
+	}
+	return true
+}
+
+// isPeer reports whether a gossip URL is the one of a peer of the node
+func (n *GossipNode) isPeer(from string) bool {
+	if from == "" {
+		return false
+	}
+	from = gossipURL(from)
+	for _, peer := range n.peers {
+		if peer == from {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *GossipNode) run() {
+	defer close(n.done)
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+			n.mutex.Lock()
+			now := n.clock.Now()
+			n.mutex.Unlock()
+			n.gossip(now)
+		}
+	}
+}
+
+// gossip drops the counters that expired as of now, and sends the slots of the node that changed
+// since the last round (or all of them every gossipFullSyncRounds rounds) to the peers
+func (n *GossipNode) gossip(now time.Time) {
+	n.mutex.Lock()
+	nowMillis := now.UnixMilli()
+	n.rounds++
+	fullSync := n.rounds%gossipFullSyncRounds == 0
+	message := gossipMessage{Node: n.id, From: n.from}
+	for key, slots := range n.counters {
+		// The counter of a window is weighted during the next one by the sliding window counter
+		if key.Start+2*key.Length <= nowMillis {
+			delete(n.counters, key)
+			continue
+		}
+		if slot, ok := slots[n.id]; ok && (fullSync || n.changed[key]) {
+			message.Counters = append(message.Counters, gossipCounter{key, slot})
+		}
+	}
+	n.changed = make(map[gossipKey]bool)
+	peers := n.peers
+	n.mutex.Unlock()
+
+	if len(message.Counters) == 0 || len(peers) == 0 {
+		return
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		log.Logf(log.Error, "Error encoding the gossip of node %s: %s", n.id, err)
+		return
+	}
+	wg := sync.WaitGroup{}
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			if err := n.send(peer, body); err != nil {
+				log.Logf(log.Warn, "Error sending the gossip of node %s to %s: %s", n.id, peer, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (n *GossipNode) send(peer string, body []byte) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-n.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+n.secret)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+)
+
+// setupGossipNodes starts nodes gossiping with each other on localhost
+func setupGossipNodes(t *testing.T, count int) []*GossipNode {
+	nodes := make([]*GossipNode, count)
+	for i := range nodes {
+		node, err := NewGossipNode(config.GossipConfig{BindAddress: "127.0.0.1:0", IntervalInMilliseconds: 10, Secret: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { node.Close() })
+		nodes[i] = node
+	}
+	for _, node := range nodes {
+		peers := []string{}
+		for _, peer := range nodes {
+			if peer != node {
+				peers = append(peers, peer.Addr())
+			}
+		}
+		node.SetPeers(peers)
+	}
+	return nodes
+}
+
+// postGossip posts a gossip message to the handler of a node, returning the status of the response
+func postGossip(handler http.Handler, secret, body string) int {
+	req := httptest.NewRequest(http.MethodPost, GossipPath, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+secret)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestGossipNode_Merge(t *testing.T) {
+	node, err := NewGossipNode(config.GossipConfig{NodeID: "a", Peers: []string{"10.0.0.2:7946", "10.0.0.3:7946"}, Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	handler := node.Handler()
+	key := gossipKey{Key: "key", Start: time.Now().UnixMilli(), Length: 60000}
+	node.increment(key)
+
+	// The slots of the other nodes keep their max, whatever the order or duplication of the messages
+	for _, body := range []string{
+		`{"node":"b","from":"10.0.0.2:7946","counters":[{"key":"key","start":%d,"length":60000,"count":3}]}`,
+		`{"node":"b","from":"10.0.0.2:7946","counters":[{"key":"key","start":%d,"length":60000,"count":2}]}`,
+		`{"node":"c","from":"http://10.0.0.3:7946/gossip","counters":[{"key":"key","start":%d,"length":60000,"count":4}]}`,
+		`{"node":"c","from":"10.0.0.3:7946","counters":[{"key":"key","start":%d,"length":60000,"count":4}]}`,
+		`{"node":"a","from":"10.0.0.2:7946","counters":[{"key":"key","start":%d,"length":60000,"count":9}]}`,
+	} {
+		if code := postGossip(handler, "secret", fmt.Sprintf(body, key.Start)); code != http.StatusNoContent {
+			t.Fatalf("Gossip returned %d", code)
+		}
+	}
+	if count := node.count(key); count != 8 {
+		t.Errorf("Counted %d hits, expected 8", count)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, GossipPath, nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET returned %d, expected %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestGossipNode_Reject(t *testing.T) {
+	if _, err := NewGossipNode(config.GossipConfig{BindAddress: "127.0.0.1:0"}); err == nil {
+		t.Error("Created a node listening without a secret")
+	}
+
+	node, err := NewGossipNode(config.GossipConfig{NodeID: "a", Peers: []string{"10.0.0.2:7946"}, Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	handler := node.Handler()
+	now := time.Now().UnixMilli()
+	body := `{"node":"b","from":"%s","counters":[{"key":"key","start":%d,"length":1000,"count":3}]}`
+
+	if code := postGossip(handler, "wrong", fmt.Sprintf(body, "10.0.0.2:7946", now)); code != http.StatusUnauthorized {
+		t.Errorf("Gossip with a wrong secret returned %d, expected %d", code, http.StatusUnauthorized)
+	}
+	if code := postGossip(handler, "secret", fmt.Sprintf(body, "10.0.0.4:7946", now)); code != http.StatusForbidden {
+		t.Errorf("Gossip of another node returned %d, expected %d", code, http.StatusForbidden)
+	}
+	large := `{"node":"b","from":"10.0.0.2:7946","counters":[` + strings.Repeat(fmt.Sprintf(`{"key":"key","start":%d,"length":1000,"count":1},`, now), 1<<15) + `]}`
+	if code := postGossip(handler, "secret", large); code != http.StatusBadRequest {
+		t.Errorf("Oversized gossip returned %d, expected %d", code, http.StatusBadRequest)
+	}
+
+	// The counters of the windows too far from now are ignored
+	for _, start := range []int64{now - 3000, now + 3000} {
+		if code := postGossip(handler, "secret", fmt.Sprintf(body, "10.0.0.2:7946", start)); code != http.StatusNoContent {
+			t.Fatalf("Gossip returned %d", code)
+		}
+	}
+	node.mutex.Lock()
+	counters := len(node.counters)
+	node.mutex.Unlock()
+	if counters != 0 {
+		t.Errorf("Kept %d counters, expected none", counters)
+	}
+
+	// A node without a secret rejects all the gossip
+	open, err := NewGossipNode(config.GossipConfig{Peers: []string{"10.0.0.2:7946"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	if code := postGossip(open.Handler(), "", fmt.Sprintf(body, "10.0.0.2:7946", now)); code != http.StatusUnauthorized {
+		t.Errorf("Gossip without a secret returned %d, expected %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestGossipStore_Converge(t *testing.T) {
+	nodes := setupGossipNodes(t, 3)
+	config := &StoreConfig{MaxRequests: 100, LimitInSeconds: 3600}
+	for i := 0; i < 5; i++ {
+		NewGossipStore(nodes[0], "1.1.1.1", "", FixedWindowAlgorithm, config).Take()
+	}
+
+	for _, node := range nodes[1:] {
+		store := NewGossipStore(node, "1.1.1.1", "", FixedWindowAlgorithm, config)
+		deadline := time.Now().Add(time.Second)
+		for store.HitCount() != 5 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if hitCount := store.HitCount(); hitCount != 5 {
+			t.Errorf("Node %s counted %d hits, expected 5", node.ID(), hitCount)
+		}
+	}
+}
+
+func TestGossipStore_SharedLimit(t *testing.T) {
+	nodes := setupGossipNodes(t, 3)
+	for _, algorithm := range []string{FixedWindowAlgorithm, SlidingWindowCounterAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 3600}
+			stores := make([]*GossipStore, len(nodes))
+			for i, node := range nodes {
+				stores[i] = NewGossipStore(node, algorithm, "", algorithm, config)
+			}
+
+			// The nodes share the limit, taking their hits alternately slower than they gossip
+			allowed := 0
+			for i := 0; i < 20; i++ {
+				if !stores[i%len(stores)].Take().Limited {
+					allowed++
+				}
+				time.Sleep(30 * time.Millisecond)
+			}
+			if allowed != 10 {
+				t.Errorf("%d hits were allowed, expected 10", allowed)
+			}
+		})
+	}
+}
+
+func TestGossipStore_Refresh(t *testing.T) {
+	node, err := NewGossipNode(config.GossipConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	for _, algorithm := range []string{FixedWindowAlgorithm, SlidingWindowCounterAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			config := &StoreConfig{MaxRequests: 3, LimitInSeconds: 3600, BlockInSeconds: 30}
+			store := NewGossipStore(node, algorithm, "", algorithm, config)
+			for i := 0; i < 4; i++ {
+				store.Take()
+			}
+			if !store.IsBlocked() {
+				t.Fatal("The store isn't blocked over the limit")
+			}
+
+			// The hits counted before the refresh are forgotten, the refresh taking a new one
+			store.Refresh()
+			if store.IsBlocked() {
+				t.Error("The store is still blocked after a refresh")
+			}
+			if hitCount := store.HitCount(); hitCount != 1 {
+				t.Errorf("The store counted %d hits after a refresh, expected 1", hitCount)
+			}
+			for i := 0; i < 2; i++ {
+				if result := store.Take(); result.Limited {
+					t.Errorf("Hit %d after a refresh returned %+v, expected it to be accepted", i+2, result)
+				}
+			}
+			if result := store.Take(); !result.Limited {
+				t.Errorf("Hit over the limit after a refresh returned %+v, expected it to be limited", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LeaseConfig bounds the hits a HybridStore leases from Redis at once, trading accuracy for
+// round trips: the more hits are leased, the fewer requests reach Redis, but the more hits may
+// be leased by an instance without being used, denying requests that another instance would
+// have allowed.
+type LeaseConfig struct {
+	// Max hits leased at once (1 when it's 0, so every request reaches Redis)
+	BatchSize uint
+	// Max percentage of the hits left in the window leased at once (100 when it's 0), so the
+	// leases shrink as the limit is approached. At least one hit is leased.
+	MaxSharePercent uint
+}
+
+// HybridStore implements the fixed window algorithm on Redis like RedisStore, but leases batches
+// of hits from the Redis counter and counts them locally, so only the requests exhausting the
+// lease reach Redis. The block and the exhaustion of the window are cached locally as well, so
+// denied requests don't reach Redis either.
+// The leased hits are lost when the window ends, and the hits left in the window are leased
+// atomically by Take, so the instances sharing the counter never admit more than the limit.
+type HybridStore struct {
+	redisBlock
+	config *StoreConfig
+	clock  Clock
+	lease  LeaseConfig
+	key    string
+	result Result
+	// The leased hits left, the counter as of the last lease, the end of its window and whether
+	// no hits are left in it
+	leased    uint
+	count     uint
+	windowEnd time.Time
+	exhausted bool
+	// The end of the block known locally, and the last hit taken
+	blockedUntil time.Time
+	lastHit      time.Time
+}
+
+func NewHybridStore(client redis.UniversalClient, ip string, token string, config *StoreConfig, lease LeaseConfig) *HybridStore {
+	key := redisKey(ip, token) + ":hybrid"
+	return &HybridStore{redisBlock: redisBlock{client, key + ":isBlocked"}, config: config, clock: config.clock(), lease: lease, key: key}
+}
+
+func (s *HybridStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *HybridStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+// TakeContext takes a leased hit, leasing more from Redis when there are none left in the window
+func (s *HybridStore) TakeContext(ctx context.Context) (Result, error) {
+	now := s.clock.Now()
+	if now.Before(s.blockedUntil) || (s.exhausted && now.Before(s.windowEnd)) {
+		s.result = s.localResult(now, true)
+		return s.result, nil
+	}
+	if s.leased > 0 && now.Before(s.windowEnd) {
+		s.leased--
+		s.lastHit = now
+		s.result = s.localResult(now, false)
+		return s.result, nil
+	}
+
+	batchSize, share := s.lease.BatchSize, s.lease.MaxSharePercent
+	if batchSize == 0 {
+		batchSize = 1
+	}
+	if share == 0 || share > 100 {
+		share = 100
+	}
+	reply, err := leaseScript.Run(
+		ctx,
+		s.client,
+		[]string{s.key + ":hitCount", s.key + ":isBlocked"},
+		s.config.MaxRequests,
+		s.config.Window().Milliseconds(),
+		s.config.BlockInSeconds*1000,
+		batchSize,
+		share,
+	).Int64Slice()
+	if err != nil {
+		s.result = Result{Err: err}
+		return s.result, err
+	}
+	result := scriptResult(reply)
+	s.leased, s.count, s.windowEnd, s.exhausted = uint(reply[7]), result.HitCount, now.Add(result.ResetAfter), result.Limited
+	if result.Blocked {
+		s.blockedUntil = now.Add(result.RetryAfter)
+	}
+	if !result.Limited {
+		s.leased--
+		s.lastHit = now
+		result.HitCount = s.count - s.leased
+	}
+	s.result = result
+	return result, nil
+}
+
+// localResult returns the result of a hit taken without reaching Redis
+func (s *HybridStore) localResult(now time.Time, limited bool) Result {
+	result := Result{
+		Limited:    limited,
+		HitCount:   s.count - s.leased,
+		ResetAfter: positive(s.windowEnd.Sub(now)),
+	}
+	if limited {
+		result.RetryAfter = result.ResetAfter
+	}
+	if remaining := s.blockedUntil.Sub(now); remaining > 0 {
+		result.Blocked = true
+		result.RemainingBlockTime = uint(math.Ceil(remaining.Seconds()))
+		result.ResetAfter = maxDuration(result.ResetAfter, remaining)
+		result.RetryAfter = maxDuration(result.RetryAfter, remaining)
+	}
+	return result
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *HybridStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the window is started and expired by Take
+func (s *HybridStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh starts a new window, dropping the leased hits
+func (s *HybridStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *HybridStore) RefreshContext(ctx context.Context) error {
+	s.leased, s.count, s.exhausted = 0, 0, false
+	s.windowEnd, s.blockedUntil = time.Time{}, time.Time{}
+	return s.client.Del(ctx, s.key+":hitCount", s.key+":isBlocked").Err()
+}
+
+func (s *HybridStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *HybridStore) BlockContext(ctx context.Context) error {
+	s.blockedUntil = s.clock.Now().Add(time.Duration(s.config.BlockInSeconds) * time.Second)
+	return s.block(ctx, s.config)
+}
+
+func (s *HybridStore) Hit() {
+	s.Take()
+}
+
+// Expired reports whether the window and the block known locally are over, the leased hits
+// being lost anyway
+func (s *HybridStore) Expired(now time.Time) bool {
+	return !now.Before(s.windowEnd) && !now.Before(s.blockedUntil)
+}
+
+// LastHit returns the last hit taken by this instance
+func (s *HybridStore) LastHit() time.Time {
+	return s.lastHit
+}
+
+func (s *HybridStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	return s.lastHit, nil
+}
+
+// HitCount returns the amount of hits leased by all the instances in the current window
+func (s *HybridStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *HybridStore) HitCountContext(ctx context.Context) (uint, error) {
+	hitCount, err := getInt(ctx, s.client, s.key+":hitCount")
+	return uint(hitCount), err
+}
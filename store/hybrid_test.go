@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHybridStore_Take(t *testing.T) {
+	server, client := setupRedis(t)
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 60, BlockInSeconds: 30}
+	store := NewHybridStore(client, "1.1.1.1", "", config, LeaseConfig{BatchSize: 5})
+	key := redisKey("1.1.1.1", "") + ":hybrid:hitCount"
+
+	for i := uint(1); i <= 5; i++ {
+		if result := store.Take(); result.Limited || result.HitCount != i {
+			t.Fatalf("Hit %d returned %+v", i, result)
+		}
+	}
+	// The hits of the lease are taken locally
+	if count, _ := server.Get(key); count != "5" {
+		t.Errorf("Redis counted %s hits, expected a single lease of 5", count)
+	}
+	for i := uint(6); i <= 10; i++ {
+		if result := store.Take(); result.Limited || result.HitCount != i {
+			t.Fatalf("Hit %d returned %+v", i, result)
+		}
+	}
+	result := store.Take()
+	if !result.Limited || !result.Blocked || result.RemainingBlockTime != 30 {
+		t.Errorf("Hit over the limit returned %+v, expected it to be limited and blocked", result)
+	}
+
+	// The block is known locally
+	server.Close()
+	if result, err := store.TakeContext(context.Background()); err != nil || !result.Limited || !result.Blocked {
+		t.Errorf("Hit while blocked returned %+v, %v, expected it to be limited without reaching Redis", result, err)
+	}
+}
+
+func TestHybridStore_SharedLimit(t *testing.T) {
+	_, client := setupRedis(t)
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 60}
+	lease := LeaseConfig{BatchSize: 4}
+	stores := []*HybridStore{
+		NewHybridStore(client, "1.1.1.1", "", config, lease),
+		NewHybridStore(client, "1.1.1.1", "", config, lease),
+	}
+
+	// The instances share the limit, taking their hits alternately
+	allowed := 0
+	for i := 0; i < 30; i++ {
+		if !stores[i%2].Take().Limited {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("%d hits were allowed, expected exactly 10", allowed)
+	}
+}
+
+func TestHybridStore_MaxShare(t *testing.T) {
+	server, client := setupRedis(t)
+	config := &StoreConfig{MaxRequests: 100, LimitInSeconds: 60}
+	store := NewHybridStore(client, "1.1.1.1", "", config, LeaseConfig{BatchSize: 50, MaxSharePercent: 10})
+	key := redisKey("1.1.1.1", "") + ":hybrid:hitCount"
+
+	store.Take()
+	if count, _ := server.Get(key); count != "10" {
+		t.Errorf("Redis counted %s hits, expected a lease of 10%% of the 100 hits left", count)
+	}
+	if ttl := server.TTL(key); ttl <= 0 {
+		t.Error("The counter has no TTL")
+	}
+}
@@ -1,11 +1,13 @@
 package store
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type InMemoryStore struct {
 	config    *StoreConfig
+	clock     Clock
 	hitCount  uint
 	lastHit   time.Time
 	isBlocked bool
@@ -14,27 +16,91 @@ type InMemoryStore struct {
 func NewInMemoryStore(config *StoreConfig) *InMemoryStore {
 	return &InMemoryStore{
 		config:    config,
-		hitCount:  1,
-		lastHit:   time.Now(),
+		clock:     config.clock(),
+		hitCount:  0,
+		lastHit:   config.clock().Now(),
 		isBlocked: false,
 	}
 }
 
+func (s *InMemoryStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *InMemoryStore) Take() Result {
+	if s.ShouldRefresh() {
+		s.Refresh()
+	} else if s.isBlocked || s.ShouldLimit() {
+		// The hits over the limit aren't counted, so they don't extend the window
+		return s.result(true)
+	} else {
+		s.Hit()
+	}
+	if s.ShouldLimit() {
+		s.Block()
+		return s.result(true)
+	}
+	return s.result(false)
+}
+
+func (s *InMemoryStore) result(limited bool) Result {
+	result := Result{Limited: limited, Blocked: s.isBlocked, HitCount: s.hitCount}
+	// The store is refreshed once more whole seconds than the limit (or block) duration passed since the last hit
+	refreshAfter := func(seconds uint) time.Duration {
+		return positive(time.Unix(s.lastHit.Unix()+int64(seconds)+1, 0).Sub(s.clock.Now()))
+	}
+	if s.isBlocked {
+		result.RemainingBlockTime = s.RemainingBlockTime()
+		result.ResetAfter = refreshAfter(s.config.BlockInSeconds)
+	} else {
+		result.ResetAfter = refreshAfter(s.config.LimitInSeconds)
+	}
+	if limited {
+		result.RetryAfter = result.ResetAfter
+	}
+	return result
+}
+
+type inMemoryState struct {
+	HitCount  uint      `json:"hitCount"`
+	LastHit   time.Time `json:"lastHit"`
+	IsBlocked bool      `json:"isBlocked"`
+}
+
+func (s *InMemoryStore) MarshalState() ([]byte, error) {
+	return json.Marshal(inMemoryState{s.hitCount, s.lastHit, s.isBlocked})
+}
+
+func (s *InMemoryStore) RestoreState(data []byte) error {
+	var state inMemoryState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.hitCount, s.lastHit, s.isBlocked = state.HitCount, state.LastHit, state.IsBlocked
+	return nil
+}
+
 func (s *InMemoryStore) ShouldLimit() bool {
 	return s.hitCount > s.config.MaxRequests
 }
 
 func (s *InMemoryStore) ShouldRefresh() bool {
-	LastHit := int(time.Now().Unix() - s.lastHit.Unix())
+	return s.Expired(s.clock.Now())
+}
+
+// Expired reports whether more whole seconds than the limit (or block) duration passed since the
+// last hit as of now
+func (s *InMemoryStore) Expired(now time.Time) bool {
+	lastHit := now.Unix() - s.lastHit.Unix()
 	if s.isBlocked {
-		return LastHit > int(s.config.BlockInSeconds)
+		return lastHit > int64(s.config.BlockInSeconds)
 	}
-	return LastHit > int(s.config.LimitInSeconds)
+	return lastHit > int64(s.config.LimitInSeconds)
 }
 
 func (s *InMemoryStore) Refresh() {
 	s.hitCount = 1
-	s.lastHit = time.Now()
+	s.lastHit = s.clock.Now()
 	s.isBlocked = false
 }
 
@@ -43,18 +109,23 @@ func (s *InMemoryStore) IsBlocked() bool {
 }
 
 func (s *InMemoryStore) RemainingBlockTime() uint {
-	return s.config.BlockInSeconds - uint(time.Now().Unix()-s.lastHit.Unix())
+	elapsed := s.clock.Now().Unix() - s.lastHit.Unix()
+	if !s.isBlocked || elapsed >= int64(s.config.BlockInSeconds) {
+		return 0
+	}
+	return s.config.BlockInSeconds - uint(elapsed)
 }
 
+// Block blocks the key, unless there's no block duration
 func (s *InMemoryStore) Block() {
-	s.isBlocked = true
+	s.isBlocked = s.config.BlockInSeconds > 0
 }
 
 func (s *InMemoryStore) Hit() {
 	s.hitCount++
-	s.lastHit = time.Now()
+	s.lastHit = s.clock.Now()
 	if s.ShouldLimit() {
-		s.isBlocked = true
+		s.Block()
 	}
 }
 
@@ -62,6 +133,10 @@ func (s *InMemoryStore) LastHit() time.Time {
 	return s.lastHit
 }
 
+// HitCount returns the amount of hits counted in the current window, which is 0 once it expired
 func (s *InMemoryStore) HitCount() uint {
+	if s.Expired(s.clock.Now()) {
+		return 0
+	}
 	return s.hitCount
 }
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// InMemoryGCRAStore implements the generic cell rate algorithm: requests are evenly spaced by an
+// emission interval of LimitInSeconds / MaxRequests, and the only state kept is the theoretical
+// arrival time (TAT) of the next request. A request is accepted when the TAT it would push forward
+// is at most LimitInSeconds ahead, allowing bursts of up to MaxRequests.
+type InMemoryGCRAStore struct {
+	inMemoryBlock
+	config  *StoreConfig
+	tat     time.Time
+	limited bool
+}
+
+func NewInMemoryGCRAStore(config *StoreConfig) *InMemoryGCRAStore {
+	return &InMemoryGCRAStore{inMemoryBlock: newInMemoryBlock(config), config: config}
+}
+
+func (s *InMemoryGCRAStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *InMemoryGCRAStore) Take() Result {
+	return s.decide(s, s.config, func() bool {
+		s.take()
+		return s.limited
+	})
+}
+
+type gcraState struct {
+	blockState
+	TAT time.Time `json:"tat"`
+}
+
+func (s *InMemoryGCRAStore) MarshalState() ([]byte, error) {
+	return json.Marshal(gcraState{s.state(), s.tat})
+}
+
+func (s *InMemoryGCRAStore) RestoreState(data []byte) error {
+	var state gcraState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.restore(state.blockState)
+	s.tat = state.TAT
+	return nil
+}
+
+func (s *InMemoryGCRAStore) ShouldLimit() bool {
+	return s.limited
+}
+
+// ShouldRefresh always returns false, as the TAT is updated on every hit
+func (s *InMemoryGCRAStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh forgets the TAT and the block, and takes a hit
+func (s *InMemoryGCRAStore) Refresh() {
+	s.unblock()
+	s.tat = time.Time{}
+	s.take()
+}
+
+func (s *InMemoryGCRAStore) Expired(now time.Time) bool {
+	return s.expired(s, now)
+}
+
+func (s *InMemoryGCRAStore) Block() {
+	s.block(s.config)
+}
+
+func (s *InMemoryGCRAStore) Hit() {
+	s.take()
+}
+
+// LastHit returns the arrival time of the last accepted request, as if requests were evenly spaced
+func (s *InMemoryGCRAStore) LastHit() time.Time {
+	return s.tat.Add(-s.config.EmissionInterval())
+}
+
+// HitCount returns the amount of requests that are still counted against the limit
+func (s *InMemoryGCRAStore) HitCount() uint {
+	return gcraHitCount(s.tat.Sub(s.clock.Now()), s.config)
+}
+
+// ResetAfter returns the time left until the limit is fully available again
+func (s *InMemoryGCRAStore) ResetAfter() time.Duration {
+	if resetAfter := s.tat.Sub(s.clock.Now()); resetAfter > 0 {
+		return resetAfter
+	}
+	return 0
+}
+
+// timing waits for the TAT to be reached to reset, and for it to be close enough to accept
+// a new hit
+func (s *InMemoryGCRAStore) timing(now time.Time) (time.Duration, time.Duration) {
+	if s.config.MaxRequests == 0 {
+		return 0, s.config.Window()
+	}
+	untilTat := s.tat.Sub(now)
+	return untilTat, untilTat + s.config.EmissionInterval() - s.config.Window()
+}
+
+func (s *InMemoryGCRAStore) take() {
+	now := s.clock.Now()
+	tat, limited := gcraArrival(now, s.tat, s.config)
+	s.tat = tat
+	s.limited = limited
+}
+
+// gcraArrival returns the TAT after a request arriving at now, and whether the request is
+// limited, in which case the TAT is left untouched
+func gcraArrival(now time.Time, tat time.Time, config *StoreConfig) (time.Time, bool) {
+	if config.MaxRequests == 0 {
+		return tat, true
+	}
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(config.EmissionInterval())
+	if newTat.Sub(now) > config.Window() {
+		return tat, true
+	}
+	return newTat, false
+}
+
+// gcraHitCount converts the time left until the TAT into the amount of requests it accounts for
+func gcraHitCount(untilTat time.Duration, config *StoreConfig) uint {
+	if untilTat <= 0 || config.MaxRequests == 0 {
+		return 0
+	}
+	return uint(math.Ceil(float64(untilTat) / float64(config.EmissionInterval())))
+}
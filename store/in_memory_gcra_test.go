@@ -0,0 +1,117 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryGCRAStore_Burst(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    3,
+		LimitInSeconds: 3,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryGCRAStore(config)
+	store.Hit()
+	store.Hit()
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true within the burst")
+	}
+	if store.HitCount() != 3 {
+		t.Errorf("HitCount() returned %d, expected 3", store.HitCount())
+	}
+	tat := store.tat
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false after the burst")
+	}
+	if !store.tat.Equal(tat) {
+		t.Error("Hit() moved the TAT forward for a limited request")
+	}
+}
+
+func TestInMemoryGCRAStore_EmissionInterval(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryGCRAStore(config)
+	store.Hit()
+	store.Hit()
+
+	// A request is allowed again once an emission interval (5 seconds) has elapsed
+	store.tat = store.tat.Add(-4 * time.Second)
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false before the emission interval elapsed")
+	}
+	store.tat = store.tat.Add(-time.Second)
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true after the emission interval elapsed")
+	}
+	if resetAfter := store.ResetAfter(); resetAfter <= 9*time.Second || resetAfter > 10*time.Second {
+		t.Errorf("ResetAfter() returned %s, expected about 10s", resetAfter)
+	}
+}
+
+func TestInMemoryGCRAStore_Idle(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryGCRAStore(config)
+	store.tat = time.Now().Add(-time.Hour)
+	if store.HitCount() != 0 || store.ResetAfter() != 0 {
+		t.Error("A TAT in the past still counts requests")
+	}
+	store.Hit()
+	if store.ShouldLimit() || store.HitCount() != 1 {
+		t.Error("Hit() did not restart from the current time")
+	}
+}
+
+func TestInMemoryGCRAStore_Timing(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 2,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryGCRAStore(config)
+	store.Take()
+	store.Take()
+	result := store.Take()
+	if !result.Limited {
+		t.Fatal("Take() did not limit a hit over the burst")
+	}
+	if result.ResetAfter < 1990*time.Millisecond || result.ResetAfter > 2*time.Second {
+		t.Errorf("Take() returned a reset after %s, expected the TAT to be 2s ahead", result.ResetAfter)
+	}
+	if result.RetryAfter < 990*time.Millisecond || result.RetryAfter > time.Second {
+		t.Errorf("Take() returned a retry after %s, expected an emission interval of 1s", result.RetryAfter)
+	}
+}
+
+func TestInMemoryGCRAStore_Refresh(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 60,
+		BlockInSeconds: 60,
+	}
+	store := NewInMemoryGCRAStore(config)
+	for i := 0; i < 3; i++ {
+		store.Take()
+	}
+
+	// A refresh forgets the TAT and lifts the block, taking a hit
+	store.Refresh()
+	if store.IsBlocked() || store.HitCount() != 1 {
+		t.Errorf("The refreshed store is blocked %v with %d hits, expected a single hit", store.IsBlocked(), store.HitCount())
+	}
+	if result := store.Take(); result.Limited {
+		t.Errorf("Take() returned %+v after a refresh, expected it to be accepted", result)
+	}
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// InMemoryLeakyBucketStore implements the leaky bucket algorithm as a queue: accepted requests
+// are released one every LimitInSeconds / MaxRequests, and a request is only limited when
+// MaxRequests requests are already waiting, or when it would wait longer than MaxWaitInSeconds.
+// The key isn't blocked when the queue overflows, only by Block, as the queue already bounds the
+// requests. The queue is kept as the time the next request will be released at.
+type InMemoryLeakyBucketStore struct {
+	inMemoryBlock
+	config      *StoreConfig
+	nextRelease time.Time
+	lastHit     time.Time
+	delay       time.Duration
+	limited     bool
+}
+
+func NewInMemoryLeakyBucketStore(config *StoreConfig) *InMemoryLeakyBucketStore {
+	return &InMemoryLeakyBucketStore{inMemoryBlock: newInMemoryBlock(config), config: config}
+}
+
+func (s *InMemoryLeakyBucketStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *InMemoryLeakyBucketStore) Take() Result {
+	if s.IsBlocked() {
+		return s.result(s, true)
+	}
+	s.take()
+	result := s.result(s, s.limited)
+	result.Delay = s.delay
+	return result
+}
+
+type leakyBucketState struct {
+	blockState
+	NextRelease time.Time `json:"nextRelease"`
+	LastHit     time.Time `json:"lastHit"`
+}
+
+func (s *InMemoryLeakyBucketStore) MarshalState() ([]byte, error) {
+	return json.Marshal(leakyBucketState{s.state(), s.nextRelease, s.lastHit})
+}
+
+func (s *InMemoryLeakyBucketStore) RestoreState(data []byte) error {
+	var state leakyBucketState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.restore(state.blockState)
+	s.nextRelease, s.lastHit = state.NextRelease, state.LastHit
+	return nil
+}
+
+func (s *InMemoryLeakyBucketStore) ShouldLimit() bool {
+	return s.limited
+}
+
+// ShouldRefresh always returns false, as the bucket leaks on every hit
+func (s *InMemoryLeakyBucketStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh empties the bucket and forgets the block, and takes a hit
+func (s *InMemoryLeakyBucketStore) Refresh() {
+	s.unblock()
+	s.nextRelease = time.Time{}
+	s.take()
+}
+
+func (s *InMemoryLeakyBucketStore) Expired(now time.Time) bool {
+	return s.expired(s, now)
+}
+
+func (s *InMemoryLeakyBucketStore) Block() {
+	s.block(s.config)
+}
+
+func (s *InMemoryLeakyBucketStore) Hit() {
+	s.take()
+}
+
+func (s *InMemoryLeakyBucketStore) LastHit() time.Time {
+	return s.lastHit
+}
+
+// HitCount returns the amount of requests waiting in the queue
+func (s *InMemoryLeakyBucketStore) HitCount() uint {
+	return leakyBucketQueued(s.nextRelease.Sub(s.clock.Now()), s.config)
+}
+
+func (s *InMemoryLeakyBucketStore) Delay() time.Duration {
+	return s.delay
+}
+
+// timing waits for the queue to be empty to reset, and for it to have room for (and not to be
+// held back longer than MaxWaitInSeconds) a new hit
+func (s *InMemoryLeakyBucketStore) timing(now time.Time) (time.Duration, time.Duration) {
+	wait := s.nextRelease.Sub(now)
+	return wait, leakyBucketRetryAfter(wait, s.config)
+}
+
+func (s *InMemoryLeakyBucketStore) take() {
+	now := s.clock.Now()
+	s.lastHit = now
+	nextRelease, delay, limited := leakyBucketArrival(now, s.nextRelease, s.config)
+	s.nextRelease = nextRelease
+	s.delay = delay
+	s.limited = limited
+}
+
+// leakyBucketArrival queues a request arriving at now, returning the time the following request
+// will be released at, how long this one must wait, and whether it's limited instead, in which
+// case the queue is left untouched
+func leakyBucketArrival(now time.Time, nextRelease time.Time, config *StoreConfig) (time.Time, time.Duration, bool) {
+	if nextRelease.Before(now) {
+		nextRelease = now
+	}
+	wait := nextRelease.Sub(now)
+	if leakyBucketQueued(wait, config) >= config.MaxRequests {
+		return nextRelease, 0, true
+	}
+	if config.MaxWaitInSeconds > 0 && wait > time.Duration(config.MaxWaitInSeconds)*time.Second {
+		return nextRelease, 0, true
+	}
+	return nextRelease.Add(config.EmissionInterval()), wait, false
+}
+
+// leakyBucketRetryAfter returns the time left until a request would be accepted in the queue,
+// given the time left until the next release
+func leakyBucketRetryAfter(untilNextRelease time.Duration, config *StoreConfig) time.Duration {
+	if config.MaxRequests == 0 {
+		return config.Window()
+	}
+	retryAfter := untilNextRelease - time.Duration(config.MaxRequests-1)*config.EmissionInterval()
+	if config.MaxWaitInSeconds > 0 {
+		retryAfter = maxDuration(retryAfter, untilNextRelease-time.Duration(config.MaxWaitInSeconds)*time.Second)
+	}
+	return retryAfter
+}
+
+// leakyBucketQueued converts the time left until the next release into the amount of requests
+// waiting to be released
+func leakyBucketQueued(untilNextRelease time.Duration, config *StoreConfig) uint {
+	if untilNextRelease <= 0 {
+		return 0
+	}
+	interval := config.EmissionInterval()
+	return uint((untilNextRelease + interval - 1) / interval)
+}
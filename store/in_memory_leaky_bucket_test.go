@@ -0,0 +1,125 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryLeakyBucketStore_Queue(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    3,
+		LimitInSeconds: 3,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryLeakyBucketStore(config)
+	if result := store.Take(); result.Limited || result.Delay != 0 {
+		t.Errorf("Take() returned %+v, expected the first request to be released right away", result)
+	}
+
+	// The following requests are released one second apart
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true while the queue has room")
+	}
+	if delay := store.Delay(); delay <= 900*time.Millisecond || delay > time.Second {
+		t.Errorf("Delay() returned %s, expected about 1s", delay)
+	}
+	store.Hit()
+	if delay := store.Delay(); delay <= 1900*time.Millisecond || delay > 2*time.Second {
+		t.Errorf("Delay() returned %s, expected about 2s", delay)
+	}
+	if store.HitCount() != 3 {
+		t.Errorf("HitCount() returned %d, expected 3", store.HitCount())
+	}
+
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false when the queue is full")
+	}
+	if store.HitCount() != 3 {
+		t.Errorf("HitCount() returned %d, expected the limited request not to be queued", store.HitCount())
+	}
+}
+
+func TestInMemoryLeakyBucketStore_Leak(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 2,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryLeakyBucketStore(config)
+	store.Hit()
+	store.Hit()
+
+	// Once the queue is drained requests are released right away again
+	store.nextRelease = time.Now().Add(-time.Millisecond)
+	store.Hit()
+	if store.ShouldLimit() || store.Delay() != 0 {
+		t.Error("Request was held back by a drained queue")
+	}
+}
+
+func TestInMemoryLeakyBucketStore_MaxWait(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:      10,
+		LimitInSeconds:   10,
+		BlockInSeconds:   0,
+		MaxWaitInSeconds: 1,
+	}
+	store := NewInMemoryLeakyBucketStore(config)
+	store.Hit()
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true when the wait is within the max wait")
+	}
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false when the wait exceeds the max wait")
+	}
+}
+
+func TestInMemoryLeakyBucketStore_Refresh(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 60,
+		BlockInSeconds: 60,
+	}
+	store := NewInMemoryLeakyBucketStore(config)
+	for i := 0; i < 3; i++ {
+		store.Take()
+	}
+	store.Block()
+
+	// A refresh empties the queue and lifts the block, releasing the hit right away
+	store.Refresh()
+	if store.IsBlocked() || store.HitCount() != 1 || store.Delay() != 0 {
+		t.Errorf("The refreshed store is blocked %v with %d hits, expected a single hit released right away", store.IsBlocked(), store.HitCount())
+	}
+	if result := store.Take(); result.Limited {
+		t.Errorf("Take() returned %+v after a refresh, expected it to be accepted", result)
+	}
+}
+
+func TestInMemoryLeakyBucketStore_OverflowDoesntBlock(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 2,
+		BlockInSeconds: 60,
+	}
+	store := NewInMemoryLeakyBucketStore(config)
+	store.Take()
+	store.Take()
+	result := store.Take()
+	if !result.Limited || result.Blocked || result.RetryAfter > time.Second {
+		t.Errorf("Take() returned %+v over the limit, expected it to be limited until the queue has room", result)
+	}
+	if store.IsBlocked() {
+		t.Error("The overflowing queue blocked the key")
+	}
+
+	// Once the queue has room again, the requests are queued
+	store.nextRelease = store.nextRelease.Add(-time.Second)
+	if result := store.Take(); result.Limited {
+		t.Errorf("Take() returned %+v, expected the request to be queued", result)
+	}
+}
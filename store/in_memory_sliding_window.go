@@ -0,0 +1,299 @@
+package store
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// InMemorySlidingWindowLogStore implements the sliding window log algorithm: it keeps the
+// timestamp of every accepted request, so the limit is exact for any window of LimitInSeconds,
+// at the cost of memory proportional to MaxRequests.
+type InMemorySlidingWindowLogStore struct {
+	inMemoryBlock
+	config  *StoreConfig
+	hits    []time.Time
+	limited bool
+}
+
+func NewInMemorySlidingWindowLogStore(config *StoreConfig) *InMemorySlidingWindowLogStore {
+	return &InMemorySlidingWindowLogStore{
+		inMemoryBlock: newInMemoryBlock(config),
+		config:        config,
+		hits:          make([]time.Time, 0, config.MaxRequests),
+	}
+}
+
+func (s *InMemorySlidingWindowLogStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *InMemorySlidingWindowLogStore) Take() Result {
+	return s.decide(s, s.config, func() bool {
+		s.take()
+		return s.limited
+	})
+}
+
+type slidingWindowLogState struct {
+	blockState
+	Hits []time.Time `json:"hits"`
+}
+
+func (s *InMemorySlidingWindowLogStore) MarshalState() ([]byte, error) {
+	return json.Marshal(slidingWindowLogState{s.state(), s.hits})
+}
+
+func (s *InMemorySlidingWindowLogStore) RestoreState(data []byte) error {
+	var state slidingWindowLogState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.restore(state.blockState)
+	s.hits = append(s.hits[:0], state.Hits...)
+	return nil
+}
+
+func (s *InMemorySlidingWindowLogStore) ShouldLimit() bool {
+	return s.limited
+}
+
+// ShouldRefresh always returns false, as the window slides on every hit
+func (s *InMemorySlidingWindowLogStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh forgets the logged hits and the block, and takes a hit
+func (s *InMemorySlidingWindowLogStore) Refresh() {
+	s.unblock()
+	s.hits = s.hits[:0]
+	s.take()
+}
+
+func (s *InMemorySlidingWindowLogStore) Expired(now time.Time) bool {
+	return s.expired(s, now)
+}
+
+func (s *InMemorySlidingWindowLogStore) Block() {
+	s.block(s.config)
+}
+
+func (s *InMemorySlidingWindowLogStore) Hit() {
+	s.take()
+}
+
+func (s *InMemorySlidingWindowLogStore) LastHit() time.Time {
+	if len(s.hits) == 0 {
+		return time.Time{}
+	}
+	return s.hits[len(s.hits)-1]
+}
+
+// HitCount returns the amount of requests accepted within the last LimitInSeconds
+func (s *InMemorySlidingWindowLogStore) HitCount() uint {
+	return uint(len(s.hits) - s.outOfWindow(s.clock.Now()))
+}
+
+// outOfWindow returns the amount of hits that are out of the window ending at now
+func (s *InMemorySlidingWindowLogStore) outOfWindow(now time.Time) int {
+	windowStart := now.Add(-s.config.Window())
+	expired := 0
+	for expired < len(s.hits) && !s.hits[expired].After(windowStart) {
+		expired++
+	}
+	return expired
+}
+
+// timing waits for the last hit to leave the window to reset, and for the MaxRequests-th last
+// one to leave it to accept a new hit
+func (s *InMemorySlidingWindowLogStore) timing(now time.Time) (time.Duration, time.Duration) {
+	window := s.config.Window()
+	if s.config.MaxRequests == 0 {
+		return 0, window
+	}
+	hits := s.hits[s.outOfWindow(now):]
+	if len(hits) == 0 {
+		return 0, 0
+	}
+	resetAfter := hits[len(hits)-1].Add(window).Sub(now)
+	if uint(len(hits)) < s.config.MaxRequests {
+		return resetAfter, 0
+	}
+	return resetAfter, hits[uint(len(hits))-s.config.MaxRequests].Add(window).Sub(now)
+}
+
+// take drops the hits that are out of the window and logs a new one, flagging the store as
+// limited (without logging the hit) when the window is full
+func (s *InMemorySlidingWindowLogStore) take() {
+	now := s.clock.Now()
+	s.hits = append(s.hits[:0], s.hits[s.outOfWindow(now):]...)
+	if uint(len(s.hits)) >= s.config.MaxRequests {
+		s.limited = true
+		return
+	}
+	s.hits = append(s.hits, now)
+	s.limited = false
+}
+
+// InMemorySlidingWindowCounterStore implements the sliding window counter algorithm: it only
+// keeps the counters of the current and previous fixed windows, and estimates the requests
+// made within the sliding window by weighting the previous counter by its overlap with it.
+type InMemorySlidingWindowCounterStore struct {
+	inMemoryBlock
+	config   *StoreConfig
+	window   int64
+	current  uint
+	previous uint
+	lastHit  time.Time
+	limited  bool
+}
+
+func NewInMemorySlidingWindowCounterStore(config *StoreConfig) *InMemorySlidingWindowCounterStore {
+	return &InMemorySlidingWindowCounterStore{inMemoryBlock: newInMemoryBlock(config), config: config}
+}
+
+func (s *InMemorySlidingWindowCounterStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *InMemorySlidingWindowCounterStore) Take() Result {
+	return s.decide(s, s.config, func() bool {
+		s.take()
+		return s.limited
+	})
+}
+
+type slidingWindowCounterState struct {
+	blockState
+	Window   int64     `json:"window"`
+	Current  uint      `json:"current"`
+	Previous uint      `json:"previous"`
+	LastHit  time.Time `json:"lastHit"`
+}
+
+func (s *InMemorySlidingWindowCounterStore) MarshalState() ([]byte, error) {
+	return json.Marshal(slidingWindowCounterState{s.state(), s.window, s.current, s.previous, s.lastHit})
+}
+
+func (s *InMemorySlidingWindowCounterStore) RestoreState(data []byte) error {
+	var state slidingWindowCounterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.restore(state.blockState)
+	s.window, s.current, s.previous, s.lastHit = state.Window, state.Current, state.Previous, state.LastHit
+	return nil
+}
+
+func (s *InMemorySlidingWindowCounterStore) ShouldLimit() bool {
+	return s.limited
+}
+
+// ShouldRefresh always returns false, as the window slides on every hit
+func (s *InMemorySlidingWindowCounterStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh forgets the counters and the block, and takes a hit
+func (s *InMemorySlidingWindowCounterStore) Refresh() {
+	s.unblock()
+	s.current, s.previous = 0, 0
+	s.take()
+}
+
+func (s *InMemorySlidingWindowCounterStore) Expired(now time.Time) bool {
+	return s.expired(s, now)
+}
+
+func (s *InMemorySlidingWindowCounterStore) Block() {
+	s.block(s.config)
+}
+
+func (s *InMemorySlidingWindowCounterStore) Hit() {
+	s.take()
+}
+
+func (s *InMemorySlidingWindowCounterStore) LastHit() time.Time {
+	return s.lastHit
+}
+
+// HitCount returns the estimated amount of requests accepted within the last LimitInSeconds
+func (s *InMemorySlidingWindowCounterStore) HitCount() uint {
+	window, elapsed := slidingWindow(s.clock.Now(), s.config.Window())
+	current, previous := s.current, s.previous
+	if window == s.window+1 {
+		current, previous = 0, s.current
+	} else if window != s.window {
+		current, previous = 0, 0
+	}
+	return uint(math.Ceil(slidingWindowEstimate(current, previous, elapsed)))
+}
+
+func (s *InMemorySlidingWindowCounterStore) timing(now time.Time) (time.Duration, time.Duration) {
+	window, elapsed := slidingWindow(now, s.config.Window())
+	current, previous := s.current, s.previous
+	if window == s.window+1 {
+		current, previous = 0, s.current
+	} else if window != s.window {
+		current, previous = 0, 0
+	}
+	return slidingWindowTiming(current, previous, elapsed, s.config)
+}
+
+// take rolls the fixed windows over and counts a new hit, flagging the store as limited
+// (without counting the hit) when the estimated count reached MaxRequests
+func (s *InMemorySlidingWindowCounterStore) take() {
+	now := s.clock.Now()
+	window, elapsed := slidingWindow(now, s.config.Window())
+	if window == s.window+1 {
+		s.previous, s.current = s.current, 0
+	} else if window != s.window {
+		s.previous, s.current = 0, 0
+	}
+	s.window = window
+	s.lastHit = now
+	if slidingWindowEstimate(s.current, s.previous, elapsed)+1 > float64(s.config.MaxRequests) {
+		s.limited = true
+		return
+	}
+	s.current++
+	s.limited = false
+}
+
+// slidingWindow returns the index of the fixed window containing now, and the fraction of it
+// that has already elapsed
+func slidingWindow(now time.Time, window time.Duration) (int64, float64) {
+	nanos := now.UnixNano()
+	return nanos / int64(window), float64(nanos%int64(window)) / float64(window)
+}
+
+// slidingWindowTiming returns the time left until the counters of the current and previous windows
+// aren't weighted anymore, and until the estimated count allows a new hit
+func slidingWindowTiming(current uint, previous uint, elapsed float64, config *StoreConfig) (time.Duration, time.Duration) {
+	window := float64(config.Window())
+	max := float64(config.MaxRequests)
+	if max == 0 {
+		return 0, config.Window()
+	}
+	resetAfter := 0.0
+	if current > 0 {
+		resetAfter = (2 - elapsed) * window
+	} else if previous > 0 {
+		resetAfter = (1 - elapsed) * window
+	}
+	var retryAfter float64
+	if float64(current)+1 > max {
+		// The current counter becomes the previous one, and has to be weighted down enough
+		retryAfter = (1-elapsed)*window + math.Max(0, 1-(max-1)/float64(current))*window
+	} else if previous > 0 {
+		retryAfter = math.Max(0, 1-(max-float64(current)-1)/float64(previous)-elapsed) * window
+	}
+	// The durations are rounded up, so the estimate is under the limit once they passed
+	return time.Duration(math.Ceil(resetAfter)), time.Duration(math.Ceil(retryAfter))
+}
+
+// slidingWindowEstimate weights the previous window's count by the fraction of it that is
+// still covered by the sliding window
+func slidingWindowEstimate(current uint, previous uint, elapsed float64) float64 {
+	return float64(previous)*(1-elapsed) + float64(current)
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemorySlidingWindowLogStore_Limit(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    3,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemorySlidingWindowLogStore(config)
+	store.Hit()
+	store.Hit()
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true within the limit")
+	}
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false when the window is full")
+	}
+	if store.HitCount() != 3 {
+		t.Errorf("HitCount() returned %d, expected the rejected hit not to be logged", store.HitCount())
+	}
+}
+
+func TestInMemorySlidingWindowLogStore_Slide(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemorySlidingWindowLogStore(config)
+	store.Hit()
+	store.Hit()
+
+	// Only the oldest hit leaves the window
+	store.hits[0] = time.Now().Add(-11 * time.Second)
+	store.hits[1] = time.Now().Add(-5 * time.Second)
+	if store.HitCount() != 1 {
+		t.Errorf("HitCount() returned %d, expected 1", store.HitCount())
+	}
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true after a hit left the window")
+	}
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false with a hit still within the window")
+	}
+	if len(store.hits) != 2 {
+		t.Errorf("Log holds %d hits, expected the expired hits to be dropped", len(store.hits))
+	}
+}
+
+func TestInMemorySlidingWindowCounterStore_Weight(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    10,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemorySlidingWindowCounterStore(config)
+
+	// The hits of the previous window are weighted by the part of it still within the sliding window
+	window, elapsed := slidingWindow(time.Now(), config.Window())
+	store.window = window - 1
+	store.current = 4
+	store.previous = 0
+	store.Hit()
+	expected := uint(4*(1-elapsed)) + 1
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true while the sliding window has room")
+	}
+	if store.current != 1 || store.previous != 4 {
+		t.Errorf("Windows did not roll over, got current %d and previous %d", store.current, store.previous)
+	}
+	if count := store.HitCount(); count < expected-1 || count > expected+1 {
+		t.Errorf("HitCount() returned %d, expected about %d", count, expected)
+	}
+}
+
+func TestInMemorySlidingWindowCounterStore_Limit(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemorySlidingWindowCounterStore(config)
+	store.Hit()
+	store.Hit()
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false when the window is full")
+	}
+	if store.current != 2 {
+		t.Errorf("Window counted %d hits, expected the rejected hit not to be counted", store.current)
+	}
+
+	// Windows older than the previous one are discarded
+	store.window -= 2
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true after two windows elapsed")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	window, elapsed := slidingWindow(time.Unix(25, 0), 10*time.Second)
+	if window != 2 || elapsed != 0.5 {
+		t.Errorf("slidingWindow() returned window %d elapsed %f, expected window 2 elapsed 0.5", window, elapsed)
+	}
+}
+
+func TestSlidingWindowTiming(t *testing.T) {
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 10}
+
+	// 8 requests of the previous window weigh 4 halfway through the current one, which has 5
+	resetAfter, retryAfter := slidingWindowTiming(5, 8, 0.5, config)
+	if resetAfter != 15*time.Second {
+		t.Errorf("slidingWindowTiming() returned a reset after %s, expected the end of the next window", resetAfter)
+	}
+	if retryAfter != 0 {
+		t.Errorf("slidingWindowTiming() returned a retry after %s with room for a hit", retryAfter)
+	}
+
+	// With 6 requests, the previous window must weigh 3 to accept a new one
+	if _, retryAfter := slidingWindowTiming(6, 8, 0.5, config); retryAfter != 1250*time.Millisecond {
+		t.Errorf("slidingWindowTiming() returned a retry after %s, expected 1.25s", retryAfter)
+	}
+
+	// A full current window must weigh 9 during the next window
+	if _, retryAfter := slidingWindowTiming(10, 0, 0.5, config); retryAfter != 6*time.Second {
+		t.Errorf("slidingWindowTiming() returned a retry after %s, expected 6s", retryAfter)
+	}
+}
+
+func TestInMemorySlidingWindowStores_Refresh(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 60,
+		BlockInSeconds: 60,
+	}
+	for name, store := range map[string]AtomicStore{
+		"log":     NewInMemorySlidingWindowLogStore(config),
+		"counter": NewInMemorySlidingWindowCounterStore(config),
+	} {
+		for i := 0; i < 3; i++ {
+			store.Take()
+		}
+
+		// A refresh forgets the hits of the window and lifts the block, taking a hit
+		store.Refresh()
+		if store.IsBlocked() || store.HitCount() != 1 {
+			t.Errorf("The refreshed %s store is blocked %v with %d hits, expected a single hit", name, store.IsBlocked(), store.HitCount())
+		}
+		if result := store.Take(); result.Limited {
+			t.Errorf("Take() returned %+v after refreshing the %s store, expected it to be accepted", result, name)
+		}
+	}
+}
+
+func TestSlidingWindowTiming_RoundedUp(t *testing.T) {
+	config := &StoreConfig{MaxRequests: 3, LimitInSeconds: 10}
+
+	// A full window must weigh 2 during the next one, a third of the way through it, which a
+	// truncated RetryAfter would fall short of
+	_, retryAfter := slidingWindowTiming(3, 0, 0, config)
+	elapsed := float64(retryAfter-config.Window()) / float64(config.Window())
+	if estimate := slidingWindowEstimate(0, 3, elapsed); estimate+1 > float64(config.MaxRequests) {
+		t.Errorf("The estimate is %.10f once the RetryAfter of %s passed, expected room for a hit", estimate, retryAfter)
+	}
+}
@@ -119,3 +119,59 @@ func TestInMemoryStore_Hit(t *testing.T) {
 		t.Error("Hit() did not set isBlocked")
 	}
 }
+
+func TestInMemoryStore_TakeWithoutBlock(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryStore(config)
+	store.Take()
+	store.Take()
+
+	// The hits over the limit are limited without blocking the key, and only the first one is
+	// counted, so the following ones don't extend the window
+	if result := store.Take(); !result.Limited || result.Blocked || result.HitCount != 3 {
+		t.Errorf("Take() returned %+v over the limit, expected it to be limited without a block", result)
+	}
+	lastHit := time.Now().Add(-5 * time.Second)
+	store.lastHit = lastHit
+	for i := 0; i < 2; i++ {
+		if result := store.Take(); !result.Limited || result.Blocked || result.RemainingBlockTime != 0 {
+			t.Errorf("Take() returned %+v over the limit, expected it to be limited without a block", result)
+		}
+	}
+	if store.IsBlocked() || store.HitCount() != 3 || !store.LastHit().Equal(lastHit) {
+		t.Errorf("The store is blocked %v with %d hits, last hit at %s", store.IsBlocked(), store.HitCount(), store.LastHit())
+	}
+}
+
+func TestInMemoryStore_Expiry(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 10,
+		BlockInSeconds: 30,
+	}
+	store := NewInMemoryStore(config)
+	for i := 0; i < 3; i++ {
+		store.Take()
+	}
+	store.lastHit = time.Now().Add(-10 * time.Second)
+	if remaining := store.RemainingBlockTime(); remaining != 20 {
+		t.Errorf("RemainingBlockTime() returned %d, expected 20", remaining)
+	}
+
+	// Neither the block nor the hits are reported once the block is over
+	store.lastHit = time.Now().Add(-100 * time.Second)
+	if remaining := store.RemainingBlockTime(); remaining != 0 {
+		t.Errorf("RemainingBlockTime() returned %d after the block, expected 0", remaining)
+	}
+	if hitCount := store.HitCount(); hitCount != 0 {
+		t.Errorf("HitCount() returned %d after the window expired, expected 0", hitCount)
+	}
+	store.Refresh()
+	if remaining := store.RemainingBlockTime(); remaining != 0 {
+		t.Errorf("RemainingBlockTime() returned %d for an unblocked store, expected 0", remaining)
+	}
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// InMemoryTokenBucketStore implements the token bucket algorithm: the bucket holds up to
+// MaxRequests tokens, each request takes one and tokens are refilled continuously at
+// MaxRequests per LimitInSeconds (fractional tokens included).
+type InMemoryTokenBucketStore struct {
+	inMemoryBlock
+	config  *StoreConfig
+	tokens  float64
+	lastHit time.Time
+	limited bool
+}
+
+func NewInMemoryTokenBucketStore(config *StoreConfig) *InMemoryTokenBucketStore {
+	return &InMemoryTokenBucketStore{
+		inMemoryBlock: newInMemoryBlock(config),
+		config:        config,
+		tokens:        float64(config.MaxRequests),
+		lastHit:       config.clock().Now(),
+	}
+}
+
+func (s *InMemoryTokenBucketStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *InMemoryTokenBucketStore) Take() Result {
+	return s.decide(s, s.config, func() bool {
+		s.take()
+		return s.limited
+	})
+}
+
+type tokenBucketState struct {
+	blockState
+	Tokens  float64   `json:"tokens"`
+	LastHit time.Time `json:"lastHit"`
+}
+
+func (s *InMemoryTokenBucketStore) MarshalState() ([]byte, error) {
+	return json.Marshal(tokenBucketState{s.state(), s.tokens, s.lastHit})
+}
+
+func (s *InMemoryTokenBucketStore) RestoreState(data []byte) error {
+	var state tokenBucketState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	s.restore(state.blockState)
+	s.tokens, s.lastHit = state.Tokens, state.LastHit
+	return nil
+}
+
+func (s *InMemoryTokenBucketStore) ShouldLimit() bool {
+	return s.limited
+}
+
+// ShouldRefresh always returns false, as the bucket is refilled on every hit
+func (s *InMemoryTokenBucketStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh fills the bucket and forgets the block, and takes a hit
+func (s *InMemoryTokenBucketStore) Refresh() {
+	s.unblock()
+	s.tokens = float64(s.config.MaxRequests)
+	s.take()
+}
+
+func (s *InMemoryTokenBucketStore) Expired(now time.Time) bool {
+	return s.expired(s, now)
+}
+
+func (s *InMemoryTokenBucketStore) Block() {
+	s.block(s.config)
+}
+
+func (s *InMemoryTokenBucketStore) Hit() {
+	s.take()
+}
+
+func (s *InMemoryTokenBucketStore) LastHit() time.Time {
+	return s.lastHit
+}
+
+// HitCount returns the amount of tokens currently taken from the bucket
+func (s *InMemoryTokenBucketStore) HitCount() uint {
+	taken := float64(s.config.MaxRequests) - s.tokensAt(s.clock.Now())
+	if taken <= 0 {
+		return 0
+	}
+	return uint(math.Ceil(taken))
+}
+
+func (s *InMemoryTokenBucketStore) timing(now time.Time) (time.Duration, time.Duration) {
+	rate := s.config.RefillRate()
+	if rate == 0 {
+		return 0, s.config.Window()
+	}
+	tokens := s.tokensAt(now)
+	// The durations are rounded up, so the tokens are refilled once they passed
+	untilTokens := func(n float64) time.Duration {
+		return time.Duration(math.Ceil((n - tokens) / rate * float64(time.Second)))
+	}
+	return untilTokens(float64(s.config.MaxRequests)), untilTokens(1)
+}
+
+// tokensAt returns the tokens of the bucket refilled as of now
+func (s *InMemoryTokenBucketStore) tokensAt(now time.Time) float64 {
+	return math.Min(float64(s.config.MaxRequests), s.tokens+positive(now.Sub(s.lastHit)).Seconds()*s.config.RefillRate())
+}
+
+// take refills the bucket with the tokens accrued since the last hit and then takes a token
+// from it, flagging the store as limited when the bucket is empty
+func (s *InMemoryTokenBucketStore) take() {
+	now := s.clock.Now()
+	s.tokens = s.tokensAt(now)
+	s.lastHit = now
+	if s.tokens < 1 {
+		s.limited = true
+		return
+	}
+	s.tokens--
+	s.limited = false
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryTokenBucketStore_Burst(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    3,
+		LimitInSeconds: 60,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+
+	if result := store.Take(); result.Limited || result.HitCount != 1 {
+		t.Errorf("Take() returned %+v for the first request", result)
+	}
+	store.Hit()
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true within the bucket capacity")
+	}
+	if store.HitCount() != 3 {
+		t.Errorf("HitCount() returned %d, expected 3", store.HitCount())
+	}
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false when the bucket is empty")
+	}
+}
+
+func TestInMemoryTokenBucketStore_FractionalRefill(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 1,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+	store.Hit()
+	store.Hit()
+
+	// Half a second refills a single token at 2 tokens per second
+	store.lastHit = time.Now().Add(-500 * time.Millisecond)
+	store.Hit()
+	if store.ShouldLimit() {
+		t.Error("ShouldLimit() returned true after a token was refilled")
+	}
+
+	// A quarter of a second only refills half a token
+	store.lastHit = time.Now().Add(-250 * time.Millisecond)
+	store.Hit()
+	if !store.ShouldLimit() {
+		t.Error("ShouldLimit() returned false with less than a token in the bucket")
+	}
+	if store.tokens < 0.4 || store.tokens > 0.6 {
+		t.Errorf("Rejected hit changed the bucket to %f tokens, expected 0.5", store.tokens)
+	}
+}
+
+func TestInMemoryTokenBucketStore_RefillIsCapped(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 1,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+
+	store.lastHit = time.Now().Add(-100 * time.Second)
+	store.Hit()
+	if store.tokens != 1 {
+		t.Errorf("Bucket refilled to %f tokens, expected it to be capped at 2 before the hit", store.tokens+1)
+	}
+}
+
+func TestInMemoryTokenBucketStore_Block(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    1,
+		LimitInSeconds: 1,
+		BlockInSeconds: 60,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+
+	store.Block()
+	if !store.IsBlocked() {
+		t.Error("Block() did not block the store")
+	}
+	if store.RemainingBlockTime() != 60 {
+		t.Errorf("RemainingBlockTime() returned %d, expected 60", store.RemainingBlockTime())
+	}
+
+	store.blockedUntil = time.Now().Add(-time.Second)
+	if store.IsBlocked() {
+		t.Error("IsBlocked() returned true after the block duration")
+	}
+}
+
+func TestInMemoryTokenBucketStore_Timing(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 1,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+	store.Take()
+	result := store.Take()
+	if result.ResetAfter < 990*time.Millisecond || result.ResetAfter > time.Second {
+		t.Errorf("Take() returned a reset after %s, expected the bucket to be full again in 1s", result.ResetAfter)
+	}
+	result = store.Take()
+	if !result.Limited || result.RetryAfter < 490*time.Millisecond || result.RetryAfter > 500*time.Millisecond {
+		t.Errorf("Take() returned %+v, expected a token to be refilled in 500ms", result)
+	}
+}
+
+func TestInMemoryTokenBucketStore_HitCountRefills(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 1,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+	store.Hit()
+	store.Hit()
+
+	// The tokens refilled since the last hit aren't counted as taken anymore
+	store.lastHit = time.Now().Add(-500 * time.Millisecond)
+	if hitCount := store.HitCount(); hitCount != 1 {
+		t.Errorf("HitCount() returned %d half a second after the bucket was emptied, expected 1", hitCount)
+	}
+	store.lastHit = time.Now().Add(-time.Second)
+	if hitCount := store.HitCount(); hitCount != 0 {
+		t.Errorf("HitCount() returned %d once the bucket was full again, expected 0", hitCount)
+	}
+}
+
+func TestInMemoryTokenBucketStore_Refresh(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 60,
+		BlockInSeconds: 60,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+	for i := 0; i < 3; i++ {
+		store.Take()
+	}
+
+	// A refresh fills the bucket back and lifts the block, taking a hit
+	store.Refresh()
+	if store.IsBlocked() || store.HitCount() != 1 {
+		t.Errorf("The refreshed store is blocked %v with %d hits, expected a single hit", store.IsBlocked(), store.HitCount())
+	}
+	if result := store.Take(); result.Limited {
+		t.Errorf("Take() returned %+v after a refresh, expected it to be accepted", result)
+	}
+}
+
+func TestInMemoryTokenBucketStore_RetryAfterIsRoundedUp(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    3,
+		LimitInSeconds: 10,
+		BlockInSeconds: 0,
+	}
+	store := NewInMemoryTokenBucketStore(config)
+	now := time.Now()
+	store.tokens, store.lastHit = 0, now
+
+	// A token is refilled every 3.33...s, which a truncated RetryAfter would fall short of
+	_, retryAfter := store.timing(now)
+	if tokens := store.tokensAt(now.Add(retryAfter)); tokens < 1 {
+		t.Errorf("The bucket holds %.10f tokens once the RetryAfter of %s passed, expected a whole token", tokens, retryAfter)
+	}
+}
@@ -2,136 +2,135 @@ package store
 
 import (
 	"context"
-	"strconv"
 	"time"
 
-	"github.com/eliasfeijo/go-rate-limiter/config"
 	"github.com/eliasfeijo/go-rate-limiter/log"
 	"github.com/redis/go-redis/v9"
 )
 
-var rdb *redis.Client
-
+// RedisStore implements the fixed window algorithm on Redis. Its decisions are taken atomically
+// by Take, so it doesn't count the first hit when created, unlike InMemoryStore.
 type RedisStore struct {
+	redisBlock
 	config *StoreConfig
+	clock  Clock
 	key    string
-	ctx    context.Context
+	result Result
 }
 
-func CreateRedisClient() {
-	if rdb != nil {
-		return
-	}
-	cfg := config.GetConfig()
-	rdb = redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisConfig.Host + ":" + cfg.RedisConfig.Port,
-		Password: cfg.RedisConfig.Password,
-		DB:       cfg.RedisConfig.DB,
-	})
-	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		panic(err)
-	}
-	log.Log(log.Info, "Redis connection created successfully: ", rdb)
+func NewRedisStore(client redis.UniversalClient, ip string, token string, config *StoreConfig) *RedisStore {
+	key := redisKey(ip, token)
+	return &RedisStore{redisBlock: redisBlock{client, key + ":isBlocked"}, config: config, clock: config.clock(), key: key}
 }
 
-func NewRedisStore(ip string, token string, config *StoreConfig) *RedisStore {
-	ctx := context.Background()
-	key := ip + ":" + token
-	rdb.Set(ctx, key+":hitCount", 1, 0)
-	rdb.Set(ctx, key+":lastHit", time.Now().Unix(), 0)
-	rdb.Set(ctx, key+":isBlocked", false, 0)
-	return &RedisStore{config, key, ctx}
+func (s *RedisStore) SetConfig(config *StoreConfig) {
+	s.config = config
 }
 
-func (s *RedisStore) ShouldLimit() bool {
-	hitCountString, err := rdb.Get(s.ctx, s.key+":hitCount").Result()
-	if err != nil {
-		hitCountString = "0"
-	}
-	hitCount, err := strconv.ParseUint(hitCountString, 10, 64)
-	if err != nil {
-		panic(err)
-	}
-	return uint(hitCount) > s.config.MaxRequests
+func (s *RedisStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
 }
 
-func (s *RedisStore) ShouldRefresh() bool {
-	isBlocked, _ := rdb.Get(s.ctx, s.key+":isBlocked").Result()
-	if isBlocked == "true" {
-		return true
-	}
+func (s *RedisStore) TakeContext(ctx context.Context) (Result, error) {
+	result, err := takeResult(runScript(
+		ctx,
+		s.client,
+		fixedWindowScript,
+		[]string{s.key + ":hitCount", s.key + ":lastHit", s.key + ":isBlocked"},
+		scriptNow(s.clock),
+		s.config.MaxRequests,
+		s.config.Window().Milliseconds(),
+		s.config.BlockInSeconds*1000,
+	))
+	s.result = result
+	return result, err
+}
 
-	lastHitString, err := rdb.Get(s.ctx, s.key+":lastHit").Result()
-	if err != nil {
-		lastHitString = "0"
-	}
-	lastHit, err := strconv.ParseInt(lastHitString, 10, 64)
-	if err != nil {
-		panic(err)
-	}
+// ShouldLimit returns whether the last hit was limited
+func (s *RedisStore) ShouldLimit() bool {
+	return s.result.Limited
+}
 
-	return uint(time.Now().Unix()-lastHit) > s.config.LimitInSeconds
+// ShouldRefresh always returns false, as the window is started and expired by Take
+func (s *RedisStore) ShouldRefresh() bool {
+	return false
 }
 
+// Refresh starts a new window
 func (s *RedisStore) Refresh() {
-	rdb.Set(s.ctx, s.key+":hitCount", 1, 0)
-	rdb.Set(s.ctx, s.key+":lastHit", time.Now().Unix(), 0)
-	rdb.Set(s.ctx, s.key+":isBlocked", false, 0)
+	logFailure(s.RefreshContext(context.Background()))
 }
 
-func (s *RedisStore) IsBlocked() bool {
-	isBlockedString, err := rdb.Get(s.ctx, s.key+":isBlocked").Result()
-	if err != nil {
-		isBlockedString = "false"
-	}
-	isBlocked, err := strconv.ParseBool(isBlockedString)
-	if err != nil {
-		panic(err)
-	}
-	return isBlocked
+func (s *RedisStore) RefreshContext(ctx context.Context) error {
+	return s.client.Del(ctx, s.key+":hitCount", s.key+":isBlocked").Err()
 }
 
-func (s *RedisStore) RemainingBlockTime() uint {
-	expDuration, err := rdb.ExpireTime(s.ctx, s.key+":isBlocked").Result()
-	if err != nil {
-		expDuration = time.Duration(0) * time.Second
-	}
-	exp := expDuration.Seconds()
-	return uint(exp) - uint(time.Now().Unix())
+func (s *RedisStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
 }
 
-func (s *RedisStore) Block() {
-	rdb.Set(s.ctx, s.key+":isBlocked", true, time.Duration(s.config.BlockInSeconds)*time.Second)
+func (s *RedisStore) BlockContext(ctx context.Context) error {
+	return s.block(ctx, s.config)
+}
+
+// Expired always returns true, as the state is kept (and expired) by Redis
+func (s *RedisStore) Expired(now time.Time) bool {
+	return true
 }
 
 func (s *RedisStore) Hit() {
-	rdb.Incr(s.ctx, s.key+":hitCount")
-	rdb.Set(s.ctx, s.key+":lastHit", time.Now().Unix(), 0)
-	if s.ShouldLimit() {
-		s.Block()
-	}
+	s.Take()
 }
 
 func (s *RedisStore) LastHit() time.Time {
-	lastHitString, err := rdb.Get(s.ctx, s.key+":lastHit").Result()
-	if err != nil {
-		lastHitString = "0"
-	}
-	lastHit, err := strconv.ParseInt(lastHitString, 10, 64)
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *RedisStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	lastHit, err := getInt(ctx, s.client, s.key+":lastHit")
 	if err != nil {
-		panic(err)
+		return time.Time{}, err
 	}
-	return time.Unix(lastHit, 0)
+	return time.UnixMilli(lastHit), nil
 }
 
 func (s *RedisStore) HitCount() uint {
-	hitCountString, err := rdb.Get(s.ctx, s.key+":hitCount").Result()
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *RedisStore) HitCountContext(ctx context.Context) (uint, error) {
+	hitCount, err := getInt(ctx, s.client, s.key+":hitCount")
+	return uint(hitCount), err
+}
+
+// takeResult returns the result of a script, or a result holding its error when it failed, which
+// the limiter handles according to its failure policy
+func takeResult(result Result, err error) (Result, error) {
 	if err != nil {
-		hitCountString = "0"
+		return Result{Err: err}, err
 	}
-	hitCount, err := strconv.ParseUint(hitCountString, 10, 64)
+	return result, nil
+}
+
+// getInt returns the integer value of a key, which is 0 when the key doesn't exist
+func getInt(ctx context.Context, client redis.UniversalClient, key string) (int64, error) {
+	value, err := client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return value, err
+}
+
+// logged returns the value of a ContextStore operation run by its Store counterpart, logging its
+// error instead of returning it
+func logged[T any](value T, err error) T {
+	logFailure(err)
+	return value
+}
+
+// logFailure logs the error of a ContextStore operation run by its Store counterpart
+func logFailure(err error) {
 	if err != nil {
-		panic(err)
+		log.Logf(log.Error, "Store error: %s", err)
 	}
-	return uint(hitCount)
 }
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RedisStandaloneMode connects to a single Redis server
+	RedisStandaloneMode = "standalone"
+	// RedisSentinelMode connects to the master monitored by Redis Sentinel, following its failovers
+	RedisSentinelMode = "sentinel"
+	// RedisClusterMode connects to a Redis Cluster through its seed nodes
+	RedisClusterMode = "cluster"
+)
+
+// NewRedisClient creates a client for the Redis server, sentinels or cluster of the config. It
+// connects lazily, see PingRedis.
+func NewRedisClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	options, err := redisOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Mode {
+	case RedisSentinelMode:
+		return redis.NewFailoverClient(options.Failover()), nil
+	case RedisClusterMode:
+		return redis.NewClusterClient(options.Cluster()), nil
+	default:
+		return redis.NewClient(options.Simple()), nil
+	}
+}
+
+// PingRedis checks that Redis is reachable, and loads the scripts of the stores
+func PingRedis(ctx context.Context, client redis.UniversalClient) error {
+	if err := client.Ping(ctx).Err(); err != nil {
+		return err
+	}
+	return LoadScripts(ctx, client)
+}
+
+// redisOptions returns the client options of the config
+func redisOptions(cfg config.RedisConfig) (*redis.UniversalOptions, error) {
+	options := &redis.UniversalOptions{
+		Addrs:            cfg.Addresses,
+		MasterName:       cfg.SentinelMaster,
+		SentinelPassword: cfg.SentinelPassword,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+	}
+	if len(options.Addrs) == 0 {
+		options.Addrs = []string{cfg.Host + ":" + cfg.Port}
+	}
+	switch cfg.Mode {
+	case "", RedisStandaloneMode:
+		if len(options.Addrs) > 1 {
+			return nil, errors.New("a standalone Redis server has a single address")
+		}
+	case RedisSentinelMode:
+		if cfg.SentinelMaster == "" {
+			return nil, errors.New("the sentinel master name is missing")
+		}
+	case RedisClusterMode:
+		if cfg.DB != 0 {
+			return nil, errors.New("Redis Cluster only supports the database 0")
+		}
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q", cfg.Mode)
+	}
+	if cfg.TLS {
+		tlsConfig, err := redisTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		options.TLSConfig = tlsConfig
+	}
+	return options, nil
+}
+
+// redisTLSConfig returns the TLS config of the config, trusting its CA certificates (or the
+// system's ones) and presenting its client certificate, if any
+func redisTLSConfig(cfg config.RedisConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCAFile)
+		}
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+var hashTagEscaper = strings.NewReplacer("%", "%25", "{", "%7B", "}", "%7D")
+
+// redisKey returns the prefix of the keys of an ip and token's store. It's a hash tag, so all the
+// keys accessed by a script are in the same Redis Cluster slot, with the braces of the ip and token
+// escaped so they can't end it early.
+func redisKey(ip string, token string) string {
+	return "{" + hashTagEscaper.Replace(ip) + ":" + hashTagEscaper.Replace(token) + "}"
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewRedisClient(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("limiter", "secret")
+	host, port, _ := strings.Cut(server.Addr(), ":")
+	client, err := NewRedisClient(config.RedisConfig{Host: host, Port: port, Username: "limiter", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, ok := client.(*redis.Client); !ok {
+		t.Errorf("NewRedisClient() returned a %T, expected a *redis.Client", client)
+	}
+	if err := PingRedis(context.Background(), client); err != nil {
+		t.Error(err)
+	}
+
+	client, err = NewRedisClient(config.RedisConfig{Host: host, Port: port, Username: "limiter", Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := PingRedis(context.Background(), client); err == nil {
+		t.Error("PingRedis() connected with a wrong password")
+	}
+}
+
+func TestRedisOptions(t *testing.T) {
+	options, err := redisOptions(config.RedisConfig{
+		Mode:           RedisSentinelMode,
+		Addresses:      []string{"sentinel-1:26379", "sentinel-2:26379"},
+		SentinelMaster: "mymaster",
+		TLS:            true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failover := options.Failover(); failover.MasterName != "mymaster" || len(failover.SentinelAddrs) != 2 || failover.TLSConfig == nil {
+		t.Errorf("Sentinel options returned %+v", failover)
+	}
+
+	options, err = redisOptions(config.RedisConfig{Mode: RedisClusterMode, Host: "node-1", Port: "6379"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster := options.Cluster(); len(cluster.Addrs) != 1 || cluster.Addrs[0] != "node-1:6379" {
+		t.Errorf("Cluster options returned the seed nodes %v, expected the host and port", cluster.Addrs)
+	}
+
+	for name, invalid := range map[string]config.RedisConfig{
+		"unknown mode":                 {Mode: "replicated"},
+		"sentinel without master":      {Mode: RedisSentinelMode},
+		"cluster with a database":      {Mode: RedisClusterMode, DB: 1},
+		"standalone with many servers": {Addresses: []string{"a:6379", "b:6379"}},
+		"missing CA file":              {TLS: true, TLSCAFile: "missing.pem"},
+	} {
+		if _, err := redisOptions(invalid); err == nil {
+			t.Errorf("Expected an error for a %s", name)
+		}
+	}
+}
+
+func TestRedisKey(t *testing.T) {
+	server, client := setupRedis(t)
+	config := &StoreConfig{MaxRequests: 1, LimitInSeconds: 60, BlockInSeconds: 60}
+	ip := "}{weird%key"
+	stores := []AtomicStore{
+		NewRedisStore(client, ip, "abc123", config),
+		NewRedisTokenBucketStore(client, ip, "abc123", config),
+		NewRedisSlidingWindowLogStore(client, ip, "abc123", config),
+		NewRedisSlidingWindowCounterStore(client, ip, "abc123", config),
+		NewRedisGCRAStore(client, ip, "abc123", config),
+		NewRedisLeakyBucketStore(client, ip, "abc123", config),
+	}
+	for _, store := range stores {
+		store.Take()
+		store.Take()
+	}
+
+	// Every key has the same non-empty hash tag, so they're all in the same Redis Cluster slot
+	tag := redisKey(ip, "abc123")
+	if tag != "{%7D%7Bweird%25key:abc123}" {
+		t.Errorf("redisKey() returned %s", tag)
+	}
+	for _, key := range server.Keys() {
+		if !strings.HasPrefix(key, tag) {
+			t.Errorf("Key %s is not prefixed by the hash tag %s", key, tag)
+		}
+	}
+	if len(server.Keys()) < len(stores) {
+		t.Errorf("Found the keys %v, expected at least one per store", server.Keys())
+	}
+}
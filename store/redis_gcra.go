@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisGCRAStore is the Redis backed version of InMemoryGCRAStore. Its whole state is kept in a
+// single hash key holding the TAT and the block deadline (both in milliseconds), which expires
+// once neither of them is in the future anymore. Its decisions are taken atomically by Take.
+type RedisGCRAStore struct {
+	client redis.UniversalClient
+	config *StoreConfig
+	clock  Clock
+	key    string
+	result Result
+}
+
+func NewRedisGCRAStore(client redis.UniversalClient, ip string, token string, config *StoreConfig) *RedisGCRAStore {
+	return &RedisGCRAStore{client: client, config: config, clock: config.clock(), key: redisKey(ip, token) + ":gcra"}
+}
+
+func (s *RedisGCRAStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *RedisGCRAStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+func (s *RedisGCRAStore) TakeContext(ctx context.Context) (Result, error) {
+	result, err := takeResult(runScript(
+		ctx,
+		s.client,
+		gcraScript,
+		[]string{s.key},
+		scriptNow(s.clock),
+		s.config.MaxRequests,
+		s.config.Window().Milliseconds(),
+		s.config.BlockInSeconds*1000,
+		s.config.EmissionInterval().Milliseconds(),
+	))
+	s.result = result
+	return result, err
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *RedisGCRAStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the TAT is updated on every hit
+func (s *RedisGCRAStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh resets the TAT and lifts the block
+func (s *RedisGCRAStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *RedisGCRAStore) RefreshContext(ctx context.Context) error {
+	return s.client.Del(ctx, s.key).Err()
+}
+
+func (s *RedisGCRAStore) IsBlocked() bool {
+	return logged(s.IsBlockedContext(context.Background()))
+}
+
+func (s *RedisGCRAStore) IsBlockedContext(ctx context.Context) (bool, error) {
+	_, blockedUntil, err := s.state(ctx)
+	return s.clock.Now().Before(blockedUntil), err
+}
+
+func (s *RedisGCRAStore) RemainingBlockTime() uint {
+	return logged(s.RemainingBlockTimeContext(context.Background()))
+}
+
+func (s *RedisGCRAStore) RemainingBlockTimeContext(ctx context.Context) (uint, error) {
+	_, blockedUntil, err := s.state(ctx)
+	remaining := blockedUntil.Sub(s.clock.Now())
+	if remaining <= 0 {
+		return 0, err
+	}
+	return uint(math.Ceil(remaining.Seconds())), err
+}
+
+func (s *RedisGCRAStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *RedisGCRAStore) BlockContext(ctx context.Context) error {
+	if s.config.BlockInSeconds == 0 {
+		return nil
+	}
+	tat, _, err := s.state(ctx)
+	if err != nil {
+		return err
+	}
+	blockedUntil := s.clock.Now().Add(time.Duration(s.config.BlockInSeconds) * time.Second)
+	if blockedUntil.After(tat) {
+		tat = blockedUntil
+	}
+	if err := s.client.HSet(ctx, s.key, "blockedUntil", blockedUntil.UnixMilli()).Err(); err != nil {
+		return err
+	}
+	return s.client.PExpire(ctx, s.key, tat.Sub(s.clock.Now())).Err()
+}
+
+// Expired always returns true, as the state is kept (and expired) by Redis
+func (s *RedisGCRAStore) Expired(now time.Time) bool {
+	return true
+}
+
+func (s *RedisGCRAStore) Hit() {
+	s.Take()
+}
+
+// LastHit returns the arrival time of the last accepted request, as if requests were evenly spaced
+func (s *RedisGCRAStore) LastHit() time.Time {
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *RedisGCRAStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	tat, _, err := s.state(ctx)
+	return tat.Add(-s.config.EmissionInterval()), err
+}
+
+// HitCount returns the amount of requests that are still counted against the limit
+func (s *RedisGCRAStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *RedisGCRAStore) HitCountContext(ctx context.Context) (uint, error) {
+	tat, _, err := s.state(ctx)
+	return gcraHitCount(tat.Sub(s.clock.Now()), s.config), err
+}
+
+// ResetAfter returns the time left until the limit is fully available again
+func (s *RedisGCRAStore) ResetAfter() time.Duration {
+	tat, _, err := s.state(context.Background())
+	logFailure(err)
+	return positive(tat.Sub(s.clock.Now()))
+}
+
+// state returns the TAT and the block deadline, which are zero when they are not set
+func (s *RedisGCRAStore) state(ctx context.Context) (time.Time, time.Time, error) {
+	values, err := s.client.HMGet(ctx, s.key, "tat", "blockedUntil").Result()
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	times := make([]time.Time, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		millis, err := strconv.ParseInt(value.(string), 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		times[i] = time.UnixMilli(millis)
+	}
+	return times[0], times[1], nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisLeakyBucketStore is the Redis backed version of InMemoryLeakyBucketStore, so the queue
+// is shared by all the instances. Its decisions are taken atomically by Take, which doesn't block
+// the key when the queue overflows.
+type RedisLeakyBucketStore struct {
+	redisBlock
+	config *StoreConfig
+	clock  Clock
+	key    string
+	result Result
+}
+
+func NewRedisLeakyBucketStore(client redis.UniversalClient, ip string, token string, config *StoreConfig) *RedisLeakyBucketStore {
+	key := redisKey(ip, token) + ":leakyBucket"
+	return &RedisLeakyBucketStore{redisBlock: redisBlock{client, key + ":isBlocked"}, config: config, clock: config.clock(), key: key}
+}
+
+func (s *RedisLeakyBucketStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *RedisLeakyBucketStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+func (s *RedisLeakyBucketStore) TakeContext(ctx context.Context) (Result, error) {
+	result, err := takeResult(runScript(
+		ctx,
+		s.client,
+		leakyBucketScript,
+		[]string{s.key, s.key + ":isBlocked"},
+		scriptNow(s.clock),
+		s.config.MaxRequests,
+		s.config.EmissionInterval().Milliseconds(),
+		s.config.MaxWaitInSeconds*1000,
+	))
+	s.result = result
+	return result, err
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *RedisLeakyBucketStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the bucket leaks on every hit
+func (s *RedisLeakyBucketStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh empties the queue
+func (s *RedisLeakyBucketStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *RedisLeakyBucketStore) RefreshContext(ctx context.Context) error {
+	return s.client.Del(ctx, s.key, s.key+":isBlocked").Err()
+}
+
+func (s *RedisLeakyBucketStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *RedisLeakyBucketStore) BlockContext(ctx context.Context) error {
+	return s.block(ctx, s.config)
+}
+
+// Expired always returns true, as the state is kept (and expired) by Redis
+func (s *RedisLeakyBucketStore) Expired(now time.Time) bool {
+	return true
+}
+
+func (s *RedisLeakyBucketStore) Hit() {
+	s.Take()
+}
+
+// LastHit returns the release time of the last queued request
+func (s *RedisLeakyBucketStore) LastHit() time.Time {
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *RedisLeakyBucketStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	nextRelease, err := s.nextRelease(ctx)
+	return nextRelease.Add(-s.config.EmissionInterval()), err
+}
+
+// HitCount returns the amount of requests waiting in the queue
+func (s *RedisLeakyBucketStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *RedisLeakyBucketStore) HitCountContext(ctx context.Context) (uint, error) {
+	nextRelease, err := s.nextRelease(ctx)
+	return leakyBucketQueued(nextRelease.Sub(s.clock.Now()), s.config), err
+}
+
+// Delay returns how long the last accepted hit must wait before being handled
+func (s *RedisLeakyBucketStore) Delay() time.Duration {
+	return s.result.Delay
+}
+
+// nextRelease returns the release time of the next request, which is zero when the queue is empty
+func (s *RedisLeakyBucketStore) nextRelease(ctx context.Context) (time.Time, error) {
+	nextRelease, err := s.client.Get(ctx, s.key).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(nextRelease), nil
+}
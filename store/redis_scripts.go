@@ -0,0 +1,349 @@
+package store
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The scripts take a whole limiter decision atomically on the Redis server. They all take it as of
+// the time of the Redis server, so the instances whose clocks are skewed agree on the windows,
+// unless they receive a time in milliseconds as their first argument (see scriptNow). They reply
+// with an array of
+// {limited, blocked, hit count, remaining block time in ms, delay in ms, reset after ms, retry after ms}.
+
+// nowScript sets now to the time in milliseconds of the first argument, or of the Redis server when
+// it's empty. The commands of the scripts are replicated rather than the scripts, which read the
+// time (required before Redis 5).
+const nowScript = `
+redis.replicate_commands()
+local now = tonumber(ARGV[1])
+if not now then
+	local time = redis.call('TIME')
+	now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+end
+`
+
+// fixedWindowScript counts a hit in the window started by the first one. Like the in-memory store,
+// the hits over the limit aren't counted once it's exceeded.
+// KEYS: hitCount, lastHit, isBlocked. ARGV: now, max requests, window ms, block ms.
+var fixedWindowScript = redis.NewScript(nowScript + `
+local max = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local block = tonumber(ARGV[4])
+local blockTtl = redis.call('PTTL', KEYS[3])
+if blockTtl > 0 then
+	return {1, 1, tonumber(redis.call('GET', KEYS[1]) or max + 1), blockTtl, 0, blockTtl, blockTtl}
+elseif blockTtl == -1 then
+	-- Keys written without a TTL (e.g.: by older versions) would never expire
+	redis.call('DEL', KEYS[3])
+end
+local count = tonumber(redis.call('GET', KEYS[1]) or 0)
+if count > max then
+	local reset = redis.call('PTTL', KEYS[1])
+	if reset == -1 then
+		redis.call('PEXPIRE', KEYS[1], window)
+		reset = window
+	end
+	reset = math.max(reset, 0)
+	return {1, 0, count, 0, 0, reset, reset}
+end
+count = redis.call('INCR', KEYS[1])
+if count == 1 or redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], window)
+end
+redis.call('SET', KEYS[2], now, 'PX', window)
+local reset = math.max(redis.call('PTTL', KEYS[1]), 0)
+if count <= max then
+	return {0, 0, count, 0, 0, reset, 0}
+end
+if block > 0 then
+	redis.call('SET', KEYS[3], 'true', 'PX', block)
+	-- A new window starts once the block is lifted
+	redis.call('PEXPIRE', KEYS[1], block)
+	return {1, 1, count, block, 0, block, block}
+end
+return {1, 0, count, 0, 0, reset, reset}
+`)
+
+// tokenBucketScript refills the bucket and takes a token from it.
+// KEYS: bucket hash (tokens, lastHit), isBlocked. ARGV: now, capacity, tokens per ms, block ms.
+var tokenBucketScript = redis.NewScript(nowScript + `
+local capacity = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local block = tonumber(ARGV[4])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'lastHit')
+local tokens = tonumber(state[1]) or capacity
+local lastHit = tonumber(state[2]) or now
+local blockTtl = redis.call('PTTL', KEYS[2])
+if blockTtl > 0 then
+	return {1, 1, math.ceil(capacity - tokens), blockTtl, 0, blockTtl, blockTtl}
+end
+tokens = math.min(capacity, tokens + math.max(0, now - lastHit) * rate)
+local limited = 1
+if tokens >= 1 then
+	tokens = tokens - 1
+	limited = 0
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'lastHit', now)
+local reset, retry = 0, 0
+if rate > 0 then
+	reset = math.ceil((capacity - tokens) / rate)
+	retry = math.max(math.ceil((1 - tokens) / rate), 0)
+end
+-- The bucket is useless once it's full again (right away when it has no capacity)
+redis.call('PEXPIRE', KEYS[1], reset + 1)
+if limited == 1 and block > 0 then
+	redis.call('SET', KEYS[2], 'true', 'PX', block)
+	return {1, 1, math.ceil(capacity - tokens), block, 0, math.max(reset, block), math.max(retry, block)}
+end
+if limited == 0 then
+	retry = 0
+end
+return {limited, 0, math.ceil(capacity - tokens), 0, 0, reset, retry}
+`)
+
+// slidingWindowLogScript drops the hits out of the window and logs a new one.
+// KEYS: hits sorted set, isBlocked. ARGV: now, max requests, window ms, block ms, member.
+var slidingWindowLogScript = redis.NewScript(nowScript + `
+local max = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local block = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+-- The last hit has to leave the window to reset, and the max-th last one to accept a new hit
+local function leaves(rank)
+	local hit = redis.call('ZRANGE', KEYS[1], rank, rank, 'WITHSCORES')
+	if #hit == 0 then
+		return 0
+	end
+	return math.max(tonumber(hit[2]) + window - now, 0)
+end
+local blockTtl = redis.call('PTTL', KEYS[2])
+if blockTtl > 0 then
+	return {1, 1, count, blockTtl, 0, math.max(leaves(-1), blockTtl), blockTtl}
+end
+if count < max then
+	redis.call('ZADD', KEYS[1], now, ARGV[5])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return {0, 0, count + 1, 0, 0, window, 0}
+end
+local retry = window
+if max > 0 then
+	retry = leaves(count - max)
+end
+if block > 0 then
+	redis.call('SET', KEYS[2], 'true', 'PX', block)
+	return {1, 1, count, block, 0, math.max(leaves(-1), block), math.max(retry, block)}
+end
+return {1, 0, count, 0, 0, leaves(-1), retry}
+`)
+
+// slidingWindowCounterScript weights the previous window's counter and counts a hit in the current one.
+// The counter of a window is the key of the counters' prefix suffixed with the index of the window,
+// which is computed as of now so it shares its hash tag (and its cluster slot).
+// KEYS: counters prefix, lastHit, isBlocked. ARGV: now, max requests, window ms, block ms.
+var slidingWindowCounterScript = redis.NewScript(nowScript + `
+local max = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local block = tonumber(ARGV[4])
+local index = math.floor(now / window)
+local elapsed = (now % window) / window
+local currentKey = KEYS[1] .. string.format('%d', index)
+local current = tonumber(redis.call('GET', currentKey) or 0)
+local previous = tonumber(redis.call('GET', KEYS[1] .. string.format('%d', index - 1)) or 0)
+local estimate = previous * (1 - elapsed) + current
+-- The counters aren't weighted anymore once the next window ends, and the estimate must
+-- be weighted down enough to accept a new hit
+local function timing()
+	local reset, retry = 0, 0
+	if current > 0 then
+		reset = (2 - elapsed) * window
+	elseif previous > 0 then
+		reset = (1 - elapsed) * window
+	end
+	if max == 0 then
+		retry = window
+	elseif current + 1 > max then
+		retry = (1 - elapsed) * window + math.max(0, 1 - (max - 1) / current) * window
+	elseif previous > 0 then
+		retry = math.max(0, 1 - (max - current - 1) / previous - elapsed) * window
+	end
+	return math.ceil(reset), math.ceil(retry)
+end
+local blockTtl = redis.call('PTTL', KEYS[3])
+if blockTtl > 0 then
+	local reset = timing()
+	return {1, 1, math.ceil(estimate), blockTtl, 0, math.max(reset, blockTtl), blockTtl}
+end
+redis.call('SET', KEYS[2], now, 'PX', 2 * window)
+if estimate + 1 <= max then
+	current = tonumber(redis.call('INCR', currentKey))
+	-- The counter is still weighted during the next window
+	redis.call('PEXPIRE', currentKey, 2 * window)
+	local reset = timing()
+	return {0, 0, math.ceil(estimate + 1), 0, 0, reset, 0}
+end
+local reset, retry = timing()
+if block > 0 then
+	redis.call('SET', KEYS[3], 'true', 'PX', block)
+	return {1, 1, math.ceil(estimate), block, 0, math.max(reset, block), math.max(retry, block)}
+end
+return {1, 0, math.ceil(estimate), 0, 0, reset, retry}
+`)
+
+// gcraScript pushes the TAT forward by an emission interval.
+// KEYS: state hash (tat, blockedUntil). ARGV: now, max requests, window ms, block ms, emission interval ms.
+var gcraScript = redis.NewScript(nowScript + `
+local max = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local block = tonumber(ARGV[4])
+local interval = math.max(tonumber(ARGV[5]), 1)
+local state = redis.call('HMGET', KEYS[1], 'tat', 'blockedUntil')
+local tat = math.max(tonumber(state[1]) or now, now)
+local blockedUntil = tonumber(state[2]) or 0
+local hitCount = math.ceil((tat - now) / interval)
+-- The TAT has to be reached to reset, and to be close enough to accept a new hit
+local retry = window
+if max > 0 then
+	retry = math.max(tat + interval - window - now, 0)
+end
+if blockedUntil > now then
+	return {1, 1, hitCount, blockedUntil - now, 0, math.max(tat, blockedUntil) - now, math.max(retry, blockedUntil - now)}
+end
+local newTat = tat + interval
+if max > 0 and newTat - now <= window then
+	redis.call('HSET', KEYS[1], 'tat', newTat)
+	redis.call('HDEL', KEYS[1], 'blockedUntil')
+	redis.call('PEXPIRE', KEYS[1], newTat - now)
+	return {0, 0, math.ceil((newTat - now) / interval), 0, 0, newTat - now, 0}
+end
+if block > 0 then
+	redis.call('HSET', KEYS[1], 'blockedUntil', now + block)
+	redis.call('PEXPIRE', KEYS[1], math.max(tat, now + block) - now)
+	return {1, 1, hitCount, block, 0, math.max(tat - now, block), math.max(retry, block)}
+end
+return {1, 0, hitCount, 0, 0, tat - now, retry}
+`)
+
+// leakyBucketScript queues a hit behind the ones waiting to be released. The key is only blocked
+// by Block, not when the queue overflows.
+// KEYS: nextRelease, isBlocked. ARGV: now, max requests, emission interval ms, max wait ms.
+var leakyBucketScript = redis.NewScript(nowScript + `
+local max = tonumber(ARGV[2])
+local interval = math.max(tonumber(ARGV[3]), 1)
+local maxWait = tonumber(ARGV[4])
+local nextRelease = math.max(tonumber(redis.call('GET', KEYS[1]) or now), now)
+local wait = nextRelease - now
+local queued = math.ceil(wait / interval)
+-- The queue has to be empty to reset, and to have room for a new hit without holding it
+-- back longer than the max wait
+local retry = wait - (max - 1) * interval
+if maxWait > 0 then
+	retry = math.max(retry, wait - maxWait)
+end
+retry = math.max(retry, 0)
+local blockTtl = redis.call('PTTL', KEYS[2])
+if blockTtl > 0 then
+	return {1, 1, queued, blockTtl, 0, math.max(wait, blockTtl), math.max(retry, blockTtl)}
+end
+if queued < max and (maxWait == 0 or wait <= maxWait) then
+	nextRelease = nextRelease + interval
+	redis.call('SET', KEYS[1], nextRelease, 'PX', nextRelease - now)
+	return {0, 0, queued + 1, 0, wait, nextRelease - now, 0}
+end
+return {1, 0, queued, 0, 0, wait, retry}
+`)
+
+// leaseScript leases hits of a fixed window started by the first one to an instance, which counts
+// them locally. The lease is bounded by the batch size and a share of the hits left in the window.
+// KEYS: hitCount, isBlocked. ARGV: max requests, window ms, block ms, batch size, max share percent.
+// The reply is the one of the other scripts, followed by the amount of hits leased.
+var leaseScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local block = tonumber(ARGV[3])
+local batch = tonumber(ARGV[4])
+local share = tonumber(ARGV[5])
+local count = tonumber(redis.call('GET', KEYS[1]) or 0)
+local blockTtl = redis.call('PTTL', KEYS[2])
+if blockTtl > 0 then
+	return {1, 1, count, blockTtl, 0, blockTtl, blockTtl, 0}
+end
+local remaining = max - count
+if remaining <= 0 then
+	if block > 0 then
+		redis.call('SET', KEYS[2], 'true', 'PX', block)
+		-- A new window starts once the block is lifted
+		redis.call('PEXPIRE', KEYS[1], block)
+		return {1, 1, count, block, 0, block, block, 0}
+	end
+	local reset = redis.call('PTTL', KEYS[1])
+	if reset <= 0 then
+		reset = window
+	end
+	return {1, 0, count, 0, 0, reset, reset, 0}
+end
+local lease = math.max(math.min(batch, math.floor(remaining * share / 100), remaining), 1)
+count = redis.call('INCRBY', KEYS[1], lease)
+if count == lease or redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], window)
+end
+return {0, 0, count, 0, 0, math.max(redis.call('PTTL', KEYS[1]), 0), 0, lease}
+`)
+
+var scripts = []*redis.Script{
+	fixedWindowScript,
+	tokenBucketScript,
+	slidingWindowLogScript,
+	slidingWindowCounterScript,
+	gcraScript,
+	leakyBucketScript,
+	leaseScript,
+}
+
+// LoadScripts loads the scripts into the Redis script cache, so they can be run by their SHA
+// right away. Scripts are loaded again on demand if the cache gets flushed.
+func LoadScripts(ctx context.Context, client redis.Scripter) error {
+	for _, script := range scripts {
+		if err := script.Load(ctx, client).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scriptNow returns the first argument of the scripts, which is the time of the clock in
+// milliseconds when the store was given one (e.g.: by a test), or empty so the scripts read the
+// time of the Redis server
+func scriptNow(clock Clock) interface{} {
+	if _, ok := clock.(systemClock); ok {
+		return ""
+	}
+	return clock.Now().UnixMilli()
+}
+
+// runScript runs a script with EVALSHA, falling back to EVAL when it isn't in the script cache
+// anymore, and converts its reply into a Result
+func runScript(ctx context.Context, client redis.Scripter, script *redis.Script, keys []string, args ...interface{}) (Result, error) {
+	reply, err := script.Run(ctx, client, keys, args...).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return scriptResult(reply), nil
+}
+
+// scriptResult converts the reply of a script into a Result
+func scriptResult(reply []int64) Result {
+	return Result{
+		Limited:            reply[0] == 1,
+		Blocked:            reply[1] == 1,
+		HitCount:           uint(reply[2]),
+		RemainingBlockTime: uint(math.Ceil(float64(reply[3]) / 1000)),
+		Delay:              time.Duration(reply[4]) * time.Millisecond,
+		ResetAfter:         time.Duration(reply[5]) * time.Millisecond,
+		RetryAfter:         time.Duration(reply[6]) * time.Millisecond,
+	}
+}
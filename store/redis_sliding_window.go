@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSlidingWindowLogStore is the Redis backed version of InMemorySlidingWindowLogStore,
+// keeping the log in a sorted set scored by the hits' timestamps in milliseconds.
+// Its decisions are taken atomically by Take.
+type RedisSlidingWindowLogStore struct {
+	redisBlock
+	config *StoreConfig
+	clock  Clock
+	key    string
+	result Result
+}
+
+func NewRedisSlidingWindowLogStore(client redis.UniversalClient, ip string, token string, config *StoreConfig) *RedisSlidingWindowLogStore {
+	key := redisKey(ip, token) + ":slidingWindowLog"
+	return &RedisSlidingWindowLogStore{redisBlock: redisBlock{client, key + ":isBlocked"}, config: config, clock: config.clock(), key: key}
+}
+
+func (s *RedisSlidingWindowLogStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *RedisSlidingWindowLogStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowLogStore) TakeContext(ctx context.Context) (Result, error) {
+	now := s.clock.Now()
+	// The member must be unique, as several instances may log a hit at the same time
+	member := strconv.FormatInt(now.UnixNano(), 36) + ":" + strconv.FormatInt(rand.Int63(), 36)
+	result, err := takeResult(runScript(
+		ctx,
+		s.client,
+		slidingWindowLogScript,
+		[]string{s.key + ":hits", s.key + ":isBlocked"},
+		scriptNow(s.clock),
+		s.config.MaxRequests,
+		s.config.Window().Milliseconds(),
+		s.config.BlockInSeconds*1000,
+		member,
+	))
+	s.result = result
+	return result, err
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *RedisSlidingWindowLogStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the window slides on every hit
+func (s *RedisSlidingWindowLogStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh clears the log
+func (s *RedisSlidingWindowLogStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowLogStore) RefreshContext(ctx context.Context) error {
+	return s.client.Del(ctx, s.key+":hits", s.key+":isBlocked").Err()
+}
+
+func (s *RedisSlidingWindowLogStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowLogStore) BlockContext(ctx context.Context) error {
+	return s.block(ctx, s.config)
+}
+
+// Expired always returns true, as the state is kept (and expired) by Redis
+func (s *RedisSlidingWindowLogStore) Expired(now time.Time) bool {
+	return true
+}
+
+func (s *RedisSlidingWindowLogStore) Hit() {
+	s.Take()
+}
+
+func (s *RedisSlidingWindowLogStore) LastHit() time.Time {
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowLogStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	hits, err := s.client.ZRevRangeWithScores(ctx, s.key+":hits", 0, 0).Result()
+	if err != nil || len(hits) == 0 {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(int64(hits[0].Score)), nil
+}
+
+// HitCount returns the amount of requests accepted within the last LimitInSeconds
+func (s *RedisSlidingWindowLogStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowLogStore) HitCountContext(ctx context.Context) (uint, error) {
+	windowStart := s.clock.Now().Add(-s.config.Window()).UnixMilli()
+	count, err := s.client.ZCount(ctx, s.key+":hits", "("+strconv.FormatInt(windowStart, 10), "+inf").Result()
+	return uint(count), err
+}
+
+// RedisSlidingWindowCounterStore is the Redis backed version of InMemorySlidingWindowCounterStore,
+// keeping a counter key per fixed window that expires once it can no longer be weighted.
+// Its decisions are taken atomically by Take.
+type RedisSlidingWindowCounterStore struct {
+	redisBlock
+	config *StoreConfig
+	clock  Clock
+	key    string
+	result Result
+}
+
+func NewRedisSlidingWindowCounterStore(client redis.UniversalClient, ip string, token string, config *StoreConfig) *RedisSlidingWindowCounterStore {
+	key := redisKey(ip, token) + ":slidingWindowCounter"
+	return &RedisSlidingWindowCounterStore{redisBlock: redisBlock{client, key + ":isBlocked"}, config: config, clock: config.clock(), key: key}
+}
+
+func (s *RedisSlidingWindowCounterStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *RedisSlidingWindowCounterStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowCounterStore) TakeContext(ctx context.Context) (Result, error) {
+	result, err := takeResult(runScript(
+		ctx,
+		s.client,
+		slidingWindowCounterScript,
+		[]string{s.key + ":", s.key + ":lastHit", s.key + ":isBlocked"},
+		scriptNow(s.clock),
+		s.config.MaxRequests,
+		s.config.Window().Milliseconds(),
+		s.config.BlockInSeconds*1000,
+	))
+	s.result = result
+	return result, err
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *RedisSlidingWindowCounterStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the window slides on every hit
+func (s *RedisSlidingWindowCounterStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh clears the counters of the sliding window
+func (s *RedisSlidingWindowCounterStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowCounterStore) RefreshContext(ctx context.Context) error {
+	window, _ := slidingWindow(s.clock.Now(), s.config.Window())
+	return s.client.Del(ctx, s.windowKey(window), s.windowKey(window-1), s.key+":isBlocked").Err()
+}
+
+func (s *RedisSlidingWindowCounterStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowCounterStore) BlockContext(ctx context.Context) error {
+	return s.block(ctx, s.config)
+}
+
+// Expired always returns true, as the state is kept (and expired) by Redis
+func (s *RedisSlidingWindowCounterStore) Expired(now time.Time) bool {
+	return true
+}
+
+func (s *RedisSlidingWindowCounterStore) Hit() {
+	s.Take()
+}
+
+func (s *RedisSlidingWindowCounterStore) LastHit() time.Time {
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowCounterStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	lastHit, err := getInt(ctx, s.client, s.key+":lastHit")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(lastHit), nil
+}
+
+// HitCount returns the estimated amount of requests accepted within the last LimitInSeconds
+func (s *RedisSlidingWindowCounterStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *RedisSlidingWindowCounterStore) HitCountContext(ctx context.Context) (uint, error) {
+	window, elapsed := slidingWindow(s.clock.Now(), s.config.Window())
+	current, previous, err := s.counters(ctx, window)
+	if err != nil {
+		return 0, err
+	}
+	return uint(math.Ceil(slidingWindowEstimate(current, previous, elapsed))), nil
+}
+
+// counters returns the counters of the given window and the one before it
+func (s *RedisSlidingWindowCounterStore) counters(ctx context.Context, window int64) (uint, uint, error) {
+	values, err := s.client.MGet(ctx, s.windowKey(window), s.windowKey(window-1)).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	counters := make([]uint, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		counter, err := strconv.ParseUint(value.(string), 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		counters[i] = uint(counter)
+	}
+	return counters[0], counters[1], nil
+}
+
+// windowKey returns the key of the counter of a window, as it's built by the script
+func (s *RedisSlidingWindowCounterStore) windowKey(window int64) string {
+	return s.key + ":" + strconv.FormatInt(window, 10)
+}
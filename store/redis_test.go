@@ -0,0 +1,398 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// setupRedis creates a Redis client connected to an in-process Redis server
+func setupRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+	})
+	if err := LoadScripts(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+// fixedClock is a Clock whose time never changes
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestRedisStores_Take(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    3,
+		LimitInSeconds: 60,
+		BlockInSeconds: 30,
+		// At the start of a window, so the timings of the sliding window counter are known
+		Clock: fixedClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	stores := map[string]func(client redis.UniversalClient) AtomicStore{
+		FixedWindowAlgorithm: func(client redis.UniversalClient) AtomicStore {
+			return NewRedisStore(client, "1.1.1.1", "", config)
+		},
+		TokenBucketAlgorithm: func(client redis.UniversalClient) AtomicStore {
+			return NewRedisTokenBucketStore(client, "1.1.1.1", "", config)
+		},
+		SlidingWindowLogAlgorithm: func(client redis.UniversalClient) AtomicStore {
+			return NewRedisSlidingWindowLogStore(client, "1.1.1.1", "", config)
+		},
+		SlidingWindowCounterAlgorithm: func(client redis.UniversalClient) AtomicStore {
+			return NewRedisSlidingWindowCounterStore(client, "1.1.1.1", "", config)
+		},
+		GCRAAlgorithm: func(client redis.UniversalClient) AtomicStore {
+			return NewRedisGCRAStore(client, "1.1.1.1", "", config)
+		},
+	}
+	for algorithm, newStore := range stores {
+		t.Run(algorithm, func(t *testing.T) {
+			_, client := setupRedis(t)
+			store := newStore(client)
+			for i := uint(1); i <= 3; i++ {
+				result := store.Take()
+				if result.Limited {
+					t.Fatalf("Hit %d was limited", i)
+				}
+				if result.HitCount != i {
+					t.Errorf("Hit %d returned a hit count of %d", i, result.HitCount)
+				}
+				if result.ResetAfter <= 0 || result.ResetAfter > 120*time.Second {
+					t.Errorf("Hit %d returned a reset after %s, expected it within two limit durations", i, result.ResetAfter)
+				}
+			}
+			result := store.Take()
+			if !result.Limited || !result.Blocked {
+				t.Errorf("Hit over the limit returned %+v, expected it to be limited and blocked", result)
+			}
+			if result.RemainingBlockTime != 30 {
+				t.Errorf("Hit over the limit returned a remaining block time of %d, expected 30", result.RemainingBlockTime)
+			}
+			// The 3 hits of the sliding window counter become the previous window's ones after
+			// 60s, weighted by 2/3 after another 20s, so a new hit is estimated at 3 × 2/3 + 1 = 3
+			expectedRetryAfter := [2]time.Duration{30 * time.Second, 60 * time.Second}
+			if algorithm == SlidingWindowCounterAlgorithm {
+				expectedRetryAfter = [2]time.Duration{80 * time.Second, 80 * time.Second}
+			}
+			if result.RetryAfter < expectedRetryAfter[0] || result.RetryAfter > expectedRetryAfter[1] {
+				t.Errorf("Hit over the limit returned a retry after %s, expected between %s and %s", result.RetryAfter, expectedRetryAfter[0], expectedRetryAfter[1])
+			}
+			if !store.ShouldLimit() || !store.IsBlocked() {
+				t.Error("Store is not limited and blocked after Take() limited a hit")
+			}
+
+			// Another instance shares the same state
+			if result := newStore(client).Take(); !result.Limited || !result.Blocked {
+				t.Error("Hit from another instance was not limited")
+			}
+
+			store.Refresh()
+			if result := store.Take(); result.Limited {
+				t.Error("Hit after Refresh() was limited")
+			}
+		})
+	}
+}
+
+func TestRedisStores_TakeIsAtomic(t *testing.T) {
+	_, client := setupRedis(t)
+	config := &StoreConfig{
+		MaxRequests:    10,
+		LimitInSeconds: 60,
+		BlockInSeconds: 0,
+	}
+
+	// Every goroutine acts as a different instance, taking hits concurrently
+	accepted := make(chan bool, 100)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			accepted <- !NewRedisStore(client, "1.1.1.1", "", config).Take().Limited
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+
+	count := 0
+	for ok := range accepted {
+		if ok {
+			count++
+		}
+	}
+	if count != 10 {
+		t.Errorf("%d hits were accepted, expected exactly 10", count)
+	}
+}
+
+func TestRedisStores_ScriptCacheFlushed(t *testing.T) {
+	server, client := setupRedis(t)
+	config := &StoreConfig{
+		MaxRequests:    1,
+		LimitInSeconds: 60,
+		BlockInSeconds: 0,
+	}
+	store := NewRedisGCRAStore(client, "1.1.1.1", "", config)
+	store.Take()
+
+	// The script is loaded again when EVALSHA can't find it
+	server.FlushAll()
+	if _, err := client.ScriptFlush(context.Background()).Result(); err != nil {
+		t.Fatal(err)
+	}
+	if result := store.Take(); result.Limited {
+		t.Error("Hit was limited after the script cache and data were flushed")
+	}
+	if result := store.Take(); !result.Limited {
+		t.Error("Hit over the limit was not limited after the script was loaded again")
+	}
+}
+
+func TestRedisLeakyBucketStore_Take(t *testing.T) {
+	_, client := setupRedis(t)
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 2,
+		BlockInSeconds: 0,
+	}
+	store := NewRedisLeakyBucketStore(client, "1.1.1.1", "", config)
+	if result := store.Take(); result.Limited || result.Delay != 0 {
+		t.Errorf("First hit returned %+v, expected it to be released right away", result)
+	}
+	if result := store.Take(); result.Limited || result.Delay <= 900*time.Millisecond || result.Delay > time.Second {
+		t.Errorf("Second hit returned %+v, expected it to be held back for about 1s", result)
+	}
+	if result := store.Take(); !result.Limited {
+		t.Errorf("Third hit returned %+v, expected the queue to be full", result)
+	}
+}
+
+func TestRedisLeakyBucketStore_OverflowDoesntBlock(t *testing.T) {
+	_, client := setupRedis(t)
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 2,
+		BlockInSeconds: 60,
+	}
+	store := NewRedisLeakyBucketStore(client, "1.1.1.1", "", config)
+	store.Take()
+	store.Take()
+	if result := store.Take(); !result.Limited || result.Blocked || result.RetryAfter > time.Second {
+		t.Errorf("Third hit returned %+v, expected it to be limited until the queue has room", result)
+	}
+	if store.IsBlocked() {
+		t.Error("The overflowing queue blocked the key")
+	}
+
+	// The key is still blocked by Block
+	store.Block()
+	if result := store.Take(); !result.Blocked || result.RemainingBlockTime != 60 {
+		t.Errorf("Hit after a block returned %+v, expected it to be blocked for 60s", result)
+	}
+}
+
+func TestRedisTokenBucketStore_Refill(t *testing.T) {
+	server, client := setupRedis(t)
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 1,
+		BlockInSeconds: 0,
+	}
+	store := NewRedisTokenBucketStore(client, "1.1.1.1", "", config)
+	store.Take()
+	store.Take()
+	if result := store.Take(); !result.Limited {
+		t.Error("Hit with an empty bucket was not limited")
+	}
+
+	// Half a second refills a single token at 2 tokens per second
+	lastHit := time.Now().Add(-500 * time.Millisecond).UnixMilli()
+	server.HSet(store.key, "lastHit", strconv.FormatInt(lastHit, 10))
+	if result := store.Take(); result.Limited {
+		t.Error("Hit was limited after a token was refilled")
+	}
+	if result := store.Take(); !result.Limited {
+		t.Error("Hit was not limited after the refilled token was taken")
+	}
+}
+
+func TestRedisTokenBucketStore_HitCountRefills(t *testing.T) {
+	server, client := setupRedis(t)
+	config := &StoreConfig{
+		MaxRequests:    2,
+		LimitInSeconds: 1,
+		BlockInSeconds: 0,
+	}
+	store := NewRedisTokenBucketStore(client, "1.1.1.1", "", config)
+	store.Take()
+	store.Take()
+	if hitCount := store.HitCount(); hitCount != 2 {
+		t.Errorf("HitCount() returned %d with an empty bucket, expected 2", hitCount)
+	}
+
+	// The tokens refilled since the last hit aren't counted as taken anymore
+	lastHit := time.Now().Add(-500 * time.Millisecond).UnixMilli()
+	server.HSet(store.key, "lastHit", strconv.FormatInt(lastHit, 10))
+	if hitCount := store.HitCount(); hitCount != 1 {
+		t.Errorf("HitCount() returned %d half a second after the bucket was emptied, expected 1", hitCount)
+	}
+}
+
+func TestRedisStores_Context(t *testing.T) {
+	config := &StoreConfig{
+		MaxRequests:    3,
+		LimitInSeconds: 60,
+		BlockInSeconds: 30,
+	}
+	stores := map[string]func(client redis.UniversalClient) ContextStore{
+		FixedWindowAlgorithm: func(client redis.UniversalClient) ContextStore {
+			return NewRedisStore(client, "1.1.1.1", "", config)
+		},
+		TokenBucketAlgorithm: func(client redis.UniversalClient) ContextStore {
+			return NewRedisTokenBucketStore(client, "1.1.1.1", "", config)
+		},
+		SlidingWindowLogAlgorithm: func(client redis.UniversalClient) ContextStore {
+			return NewRedisSlidingWindowLogStore(client, "1.1.1.1", "", config)
+		},
+		SlidingWindowCounterAlgorithm: func(client redis.UniversalClient) ContextStore {
+			return NewRedisSlidingWindowCounterStore(client, "1.1.1.1", "", config)
+		},
+		GCRAAlgorithm: func(client redis.UniversalClient) ContextStore {
+			return NewRedisGCRAStore(client, "1.1.1.1", "", config)
+		},
+		LeakyBucketAlgorithm: func(client redis.UniversalClient) ContextStore {
+			return NewRedisLeakyBucketStore(client, "1.1.1.1", "", config)
+		},
+	}
+	for algorithm, newStore := range stores {
+		t.Run(algorithm, func(t *testing.T) {
+			server, client := setupRedis(t)
+			store := newStore(client)
+			ctx := context.Background()
+
+			// An empty store isn't an error
+			if hitCount, err := store.HitCountContext(ctx); err != nil || hitCount != 0 {
+				t.Errorf("HitCountContext() of an empty store returned %d, %v", hitCount, err)
+			}
+			if _, err := store.LastHitContext(ctx); err != nil {
+				t.Errorf("LastHitContext() of an empty store returned %v", err)
+			}
+			if blocked, err := store.IsBlockedContext(ctx); err != nil || blocked {
+				t.Errorf("IsBlockedContext() of an empty store returned %t, %v", blocked, err)
+			}
+
+			if result, err := store.TakeContext(ctx); err != nil || result.Limited || result.HitCount != 1 {
+				t.Errorf("TakeContext() returned %+v, %v", result, err)
+			}
+			if hitCount, err := store.HitCountContext(ctx); err != nil || hitCount != 1 {
+				t.Errorf("HitCountContext() returned %d, %v, expected 1", hitCount, err)
+			}
+			if err := store.BlockContext(ctx); err != nil {
+				t.Errorf("BlockContext() returned %v", err)
+			}
+			if remaining, err := store.RemainingBlockTimeContext(ctx); err != nil || remaining != 30 {
+				t.Errorf("RemainingBlockTimeContext() returned %d, %v, expected 30", remaining, err)
+			}
+			if err := store.RefreshContext(ctx); err != nil {
+				t.Errorf("RefreshContext() returned %v", err)
+			}
+
+			// The calls are bounded by the context
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			if result, err := store.TakeContext(canceled); !errors.Is(err, context.Canceled) || result.Err != err {
+				t.Errorf("TakeContext() with a canceled context returned %+v, %v", result, err)
+			}
+
+			server.Close()
+			if result := store.Take(); result.Err == nil {
+				t.Error("Take() returned no error while Redis is unavailable")
+			}
+			if _, err := store.HitCountContext(ctx); err == nil {
+				t.Error("HitCountContext() returned no error while Redis is unavailable")
+			}
+			if err := store.BlockContext(ctx); err == nil {
+				t.Error("BlockContext() returned no error while Redis is unavailable")
+			}
+		})
+	}
+}
+
+func TestRedisStores_KeysExpire(t *testing.T) {
+	for _, config := range []*StoreConfig{
+		{MaxRequests: 1, LimitInSeconds: 60, BlockInSeconds: 30},
+		{MaxRequests: 0, LimitInSeconds: 60, BlockInSeconds: 0},
+	} {
+		server, client := setupRedis(t)
+		// A key written without a TTL by an older version
+		server.Set(redisKey("1.1.1.1", "")+":hitCount", "1")
+
+		stores := []ContextStore{
+			NewRedisStore(client, "1.1.1.1", "", config),
+			NewRedisTokenBucketStore(client, "1.1.1.1", "", config),
+			NewRedisSlidingWindowLogStore(client, "1.1.1.1", "", config),
+			NewRedisSlidingWindowCounterStore(client, "1.1.1.1", "", config),
+			NewRedisGCRAStore(client, "1.1.1.1", "", config),
+			NewRedisLeakyBucketStore(client, "1.1.1.1", "", config),
+		}
+		for _, store := range stores {
+			store.Take()
+			store.Take()
+			store.Block()
+		}
+		for _, key := range server.Keys() {
+			if server.TTL(key) <= 0 {
+				t.Errorf("Key %s of %+v has no TTL", key, config)
+			}
+		}
+	}
+}
+
+func TestRedisStores_ServerTime(t *testing.T) {
+	server, client := setupRedis(t)
+	// The clock of the Redis server is ahead of the one of the instance by a day
+	serverTime := time.Now().Add(24 * time.Hour).Truncate(time.Millisecond)
+	server.SetTime(serverTime)
+	config := &StoreConfig{MaxRequests: 3, LimitInSeconds: 60}
+
+	// Without a clock, the scripts take their decisions as of the time of the Redis server
+	NewRedisStore(client, "1.1.1.1", "", config).Take()
+	if lastHit := NewRedisStore(client, "1.1.1.1", "", config).LastHit(); !lastHit.Equal(serverTime) {
+		t.Errorf("The last hit is %s, expected the time of the server %s", lastHit, serverTime)
+	}
+	NewRedisSlidingWindowCounterStore(client, "1.1.1.1", "", config).Take()
+	window, _ := slidingWindow(serverTime, config.Window())
+	key := NewRedisSlidingWindowCounterStore(client, "1.1.1.1", "", config).windowKey(window)
+	if count, err := server.Get(key); err != nil || count != "1" {
+		t.Errorf("The counter of the window of the server is %q (%v), expected 1", count, err)
+	}
+}
+
+func TestRedisStore_HitsOverTheLimitArentCounted(t *testing.T) {
+	_, client := setupRedis(t)
+	config := &StoreConfig{MaxRequests: 2, LimitInSeconds: 60}
+	redisStore := NewRedisStore(client, "1.1.1.1", "", config)
+	inMemoryStore := NewInMemoryStore(config)
+	for i := 0; i < 5; i++ {
+		redisResult, inMemoryResult := redisStore.Take(), inMemoryStore.Take()
+		if redisResult.Limited != inMemoryResult.Limited || redisResult.HitCount != inMemoryResult.HitCount {
+			t.Errorf("Hit %d returned %+v, expected %+v like the in-memory store", i+1, redisResult, inMemoryResult)
+		}
+	}
+	if hitCount := redisStore.HitCount(); hitCount != 3 {
+		t.Errorf("HitCount() returned %d, expected 3", hitCount)
+	}
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisTokenBucketStore is the Redis backed version of InMemoryTokenBucketStore, keeping the bucket
+// in a hash that expires once it's full again. Its decisions are taken atomically by Take.
+type RedisTokenBucketStore struct {
+	redisBlock
+	config *StoreConfig
+	clock  Clock
+	key    string
+	result Result
+}
+
+func NewRedisTokenBucketStore(client redis.UniversalClient, ip string, token string, config *StoreConfig) *RedisTokenBucketStore {
+	key := redisKey(ip, token) + ":tokenBucket"
+	return &RedisTokenBucketStore{redisBlock: redisBlock{client, key + ":isBlocked"}, config: config, clock: config.clock(), key: key}
+}
+
+func (s *RedisTokenBucketStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *RedisTokenBucketStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+func (s *RedisTokenBucketStore) TakeContext(ctx context.Context) (Result, error) {
+	result, err := takeResult(runScript(
+		ctx,
+		s.client,
+		tokenBucketScript,
+		[]string{s.key, s.key + ":isBlocked"},
+		scriptNow(s.clock),
+		s.config.MaxRequests,
+		strconv.FormatFloat(s.config.RefillRate()/1000, 'f', -1, 64),
+		s.config.BlockInSeconds*1000,
+	))
+	s.result = result
+	return result, err
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *RedisTokenBucketStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the bucket is refilled on every hit
+func (s *RedisTokenBucketStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh fills the bucket up
+func (s *RedisTokenBucketStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *RedisTokenBucketStore) RefreshContext(ctx context.Context) error {
+	return s.client.Del(ctx, s.key, s.key+":isBlocked").Err()
+}
+
+func (s *RedisTokenBucketStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *RedisTokenBucketStore) BlockContext(ctx context.Context) error {
+	return s.block(ctx, s.config)
+}
+
+// Expired always returns true, as the state is kept (and expired) by Redis
+func (s *RedisTokenBucketStore) Expired(now time.Time) bool {
+	return true
+}
+
+func (s *RedisTokenBucketStore) Hit() {
+	s.Take()
+}
+
+func (s *RedisTokenBucketStore) LastHit() time.Time {
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *RedisTokenBucketStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	lastHit, err := s.client.HGet(ctx, s.key, "lastHit").Int64()
+	if err == redis.Nil {
+		return time.UnixMilli(0), nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(lastHit), nil
+}
+
+// HitCount returns the amount of tokens currently taken from the bucket
+func (s *RedisTokenBucketStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *RedisTokenBucketStore) HitCountContext(ctx context.Context) (uint, error) {
+	state, err := s.client.HMGet(ctx, s.key, "tokens", "lastHit").Result()
+	if err != nil || state[0] == nil || state[1] == nil {
+		return 0, err
+	}
+	tokens, err := strconv.ParseFloat(state[0].(string), 64)
+	if err != nil {
+		return 0, err
+	}
+	lastHit, err := strconv.ParseInt(state[1].(string), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	// The bucket is refilled as of now, like the script does on the next hit
+	elapsed := math.Max(0, float64(s.clock.Now().UnixMilli()-lastHit))
+	tokens = math.Min(float64(s.config.MaxRequests), tokens+elapsed*s.config.RefillRate()/1000)
+	return uint(math.Ceil(math.Max(0, float64(s.config.MaxRequests)-tokens))), nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// RemoteStore takes the decisions of a key on the RemoteNode owning it, which is either the local
+// node or one of its peers, with the rule of the owner, so it only keeps the last result locally
+type RemoteStore struct {
+	node   *RemoteNode
+	ip     string
+	token  string
+	result Result
+}
+
+func NewRemoteStore(node *RemoteNode, ip string, token string) *RemoteStore {
+	return &RemoteStore{node: node, ip: ip, token: token}
+}
+
+func (s *RemoteStore) request(op string) remoteRequest {
+	return remoteRequest{Op: op, IP: s.ip, Token: s.token}
+}
+
+func (s *RemoteStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+// TakeContext takes the decision on the owner of the key
+func (s *RemoteStore) TakeContext(ctx context.Context) (Result, error) {
+	resp, err := s.node.do(ctx, s.request(remoteTake))
+	if err != nil {
+		s.result = Result{Err: err}
+		return s.result, err
+	}
+	s.result = resp.result()
+	return s.result, nil
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *RemoteStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the owner of the key takes the whole decision
+func (s *RemoteStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh deletes the store of the key on its owner, so it starts over on the next hit
+func (s *RemoteStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *RemoteStore) RefreshContext(ctx context.Context) error {
+	_, err := s.node.do(ctx, s.request(remoteRefresh))
+	return err
+}
+
+func (s *RemoteStore) IsBlocked() bool {
+	return logged(s.IsBlockedContext(context.Background()))
+}
+
+func (s *RemoteStore) IsBlockedContext(ctx context.Context) (bool, error) {
+	resp, err := s.node.do(ctx, s.request(remoteState))
+	return resp.Blocked, err
+}
+
+func (s *RemoteStore) RemainingBlockTime() uint {
+	return logged(s.RemainingBlockTimeContext(context.Background()))
+}
+
+func (s *RemoteStore) RemainingBlockTimeContext(ctx context.Context) (uint, error) {
+	resp, err := s.node.do(ctx, s.request(remoteState))
+	return resp.RemainingBlockTime, err
+}
+
+func (s *RemoteStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *RemoteStore) BlockContext(ctx context.Context) error {
+	_, err := s.node.do(ctx, s.request(remoteBlock))
+	return err
+}
+
+func (s *RemoteStore) Hit() {
+	s.Take()
+}
+
+// Expired always returns true, as the state is kept by the owner of the key
+func (s *RemoteStore) Expired(now time.Time) bool {
+	return true
+}
+
+func (s *RemoteStore) LastHit() time.Time {
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *RemoteStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	resp, err := s.node.do(ctx, s.request(remoteState))
+	return resp.LastHit, err
+}
+
+func (s *RemoteStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *RemoteStore) HitCountContext(ctx context.Context) (uint, error) {
+	resp, err := s.node.do(ctx, s.request(remoteState))
+	return resp.HitCount, err
+}
@@ -0,0 +1,418 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/log"
+)
+
+// RemotePath is the path of the endpoint of a RemoteNode receiving the decisions forwarded by its peers
+const RemotePath = "/remote"
+
+// defaultRemoteTimeout is the max time waited for the owner of a key when it isn't configured
+const defaultRemoteTimeout = 500 * time.Millisecond
+
+// remoteMaxBodyBytes is the max size of a decision forwarded by a peer
+const remoteMaxBodyBytes = 64 << 10
+
+// The operations forwarded to the owner of a key
+const (
+	remoteTake    = "take"
+	remoteRefresh = "refresh"
+	remoteBlock   = "block"
+	remoteState   = "state"
+	// remoteHandoff seeds the store of a key with the state of its previous owner
+	remoteHandoff = "handoff"
+)
+
+// StoreFactory creates the store of a key implementing the given algorithm, which must implement
+// AtomicStore to be owned by a RemoteNode
+type StoreFactory func(algorithm string, config *StoreConfig) Store
+
+// RuleLookup returns the algorithm and config of the store of a key, and false when the key isn't
+// limited
+type RuleLookup func(ip string, token string) (algorithm string, config *StoreConfig, ok bool)
+
+// RemoteNode is a member of a ring of instances sharing the limits without a shared database:
+// every key is owned by a single node of the ring, picked by consistent hashing, which keeps its
+// store (created by a StoreFactory) and takes all its decisions, so the limits are exact. The other
+// nodes forward the decisions of the key to its owner over HTTP, authenticated by the secret
+// shared by the nodes when one is configured. The owner takes the decisions with the rules set by
+// SetRules, whatever the rules of the node forwarding them.
+//
+// When the membership of the ring changes, the keys owned by another node are handed over to it:
+// their new store is seeded with their hit count and block (taking the hits again and blocking the
+// key for a whole block duration), and the hits taken by the new owner in the meantime are kept as
+// well, so the limits are only stricter while the ring is rebalanced. Every node must be given the
+// same members, otherwise they may disagree on the owner of a key.
+type RemoteNode struct {
+	address string
+	secret  string
+	timeout time.Duration
+	client  *http.Client
+	create  StoreFactory
+	stores  *ShardedStore
+
+	mutex sync.RWMutex
+	ring  *hashRing
+	rules RuleLookup
+
+	server *http.Server
+}
+
+// ownedStore is the store of a key owned by a RemoteNode, along with the rule it applies
+type ownedStore struct {
+	AtomicStore
+	algorithm string
+	config    StoreConfig
+}
+
+// Expired reports whether the store is expired when it implements ExpiringStore
+func (s *ownedStore) Expired(now time.Time) bool {
+	if s, ok := s.AtomicStore.(ExpiringStore); ok {
+		return s.Expired(now)
+	}
+	return false
+}
+
+// remoteRequest is an operation forwarded to the owner of a key, which applies its own rule
+type remoteRequest struct {
+	Op    string `json:"op"`
+	IP    string `json:"ip"`
+	Token string `json:"token"`
+	// The state handed over by the previous owner of the key
+	HitCount uint `json:"hitCount,omitempty"`
+	Blocked  bool `json:"blocked,omitempty"`
+}
+
+// remoteResponse is the outcome of an operation taken by the owner of a key
+type remoteResponse struct {
+	Limited            bool          `json:"limited"`
+	Blocked            bool          `json:"blocked"`
+	HitCount           uint          `json:"hitCount"`
+	RemainingBlockTime uint          `json:"remainingBlockTime"`
+	Delay              time.Duration `json:"delay"`
+	ResetAfter         time.Duration `json:"resetAfter"`
+	RetryAfter         time.Duration `json:"retryAfter"`
+	LastHit            time.Time     `json:"lastHit"`
+}
+
+func newRemoteResponse(result Result) remoteResponse {
+	return remoteResponse{
+		Limited:            result.Limited,
+		Blocked:            result.Blocked,
+		HitCount:           result.HitCount,
+		RemainingBlockTime: result.RemainingBlockTime,
+		Delay:              result.Delay,
+		ResetAfter:         result.ResetAfter,
+		RetryAfter:         result.RetryAfter,
+	}
+}
+
+func (r remoteResponse) result() Result {
+	return Result{
+		Limited:            r.Limited,
+		Blocked:            r.Blocked,
+		HitCount:           r.HitCount,
+		RemainingBlockTime: r.RemainingBlockTime,
+		Delay:              r.Delay,
+		ResetAfter:         r.ResetAfter,
+		RetryAfter:         r.RetryAfter,
+	}
+}
+
+// NewRemoteNode creates a node with the remote configuration, listening on its bind address (or
+// its address) if it has one (which requires a secret), whose owned keys are stored in stores
+// created by create
+func NewRemoteNode(cfg config.RemoteConfig, create StoreFactory) (*RemoteNode, error) {
+	timeout := time.Duration(cfg.TimeoutInMilliseconds) * time.Millisecond
+	if timeout == 0 {
+		timeout = defaultRemoteTimeout
+	}
+	n := &RemoteNode{
+		address: cfg.Address,
+		secret:  cfg.Secret,
+		timeout: timeout,
+		client:  &http.Client{},
+		create:  create,
+		stores:  NewShardedStore(),
+	}
+
+	bindAddress := cfg.BindAddress
+	if bindAddress == "" {
+		bindAddress = cfg.Address
+	}
+	if bindAddress != "" && cfg.Secret == "" {
+		return nil, errors.New("the remote node has a bind address but no secret")
+	}
+	if bindAddress != "" {
+		listener, err := net.Listen("tcp", bindAddress)
+		if err != nil {
+			return nil, err
+		}
+		if n.address == "" {
+			n.address = listener.Addr().String()
+		}
+		mux := http.NewServeMux()
+		mux.Handle(RemotePath, n.Handler())
+		n.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := n.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Logf(log.Error, "Error serving the remote node %s: %s", n.address, err)
+			}
+		}()
+	}
+	if n.address == "" {
+		return nil, errors.New("the remote node has neither an address nor a bind address")
+	}
+	n.SetPeers(cfg.Peers)
+	return n, nil
+}
+
+// Addr returns the address identifying the node in the ring
+func (n *RemoteNode) Addr() string {
+	return n.address
+}
+
+// SetRules replaces the rules the node takes the decisions of the keys it owns with. The node
+// can't take any decision until its rules are set.
+func (n *RemoteNode) SetRules(rules RuleLookup) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.rules = rules
+}
+
+// Stores returns the stores of the keys owned by the node
+func (n *RemoteNode) Stores() *ShardedStore {
+	return n.stores
+}
+
+// SetPeers replaces the other members of the ring, handing the keys now owned by another node
+// over to it before returning
+func (n *RemoteNode) SetPeers(peers []string) {
+	members := []string{n.address}
+	for _, peer := range peers {
+		peer = strings.TrimSpace(peer)
+		if peer != "" && peer != n.address {
+			members = append(members, peer)
+		}
+	}
+	ring := newHashRing(members)
+	n.mutex.Lock()
+	n.ring = ring
+	n.mutex.Unlock()
+	n.handOff(ring)
+}
+
+// owner returns the node owning the key of the ip and token
+func (n *RemoteNode) owner(ip string, token string) string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	return n.ring.owner(redisKey(ip, token))
+}
+
+// handOff deletes the stores of the keys owned by another node of the ring, sending their state
+// to their new owner
+func (n *RemoteNode) handOff(ring *hashRing) {
+	var handoffs []remoteRequest
+	n.stores.Filter(func(ip string, token string, s Store) bool {
+		if ring.owner(redisKey(ip, token)) == n.address {
+			return true
+		}
+		owned, ok := s.(*ownedStore)
+		if !ok {
+			return false
+		}
+		handoffs = append(handoffs, remoteRequest{
+			Op:       remoteHandoff,
+			IP:       ip,
+			Token:    token,
+			HitCount: owned.HitCount(),
+			Blocked:  owned.IsBlocked(),
+		})
+		return false
+	})
+	for _, handoff := range handoffs {
+		owner := ring.owner(redisKey(handoff.IP, handoff.Token))
+		ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+		if _, err := n.send(ctx, owner, handoff); err != nil {
+			log.Logf(log.Warn, "Error handing the key of %s over to %s: %s", handoff.IP, owner, err)
+		}
+		cancel()
+	}
+}
+
+// Handler returns the handler receiving the decisions forwarded by the peers, to mount it on
+// another server instead of listening on a bind address. The decisions are taken by this node
+// even when it doesn't own the key in its ring, so they're never forwarded twice. The requests
+// without the secret of the node are rejected (all of them when it has none).
+func (n *RemoteNode) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if !n.authorized(r) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		var req remoteRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, remoteMaxBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := n.handle(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// authorized reports whether a request carries the secret of the node, which must have one
+func (n *RemoteNode) authorized(r *http.Request) bool {
+	if n.secret == "" {
+		return false
+	}
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(secret), []byte(n.secret)) == 1
+}
+
+// Close stops listening on the bind address
+func (n *RemoteNode) Close() error {
+	if n.server != nil {
+		return n.server.Close()
+	}
+	return nil
+}
+
+// do runs an operation on the owner of its key, which is either this node or a peer
+func (n *RemoteNode) do(ctx context.Context, req remoteRequest) (remoteResponse, error) {
+	owner := n.owner(req.IP, req.Token)
+	if owner == n.address {
+		return n.handle(req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+	return n.send(ctx, owner, req)
+}
+
+func (n *RemoteNode) send(ctx context.Context, owner string, req remoteRequest) (remoteResponse, error) {
+	var resp remoteResponse
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+owner+RemotePath, bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+n.secret)
+	httpResp, err := n.client.Do(httpReq)
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf("the remote node %s returned %s", owner, httpResp.Status)
+	}
+	err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	return resp, err
+}
+
+// handle runs an operation on the store of a key owned by this node, applying its rule
+func (n *RemoteNode) handle(req remoteRequest) (resp remoteResponse, err error) {
+	switch req.Op {
+	case remoteRefresh:
+		n.stores.Delete(req.IP, req.Token)
+		return resp, nil
+	case remoteTake, remoteBlock, remoteState, remoteHandoff:
+	default:
+		return resp, fmt.Errorf("unknown operation %q", req.Op)
+	}
+
+	n.mutex.RLock()
+	rules := n.rules
+	n.mutex.RUnlock()
+	if rules == nil {
+		return resp, errors.New("the remote node has no rules")
+	}
+	algorithm, config, ok := rules(req.IP, req.Token)
+	if !ok {
+		// The key isn't limited anymore, so its hits are accepted
+		n.stores.Delete(req.IP, req.Token)
+		return resp, nil
+	}
+
+	create := func() Store {
+		config := *config
+		s, ok := n.create(algorithm, &config).(AtomicStore)
+		if !ok {
+			return nil
+		}
+		return &ownedStore{AtomicStore: s, algorithm: algorithm, config: config}
+	}
+	n.stores.Do(req.IP, req.Token, create, func(s Store, created bool) {
+		if s == nil {
+			err = fmt.Errorf("the store of the algorithm %q can't be owned by a remote node", algorithm)
+			return
+		}
+		owned := s.(*ownedStore)
+		if owned.algorithm != algorithm {
+			// The rule of the key changed, so it starts over with a store of the new algorithm
+			replacement, ok := create().(*ownedStore)
+			if !ok {
+				err = fmt.Errorf("the store of the algorithm %q can't be owned by a remote node", algorithm)
+				return
+			}
+			*owned = *replacement
+		} else if owned.config != *config {
+			if configurable, ok := owned.AtomicStore.(ConfigurableStore); ok {
+				config := *config
+				configurable.SetConfig(&config)
+				owned.config = config
+			}
+		}
+
+		switch req.Op {
+		case remoteTake:
+			resp = newRemoteResponse(owned.Take())
+		case remoteBlock:
+			owned.Block()
+		case remoteState:
+			resp = remoteResponse{
+				Blocked:            owned.IsBlocked(),
+				HitCount:           owned.HitCount(),
+				RemainingBlockTime: owned.RemainingBlockTime(),
+				LastHit:            owned.LastHit(),
+			}
+		case remoteHandoff:
+			for i := uint(0); i < req.HitCount && i < owned.config.MaxRequests; i++ {
+				owned.Take()
+			}
+			if req.Blocked {
+				owned.Block()
+			}
+		}
+	})
+	if err != nil {
+		// The nil store created for the unsupported algorithm isn't kept
+		n.stores.Delete(req.IP, req.Token)
+	}
+	return resp, err
+}
@@ -0,0 +1,229 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+)
+
+func newLogStore(algorithm string, config *StoreConfig) Store {
+	return NewInMemorySlidingWindowLogStore(config)
+}
+
+// logRules limits every key with the sliding window log algorithm
+func logRules(config StoreConfig) RuleLookup {
+	return func(ip string, token string) (string, *StoreConfig, bool) {
+		return SlidingWindowLogAlgorithm, &config, true
+	}
+}
+
+// newRemoteNode starts a node on localhost limiting every key to 10 hits a minute
+func newRemoteNode(t *testing.T, cfg config.RemoteConfig) *RemoteNode {
+	cfg.BindAddress = "127.0.0.1:0"
+	node, err := NewRemoteNode(cfg, newLogStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Close() })
+	node.SetRules(logRules(StoreConfig{MaxRequests: 10, LimitInSeconds: 60}))
+	return node
+}
+
+// setupRemoteNodes starts nodes on localhost sharing a secret, each one being given the others
+// as its peers
+func setupRemoteNodes(t *testing.T, count int) []*RemoteNode {
+	nodes := make([]*RemoteNode, count)
+	for i := range nodes {
+		nodes[i] = newRemoteNode(t, config.RemoteConfig{Secret: "secret"})
+	}
+	for _, node := range nodes {
+		node.SetPeers(remotePeers(nodes, node))
+	}
+	return nodes
+}
+
+func remotePeers(nodes []*RemoteNode, node *RemoteNode) []string {
+	peers := []string{}
+	for _, peer := range nodes {
+		if peer != node {
+			peers = append(peers, peer.Addr())
+		}
+	}
+	return peers
+}
+
+func TestHashRing(t *testing.T) {
+	ring := newHashRing([]string{"a", "b", "c"})
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = ring.owner(key)
+		counts[owners[key]]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		if counts[node] < 500 {
+			t.Errorf("Node %s owns %d keys out of 3000, expected them to be spread evenly", node, counts[node])
+		}
+	}
+
+	// Only the keys now owned by the new node change owner
+	ring = newHashRing([]string{"c", "a", "b", "d"})
+	moved := 0
+	for key, owner := range owners {
+		if newOwner := ring.owner(key); newOwner != owner {
+			if newOwner != "d" {
+				t.Fatalf("Key %s moved from %s to %s", key, owner, newOwner)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 1200 {
+		t.Errorf("%d keys out of 3000 moved to the new node, expected about a quarter", moved)
+	}
+}
+
+func TestRemoteStore_SharedLimit(t *testing.T) {
+	nodes := setupRemoteNodes(t, 3)
+	stores := make([]*RemoteStore, len(nodes))
+	for i, node := range nodes {
+		stores[i] = NewRemoteStore(node, "1.1.1.1", "")
+	}
+
+	// The decisions are all taken by the owner, so the limit is exact
+	allowed := 0
+	for i := 0; i < 30; i++ {
+		result := stores[i%len(stores)].Take()
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		if !result.Limited {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("%d hits were allowed, expected exactly 10", allowed)
+	}
+
+	owners := 0
+	for _, node := range nodes {
+		if _, ok := node.Stores().Get("1.1.1.1", ""); ok {
+			owners++
+		}
+	}
+	if owners != 1 {
+		t.Errorf("%d nodes hold the store of the key, expected a single owner", owners)
+	}
+	if hitCount := stores[0].HitCount(); hitCount != 10 {
+		t.Errorf("The owner counted %d hits, expected 10", hitCount)
+	}
+}
+
+func TestRemoteNode_Rebalance(t *testing.T) {
+	nodes := setupRemoteNodes(t, 2)
+	for i := 0; i < 100; i++ {
+		store := NewRemoteStore(nodes[i%2], strconv.Itoa(i), "")
+		for j := 0; j < 3; j++ {
+			store.Take()
+		}
+	}
+
+	// The keys owned by the new node are handed over to it with their hits
+	node := newRemoteNode(t, config.RemoteConfig{Secret: "secret"})
+	nodes = append(nodes, node)
+	for _, node := range nodes {
+		node.SetPeers(remotePeers(nodes, node))
+	}
+	if node.Stores().Len() == 0 {
+		t.Fatal("No keys were handed over to the new node")
+	}
+	total := 0
+	for _, node := range nodes {
+		total += node.Stores().Len()
+	}
+	if total != 100 {
+		t.Errorf("The nodes hold %d stores, expected every key to have a single owner", total)
+	}
+	for i := 0; i < 100; i++ {
+		if hitCount := NewRemoteStore(nodes[i%3], strconv.Itoa(i), "").HitCount(); hitCount != 3 {
+			t.Fatalf("Key %d has %d hits after the rebalance, expected 3", i, hitCount)
+		}
+	}
+}
+
+func TestRemoteNode_Handler(t *testing.T) {
+	node := newRemoteNode(t, config.RemoteConfig{Secret: "secret"})
+	handler := node.Handler()
+	take := `{"op":"take","ip":"1.1.1.1","token":""}`
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		body          string
+		expected      int
+	}{
+		{"Without the secret", "", take, http.StatusUnauthorized},
+		{"With another secret", "Bearer other", take, http.StatusUnauthorized},
+		{"With the secret", "Bearer secret", take, http.StatusOK},
+		{"Too large", "Bearer secret", `{"op":"take","ip":"` + strings.Repeat("1", remoteMaxBodyBytes) + `"}`, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, RemotePath, strings.NewReader(tc.body))
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != tc.expected {
+				t.Errorf("The request returned %d: %s, expected %d", recorder.Code, recorder.Body, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRemoteNode_Secret(t *testing.T) {
+	if _, err := NewRemoteNode(config.RemoteConfig{BindAddress: "127.0.0.1:0"}, newLogStore); err == nil {
+		t.Error("Created a node listening without a secret")
+	}
+
+	// A node without a secret rejects all the decisions forwarded to it
+	req := httptest.NewRequest(http.MethodPost, RemotePath, nil)
+	req.Header.Set("Authorization", "Bearer ")
+	if (&RemoteNode{}).authorized(req) {
+		t.Error("A node without a secret authorized a request")
+	}
+}
+
+func TestRemoteNode_OwnerRules(t *testing.T) {
+	nodes := setupRemoteNodes(t, 2)
+	nodes[0].SetRules(logRules(StoreConfig{MaxRequests: 2, LimitInSeconds: 60}))
+	var key string
+	for i := 0; key == ""; i++ {
+		if nodes[0].owner(strconv.Itoa(i), "") == nodes[0].Addr() {
+			key = strconv.Itoa(i)
+		}
+	}
+
+	// The hits forwarded by a node with a higher limit are limited by the rule of the owner
+	store := NewRemoteStore(nodes[1], key, "")
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if !store.Take().Limited {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("%d hits were allowed, expected the 2 of the owner's rule", allowed)
+	}
+
+	// The keys the owner doesn't limit are accepted
+	nodes[0].SetRules(func(ip string, token string) (string, *StoreConfig, bool) {
+		return "", nil, false
+	})
+	if result := store.Take(); result.Limited || result.Err != nil {
+		t.Errorf("The hit of a key without a rule returned %+v, expected it to be accepted", result)
+	}
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// ringReplicas is the amount of points of every node on a hashRing, spreading the keys evenly
+const ringReplicas = 128
+
+// hashRing assigns every key to a node by consistent hashing: every node has ringReplicas points
+// on a ring of hashes, and a key is owned by the node of the first point following its hash, so
+// only the keys of about 1/n of the ring change owner when a node joins or leaves it
+type hashRing struct {
+	hashes []uint32
+	nodes  map[uint32]string
+}
+
+func newHashRing(nodes []string) *hashRing {
+	r := &hashRing{nodes: make(map[uint32]string, len(nodes)*ringReplicas)}
+	for _, node := range nodes {
+		for i := 0; i < ringReplicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(i)))
+			// On a collision, the point goes to the smallest node so every instance agrees on it
+			if owner, ok := r.nodes[hash]; ok {
+				if owner > node {
+					r.nodes[hash] = node
+				}
+				continue
+			}
+			r.nodes[hash] = node
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// owner returns the node owning the key, or an empty string when the ring has no nodes
+func (r *hashRing) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shardCount is the amount of shards of a ShardedStore, which must be a power of two
+const shardCount = 64
+
+// SweepInterval is the min time between two sweeps of the expired stores of a shard
+const SweepInterval = time.Minute
+
+// evictionSamples is the amount of stores sampled to pick the least recently used one to evict
+const evictionSamples = 5
+
+// ShardedStore holds the stores of every ip and token, safe for concurrent use. The stores are
+// spread across shards with their own lock, so goroutines handling different keys rarely contend,
+// and every store has its own lock serializing the operations made on it through Do.
+//
+// The stores implementing ExpiringStore are deleted once expired, by sweeps of their shard made
+// when a store is created at most every SweepInterval, and the amount of stores can be capped with
+// SetMaxEntries, so a flood of distinct keys (e.g.: spoofed IP addresses) can't exhaust the memory.
+type ShardedStore struct {
+	seed        maphash.Seed
+	shards      [shardCount]shard
+	maxEntries  atomic.Int64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+	clock       Clock
+}
+
+type shard struct {
+	mutex   sync.RWMutex
+	entries map[storeKey]*entry
+	swept   time.Time
+}
+
+type storeKey struct {
+	ip    string
+	token string
+}
+
+type entry struct {
+	mutex sync.Mutex
+	store Store
+	// When the store was last used by Do, in nanoseconds since the epoch
+	lastUsed atomic.Int64
+	// Whether the entry was removed from its shard, in which case Do looks the store up again
+	removed atomic.Bool
+}
+
+// ShardedStoreStats are the counters of a ShardedStore
+type ShardedStoreStats struct {
+	// The amount of stores
+	Entries int
+	// The amount of stores deleted to make room for new ones, as the max entries was reached
+	Evictions uint64
+	// The amount of stores deleted by the sweeps, as they expired
+	Expirations uint64
+}
+
+func NewShardedStore() *ShardedStore {
+	ss := &ShardedStore{seed: maphash.MakeSeed(), clock: systemClock{}}
+	now := ss.clock.Now()
+	for i := range ss.shards {
+		ss.shards[i].entries = make(map[storeKey]*entry)
+		ss.shards[i].swept = now
+	}
+	return ss
+}
+
+// SetMaxEntries caps the amount of stores (0 means unlimited): once a shard holds its share of
+// maxEntries, creating a store in it evicts the least recently used of a few sampled ones. As the
+// cap is split evenly across the shards, stores may be evicted before the total reaches maxEntries,
+// and every shard keeps at least one store.
+func (ss *ShardedStore) SetMaxEntries(maxEntries int) {
+	ss.maxEntries.Store(int64(maxEntries))
+}
+
+// SetClock replaces the clock the stores are expired and evicted as of, which is the system clock
+// by default. It must be called before the ShardedStore is used.
+func (ss *ShardedStore) SetClock(clock Clock) {
+	ss.clock = clock
+	now := clock.Now()
+	for i := range ss.shards {
+		ss.shards[i].swept = now
+	}
+}
+
+// Stats returns the counters of the stores
+func (ss *ShardedStore) Stats() ShardedStoreStats {
+	return ShardedStoreStats{
+		Entries:     ss.Len(),
+		Evictions:   ss.evictions.Load(),
+		Expirations: ss.expirations.Load(),
+	}
+}
+
+// NewShardedStoreFrom creates a ShardedStore holding the stores of an IpStore
+func NewShardedStoreFrom(ipStore IpStore) *ShardedStore {
+	ss := NewShardedStore()
+	for ip, tokenStore := range ipStore {
+		for token, s := range tokenStore {
+			ss.Set(ip, token, s)
+		}
+	}
+	return ss
+}
+
+func (ss *ShardedStore) shard(ip string, token string) *shard {
+	var h maphash.Hash
+	h.SetSeed(ss.seed)
+	h.WriteString(ip)
+	h.WriteByte(0)
+	h.WriteString(token)
+	return &ss.shards[h.Sum64()&(shardCount-1)]
+}
+
+// Get returns the store of the ip and token
+func (ss *ShardedStore) Get(ip string, token string) (Store, bool) {
+	sh := ss.shard(ip, token)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+	e, ok := sh.entries[storeKey{ip, token}]
+	if !ok {
+		return nil, false
+	}
+	return e.store, true
+}
+
+// Set sets the store of the ip and token, replacing the existing one
+func (ss *ShardedStore) Set(ip string, token string, s Store) {
+	sh := ss.shard(ip, token)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+	key := storeKey{ip, token}
+	sh.remove(key)
+	sh.entries[key] = newEntry(s, ss.clock.Now())
+}
+
+func newEntry(s Store, now time.Time) *entry {
+	e := &entry{store: s}
+	e.lastUsed.Store(now.UnixNano())
+	return e
+}
+
+// Delete deletes the store of the ip and token
+func (ss *ShardedStore) Delete(ip string, token string) {
+	sh := ss.shard(ip, token)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+	sh.remove(storeKey{ip, token})
+}
+
+// remove deletes the entry of a key from a shard whose lock is held
+func (sh *shard) remove(key storeKey) {
+	if e, ok := sh.entries[key]; ok {
+		e.removed.Store(true)
+		delete(sh.entries, key)
+	}
+}
+
+// Len returns the amount of stores
+func (ss *ShardedStore) Len() int {
+	length := 0
+	for i := range ss.shards {
+		sh := &ss.shards[i]
+		sh.mutex.RLock()
+		length += len(sh.entries)
+		sh.mutex.RUnlock()
+	}
+	return length
+}
+
+// Range calls fn for every store until it returns false. Stores may be added or deleted
+// concurrently, and fn must not call other ShardedStore methods.
+func (ss *ShardedStore) Range(fn func(ip string, token string, s Store) bool) {
+	for i := range ss.shards {
+		sh := &ss.shards[i]
+		sh.mutex.RLock()
+		for key, e := range sh.entries {
+			if !fn(key.ip, key.token, e.store) {
+				sh.mutex.RUnlock()
+				return
+			}
+		}
+		sh.mutex.RUnlock()
+	}
+}
+
+// RangeLocked works like Range, but calls fn while holding the lock of the store instead of the
+// one of its shard, so the stores can be read safely without blocking the creation of the others.
+// The stores deleted before they're reached are skipped, and fn must not call Do.
+func (ss *ShardedStore) RangeLocked(fn func(ip string, token string, s Store) bool) {
+	type keyEntry struct {
+		key   storeKey
+		entry *entry
+	}
+	var entries []keyEntry
+	for i := range ss.shards {
+		sh := &ss.shards[i]
+		sh.mutex.RLock()
+		entries = entries[:0]
+		for key, e := range sh.entries {
+			entries = append(entries, keyEntry{key, e})
+		}
+		sh.mutex.RUnlock()
+
+		for _, ke := range entries {
+			ke.entry.mutex.Lock()
+			next := ke.entry.removed.Load() || fn(ke.key.ip, ke.key.token, ke.entry.store)
+			ke.entry.mutex.Unlock()
+			if !next {
+				return
+			}
+		}
+	}
+}
+
+// Filter calls fn for every store while holding its lock, and deletes the stores it returns false
+// for. fn must not call other ShardedStore methods.
+func (ss *ShardedStore) Filter(fn func(ip string, token string, s Store) bool) {
+	for i := range ss.shards {
+		sh := &ss.shards[i]
+		sh.mutex.Lock()
+		for key, e := range sh.entries {
+			e.mutex.Lock()
+			keep := fn(key.ip, key.token, e.store)
+			e.mutex.Unlock()
+			if !keep {
+				sh.remove(key)
+			}
+		}
+		sh.mutex.Unlock()
+	}
+}
+
+// Do calls fn with the store of the ip and token while holding its lock, creating the store with
+// create first if it doesn't exist yet. created reports whether the store was just created.
+func (ss *ShardedStore) Do(ip string, token string, create func() Store, fn func(s Store, created bool)) {
+	key := storeKey{ip, token}
+	sh := ss.shard(ip, token)
+	now := ss.clock.Now()
+	e, created := ss.lock(sh, key, create, now)
+	defer e.mutex.Unlock()
+	e.lastUsed.Store(now.UnixNano())
+	fn(e.store, created)
+}
+
+// lock locks the entry of a key, creating it with create if it doesn't exist yet. The entry may
+// be removed between the lookup and its lock (e.g.: by a sweep), in which case it's looked up again.
+func (ss *ShardedStore) lock(sh *shard, key storeKey, create func() Store, now time.Time) (*entry, bool) {
+	for {
+		sh.mutex.RLock()
+		e, ok := sh.entries[key]
+		sh.mutex.RUnlock()
+
+		if !ok {
+			sh.mutex.Lock()
+			// Another goroutine may have created it in the meantime
+			if e, ok = sh.entries[key]; !ok {
+				ss.makeRoom(sh, now)
+				e = newEntry(create(), now)
+				sh.entries[key] = e
+				// Locked before the shard is unlocked, so a sweep can't delete it before it's used
+				e.mutex.Lock()
+				sh.mutex.Unlock()
+				return e, true
+			}
+			sh.mutex.Unlock()
+		}
+
+		e.mutex.Lock()
+		if !e.removed.Load() {
+			return e, false
+		}
+		e.mutex.Unlock()
+	}
+}
+
+// Sweep deletes the expired stores as of now, returning how many were deleted
+func (ss *ShardedStore) Sweep(now time.Time) int {
+	deleted := 0
+	for i := range ss.shards {
+		sh := &ss.shards[i]
+		sh.mutex.Lock()
+		deleted += ss.sweep(sh, now)
+		sh.mutex.Unlock()
+	}
+	return deleted
+}
+
+// sweep deletes the expired stores of a shard, whose lock must be held. The stores being used
+// are skipped, as they can't be expired.
+func (ss *ShardedStore) sweep(sh *shard, now time.Time) int {
+	deleted := 0
+	for key, e := range sh.entries {
+		s, ok := e.store.(ExpiringStore)
+		if !ok || !e.mutex.TryLock() {
+			continue
+		}
+		if s.Expired(now) {
+			sh.remove(key)
+			deleted++
+		}
+		e.mutex.Unlock()
+	}
+	sh.swept = now
+	ss.expirations.Add(uint64(deleted))
+	return deleted
+}
+
+// makeRoom sweeps a shard whose lock is held if it wasn't swept for SweepInterval, and evicts the
+// least recently used of a few sampled stores if it's still full. The stores being used are
+// skipped, so the shard may exceed its share while all the sampled ones are.
+func (ss *ShardedStore) makeRoom(sh *shard, now time.Time) {
+	if now.Sub(sh.swept) >= SweepInterval {
+		ss.sweep(sh, now)
+	}
+	maxEntries := ss.maxEntries.Load()
+	if maxEntries <= 0 {
+		return
+	}
+	share := maxEntries / shardCount
+	if share == 0 {
+		share = 1
+	}
+	for int64(len(sh.entries)) >= share {
+		var lru *entry
+		var lruKey storeKey
+		samples := 0
+		// The iteration order of a map is random
+		for key, e := range sh.entries {
+			if e.mutex.TryLock() {
+				if lru == nil || e.lastUsed.Load() < lru.lastUsed.Load() {
+					if lru != nil {
+						lru.mutex.Unlock()
+					}
+					lru, lruKey = e, key
+				} else {
+					e.mutex.Unlock()
+				}
+			}
+			if samples++; samples == evictionSamples {
+				break
+			}
+		}
+		if lru == nil {
+			return
+		}
+		sh.remove(lruKey)
+		lru.mutex.Unlock()
+		ss.evictions.Add(1)
+	}
+}
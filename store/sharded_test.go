@@ -0,0 +1,216 @@
+package store
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedStore(t *testing.T) {
+	ss := NewShardedStoreFrom(IpStore{
+		"1.1.1.1": TokenStore{"": NewInMemoryStore(&StoreConfig{}), "abc123": NewInMemoryStore(&StoreConfig{})},
+	})
+	if ss.Len() != 2 {
+		t.Errorf("Len() returned %d, expected 2", ss.Len())
+	}
+	if _, ok := ss.Get("1.1.1.1", "abc123"); !ok {
+		t.Error("Get() did not find a store of the IpStore")
+	}
+
+	ss.Set("2.2.2.2", "", NewInMemoryStore(&StoreConfig{}))
+	ss.Delete("1.1.1.1", "abc123")
+	if _, ok := ss.Get("1.1.1.1", "abc123"); ok {
+		t.Error("Get() found a deleted store")
+	}
+
+	keys := map[string]bool{}
+	ss.Range(func(ip string, token string, s Store) bool {
+		keys[ip+":"+token] = true
+		return true
+	})
+	if len(keys) != 2 || !keys["1.1.1.1:"] || !keys["2.2.2.2:"] {
+		t.Errorf("Range() returned %v", keys)
+	}
+
+	keys = map[string]bool{}
+	ss.RangeLocked(func(ip string, token string, s Store) bool {
+		keys[ip+":"+token] = true
+		return true
+	})
+	if len(keys) != 2 || !keys["1.1.1.1:"] || !keys["2.2.2.2:"] {
+		t.Errorf("RangeLocked() returned %v", keys)
+	}
+
+	ss.Filter(func(ip string, token string, s Store) bool {
+		return ip == "2.2.2.2"
+	})
+	if _, ok := ss.Get("1.1.1.1", ""); ok || ss.Len() != 1 {
+		t.Errorf("Filter() kept %d stores, expected only the one of 2.2.2.2", ss.Len())
+	}
+}
+
+func TestShardedStore_DoConcurrently(t *testing.T) {
+	ss := NewShardedStore()
+	config := &StoreConfig{MaxRequests: 1000, LimitInSeconds: 60}
+	var created int32
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ip := strconv.Itoa(j % 10)
+				ss.Do(ip, "", func() Store {
+					atomic.AddInt32(&created, 1)
+					return NewInMemoryStore(config)
+				}, func(s Store, _ bool) {
+					s.(AtomicStore).Take()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 10 {
+		t.Errorf("%d stores were created, expected one per key", created)
+	}
+	total := uint(0)
+	ss.Range(func(ip string, token string, s Store) bool {
+		total += s.HitCount()
+		return true
+	})
+	if total != 10000 {
+		t.Errorf("%d hits were counted, expected 10000", total)
+	}
+}
+
+func TestShardedStore_Expiry(t *testing.T) {
+	ss := NewShardedStore()
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 1}
+	for i := 0; i < 100; i++ {
+		ss.Do(strconv.Itoa(i), "", func() Store {
+			return NewInMemoryTokenBucketStore(config)
+		}, func(s Store, created bool) {
+			s.(AtomicStore).Take()
+		})
+	}
+
+	if deleted := ss.Sweep(time.Now()); deleted != 0 {
+		t.Errorf("Sweep() deleted %d stores still counting hits", deleted)
+	}
+	if deleted := ss.Sweep(time.Now().Add(2 * time.Second)); deleted != 100 {
+		t.Errorf("Sweep() deleted %d stores, expected the 100 expired ones", deleted)
+	}
+	if stats := ss.Stats(); stats.Entries != 0 || stats.Expirations != 100 {
+		t.Errorf("Stats() returned %+v", stats)
+	}
+}
+
+func TestShardedStore_MaxEntries(t *testing.T) {
+	ss := NewShardedStore()
+	ss.SetMaxEntries(shardCount * 10)
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 60}
+	for i := 0; i < shardCount*100; i++ {
+		ss.Do(strconv.Itoa(i), "", func() Store {
+			return NewInMemoryStore(config)
+		}, func(s Store, created bool) {})
+	}
+
+	stats := ss.Stats()
+	if stats.Entries > shardCount*10 {
+		t.Errorf("ShardedStore holds %d stores, expected at most %d", stats.Entries, shardCount*10)
+	}
+	if stats.Evictions != uint64(shardCount*100-stats.Entries) {
+		t.Errorf("Stats() returned %d evictions for %d stores", stats.Evictions, stats.Entries)
+	}
+
+	// The most recently used stores are kept
+	if _, ok := ss.Get(strconv.Itoa(shardCount*100-1), ""); !ok {
+		t.Error("The last store created was evicted")
+	}
+}
+
+func TestShardedStore_EvictionSkipsUsedStores(t *testing.T) {
+	ss := NewShardedStore()
+	ss.SetMaxEntries(shardCount)
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 60}
+	create := func() Store {
+		return NewInMemoryStore(config)
+	}
+	// Keys of the same shard, which holds a single store
+	keys := []string{"0"}
+	for i := 1; len(keys) < 3; i++ {
+		if ss.shard(strconv.Itoa(i), "") == ss.shard("0", "") {
+			keys = append(keys, strconv.Itoa(i))
+		}
+	}
+
+	// The store being used isn't evicted by the creation of another one
+	ss.Do(keys[0], "", create, func(s Store, created bool) {
+		ss.Do(keys[1], "", create, func(s Store, created bool) {})
+	})
+	if _, ok := ss.Get("0", ""); !ok {
+		t.Error("The store being used was evicted")
+	}
+
+	// It's evicted once it's not used anymore
+	ss.Do(keys[2], "", create, func(s Store, created bool) {})
+	if _, ok := ss.Get(keys[0], ""); ok {
+		t.Error("The least recently used store wasn't evicted")
+	}
+}
+
+func TestShardedStore_DoRemoved(t *testing.T) {
+	ss := NewShardedStore()
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 60}
+	create := func() Store {
+		return NewInMemoryStore(config)
+	}
+	ss.Do("1.1.1.1", "", create, func(s Store, created bool) {})
+
+	// A store deleted while Do waits for its lock is created again rather than used
+	done := make(chan bool)
+	ss.Do("1.1.1.1", "", create, func(s Store, created bool) {
+		go ss.Do("1.1.1.1", "", create, func(s Store, created bool) {
+			done <- created
+		})
+		time.Sleep(10 * time.Millisecond)
+		ss.Delete("1.1.1.1", "")
+	})
+	if created := <-done; !created {
+		t.Error("Do used the deleted store")
+	}
+}
+
+func TestShardedStore_RangeLockedDoesntBlockTheShard(t *testing.T) {
+	ss := NewShardedStore()
+	create := func() Store {
+		return NewInMemoryStore(&StoreConfig{MaxRequests: 10, LimitInSeconds: 60})
+	}
+	other := ""
+	for i := 1; other == ""; i++ {
+		if ss.shard(strconv.Itoa(i), "") == ss.shard("0", "") {
+			other = strconv.Itoa(i)
+		}
+	}
+
+	// A store of the shard is created while RangeLocked waits for the lock of another one
+	ranged := make(chan bool)
+	ss.Do("0", "", create, func(s Store, created bool) {
+		go func() {
+			ss.RangeLocked(func(ip string, token string, s Store) bool {
+				return true
+			})
+			close(ranged)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		ss.Do(other, "", create, func(s Store, created bool) {})
+	})
+	<-ranged
+	if ss.Len() != 2 {
+		t.Errorf("Len() returned %d, expected 2", ss.Len())
+	}
+}
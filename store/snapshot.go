@@ -0,0 +1,147 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SnapshotStore is implemented by the in-memory stores whose state can be saved, so they can be
+// restored after a restart
+type SnapshotStore interface {
+	Store
+	// MarshalState encodes the state of the store (its counters and block), but not its config
+	MarshalState() ([]byte, error)
+	// RestoreState replaces the state of the store with one encoded by MarshalState
+	RestoreState(state []byte) error
+}
+
+// SnapshotVersion is the version of the snapshot format written by WriteSnapshot
+const SnapshotVersion = 1
+
+// snapshotMagic starts every snapshot
+const snapshotMagic = "RLSNAP"
+
+// maxSnapshotRecord bounds the length of a record, so a corrupt length can't exhaust the memory
+const maxSnapshotRecord = 16 << 20
+
+// ErrCorruptSnapshot is returned when a snapshot is truncated or doesn't match its checksums
+var ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+// SnapshotEntry is the state of the store of an ip and token
+type SnapshotEntry struct {
+	IP    string `json:"ip"`
+	Token string `json:"token"`
+	// The algorithm of the store, which is only restored by a store of the same algorithm
+	Algorithm string          `json:"algorithm"`
+	State     json.RawMessage `json:"state"`
+}
+
+// WriteSnapshot writes the entries in the snapshot format: the magic string and the big-endian
+// uint16 version, then every entry as a record made of its big-endian uint32 length, its JSON
+// encoding and its CRC-32, and finally a zero length followed by the amount of records, so a
+// truncated snapshot is detected
+func WriteSnapshot(w io.Writer, entries []SnapshotEntry) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	binary.Write(bw, binary.BigEndian, uint16(SnapshotVersion))
+	for _, entry := range entries {
+		record, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		binary.Write(bw, binary.BigEndian, uint32(len(record)))
+		bw.Write(record)
+		binary.Write(bw, binary.BigEndian, crc32.ChecksumIEEE(record))
+	}
+	binary.Write(bw, binary.BigEndian, uint32(0))
+	binary.Write(bw, binary.BigEndian, uint32(len(entries)))
+	return bw.Flush()
+}
+
+// ReadSnapshot reads the entries of a snapshot written by WriteSnapshot, returning an error
+// wrapping ErrCorruptSnapshot if it's truncated or a record doesn't match its checksum
+func ReadSnapshot(r io.Reader) ([]SnapshotEntry, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: not a snapshot", ErrCorruptSnapshot)
+	}
+	if version := binary.BigEndian.Uint16(header[len(snapshotMagic):]); version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	var entries []SnapshotEntry
+	for {
+		var length uint32
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+			return nil, fmt.Errorf("%w: truncated after %d records", ErrCorruptSnapshot, len(entries))
+		}
+		if length == 0 {
+			break
+		}
+		if length > maxSnapshotRecord {
+			return nil, fmt.Errorf("%w: record %d is too long", ErrCorruptSnapshot, len(entries)+1)
+		}
+		record := make([]byte, length)
+		var checksum uint32
+		if _, err := io.ReadFull(br, record); err != nil {
+			return nil, fmt.Errorf("%w: truncated after %d records", ErrCorruptSnapshot, len(entries))
+		}
+		if err := binary.Read(br, binary.BigEndian, &checksum); err != nil {
+			return nil, fmt.Errorf("%w: truncated after %d records", ErrCorruptSnapshot, len(entries))
+		}
+		if crc32.ChecksumIEEE(record) != checksum {
+			return nil, fmt.Errorf("%w: record %d doesn't match its checksum", ErrCorruptSnapshot, len(entries)+1)
+		}
+		var entry SnapshotEntry
+		if err := json.Unmarshal(record, &entry); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %s", ErrCorruptSnapshot, len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	var count uint32
+	if err := binary.Read(br, binary.BigEndian, &count); err != nil || int(count) != len(entries) {
+		return nil, fmt.Errorf("%w: expected %d records, read %d", ErrCorruptSnapshot, count, len(entries))
+	}
+	return entries, nil
+}
+
+// SaveSnapshot writes the entries to a file atomically: they're written to a temporary file of the
+// same directory first, which then replaces the file, so a crash can't leave a partial snapshot
+func SaveSnapshot(path string, entries []SnapshotEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := WriteSnapshot(tmp, entries); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot reads the entries of a snapshot file, returning an error wrapping fs.ErrNotExist
+// when there's none
+func LoadSnapshot(path string) ([]SnapshotEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	config := &StoreConfig{MaxRequests: 2, LimitInSeconds: 60, BlockInSeconds: 30}
+	stores := map[string]SnapshotStore{
+		FixedWindowAlgorithm:          NewInMemoryStore(config),
+		TokenBucketAlgorithm:          NewInMemoryTokenBucketStore(config),
+		SlidingWindowLogAlgorithm:     NewInMemorySlidingWindowLogStore(config),
+		SlidingWindowCounterAlgorithm: NewInMemorySlidingWindowCounterStore(config),
+		GCRAAlgorithm:                 NewInMemoryGCRAStore(config),
+		LeakyBucketAlgorithm:          NewInMemoryLeakyBucketStore(config),
+	}
+	var entries []SnapshotEntry
+	for algorithm, s := range stores {
+		// Every store is blocked, the leaky bucket's one by Block as its queue overflowing doesn't block it
+		for i := 0; i < 4; i++ {
+			s.(AtomicStore).Take()
+		}
+		s.Block()
+		state, err := s.MarshalState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, SnapshotEntry{IP: "1.1.1.1", Token: algorithm, Algorithm: algorithm, State: state})
+	}
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := SaveSnapshot(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(entries) {
+		t.Fatalf("Loaded %d entries, expected %d", len(loaded), len(entries))
+	}
+	restored := map[string]SnapshotStore{
+		FixedWindowAlgorithm:          NewInMemoryStore(config),
+		TokenBucketAlgorithm:          NewInMemoryTokenBucketStore(config),
+		SlidingWindowLogAlgorithm:     NewInMemorySlidingWindowLogStore(config),
+		SlidingWindowCounterAlgorithm: NewInMemorySlidingWindowCounterStore(config),
+		GCRAAlgorithm:                 NewInMemoryGCRAStore(config),
+		LeakyBucketAlgorithm:          NewInMemoryLeakyBucketStore(config),
+	}
+	for _, entry := range loaded {
+		s := restored[entry.Algorithm]
+		if err := s.RestoreState(entry.State); err != nil {
+			t.Fatal(err)
+		}
+		if !s.IsBlocked() || s.RemainingBlockTime() != 30 {
+			t.Errorf("The restored %s store is blocked %v for %ds, expected it to be blocked for 30s", entry.Algorithm, s.IsBlocked(), s.RemainingBlockTime())
+		}
+		if result := s.(AtomicStore).Take(); !result.Limited {
+			t.Errorf("The restored %s store allowed a hit", entry.Algorithm)
+		}
+	}
+}
+
+func TestSnapshot_Corruption(t *testing.T) {
+	entries := []SnapshotEntry{
+		{IP: "1.1.1.1", Algorithm: FixedWindowAlgorithm, State: json.RawMessage(`{"hitCount":1}`)},
+		{IP: "2.2.2.2", Algorithm: FixedWindowAlgorithm, State: json.RawMessage(`{"hitCount":2}`)},
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	flipped := bytes.Clone(snapshot)
+	flipped[20] ^= 0xFF
+	versioned := bytes.Clone(snapshot)
+	versioned[len(snapshotMagic)+1] = SnapshotVersion + 1
+	for name, data := range map[string][]byte{
+		"truncated": snapshot[:len(snapshot)-6],
+		"flipped":   flipped,
+		"empty":     nil,
+	} {
+		if _, err := ReadSnapshot(bytes.NewReader(data)); !errors.Is(err, ErrCorruptSnapshot) {
+			t.Errorf("Reading the %s snapshot returned %v, expected ErrCorruptSnapshot", name, err)
+		}
+	}
+	if _, err := ReadSnapshot(bytes.NewReader(versioned)); err == nil || errors.Is(err, ErrCorruptSnapshot) {
+		t.Errorf("Reading a snapshot of another version returned %v, expected an unsupported version", err)
+	}
+}
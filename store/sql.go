@@ -0,0 +1,456 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	"github.com/eliasfeijo/go-rate-limiter/log"
+)
+
+// SQLDialect writes the statements of a SQLDatabase for a database engine. The statements use
+// named parameters (e.g.: :now), bound to the placeholders of the dialect.
+type SQLDialect interface {
+	// Placeholder returns the placeholder of the n-th parameter of a statement, counting from 1
+	Placeholder(n int) string
+	// NumberedPlaceholders reports whether a placeholder can be used several times in a statement
+	// (e.g.: $1), rather than binding a parameter per placeholder (e.g.: ?)
+	NumberedPlaceholders() bool
+	// Migrations returns the statements creating the table of the counters, then upgrading it, in
+	// order. The statements already run are never run again, so new ones must be appended.
+	Migrations(table string) []string
+	// TakeStatement returns the upsert counting a hit (see SQLStore), and whether it returns the
+	// hit_count, window_end, blocked_until and last_hit columns of the row, which are selected
+	// within the same transaction otherwise
+	TakeStatement(table string) (statement string, returning bool)
+	// BlockStatement returns the upsert blocking a key until :blocked_until
+	BlockStatement(table string) string
+}
+
+// The SQL dialects
+var (
+	SQLiteDialect   SQLDialect = sqliteDialect{}
+	PostgresDialect SQLDialect = postgresDialect{}
+	MySQLDialect    SQLDialect = mysqlDialect{}
+)
+
+// SQLDialectByName returns the dialect of its name (sqlite, postgres or mysql), or the dialect of
+// the database/sql driver of its name
+func SQLDialectByName(name string) (SQLDialect, error) {
+	switch name {
+	case "sqlite", "sqlite3":
+		return SQLiteDialect, nil
+	case "postgres", "postgresql", "pgx":
+		return PostgresDialect, nil
+	case "mysql":
+		return MySQLDialect, nil
+	}
+	return nil, fmt.Errorf("unknown SQL dialect %q", name)
+}
+
+// The statements of SQLite and Postgres, which only differ by their placeholders
+var (
+	upsertMigrations = []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			rate_key VARCHAR(255) PRIMARY KEY,
+			hit_count BIGINT NOT NULL,
+			window_end BIGINT NOT NULL,
+			blocked_until BIGINT NOT NULL,
+			last_hit BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_expiry ON %[1]s (window_end, blocked_until)`,
+	}
+	// The expressions of ON CONFLICT DO UPDATE refer to the row as it was before the update
+	upsertTakeStatement = `INSERT INTO %[1]s (rate_key, hit_count, window_end, blocked_until, last_hit)
+		VALUES (:key, 1, :window_end, CASE WHEN 1 > :max THEN CAST(:blocked_until AS BIGINT) ELSE 0 END, :now)
+		ON CONFLICT (rate_key) DO UPDATE SET
+			hit_count = CASE WHEN %[1]s.blocked_until > :now THEN %[1]s.hit_count WHEN %[1]s.window_end <= :now THEN 1 ELSE %[1]s.hit_count + 1 END,
+			window_end = CASE WHEN %[1]s.blocked_until > :now OR %[1]s.window_end > :now THEN %[1]s.window_end ELSE :window_end END,
+			blocked_until = CASE
+				WHEN %[1]s.blocked_until > :now THEN %[1]s.blocked_until
+				WHEN (CASE WHEN %[1]s.window_end <= :now THEN 1 ELSE %[1]s.hit_count + 1 END) > :max THEN :blocked_until
+				ELSE %[1]s.blocked_until END,
+			last_hit = CASE WHEN %[1]s.blocked_until > :now THEN %[1]s.last_hit ELSE :now END
+		RETURNING hit_count, window_end, blocked_until, last_hit`
+	upsertBlockStatement = `INSERT INTO %[1]s (rate_key, hit_count, window_end, blocked_until, last_hit)
+		VALUES (:key, 0, 0, :blocked_until, 0)
+		ON CONFLICT (rate_key) DO UPDATE SET blocked_until = :blocked_until`
+)
+
+func formatAll(statements []string, table string) []string {
+	formatted := make([]string, len(statements))
+	for i, statement := range statements {
+		formatted[i] = fmt.Sprintf(statement, table)
+	}
+	return formatted
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Placeholder(n int) string {
+	return "?" + strconv.Itoa(n)
+}
+
+func (sqliteDialect) NumberedPlaceholders() bool {
+	return true
+}
+
+func (sqliteDialect) Migrations(table string) []string {
+	return formatAll(upsertMigrations, table)
+}
+
+func (sqliteDialect) TakeStatement(table string) (string, bool) {
+	return fmt.Sprintf(upsertTakeStatement, table), true
+}
+
+func (sqliteDialect) BlockStatement(table string) string {
+	return fmt.Sprintf(upsertBlockStatement, table)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgresDialect) NumberedPlaceholders() bool {
+	return true
+}
+
+func (postgresDialect) Migrations(table string) []string {
+	return formatAll(upsertMigrations, table)
+}
+
+func (postgresDialect) TakeStatement(table string) (string, bool) {
+	return fmt.Sprintf(upsertTakeStatement, table), true
+}
+
+func (postgresDialect) BlockStatement(table string) string {
+	return fmt.Sprintf(upsertBlockStatement, table)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (mysqlDialect) NumberedPlaceholders() bool {
+	return false
+}
+
+func (mysqlDialect) Migrations(table string) []string {
+	return []string{
+		fmt.Sprintf(upsertMigrations[0], table),
+		fmt.Sprintf(`CREATE INDEX %[1]s_expiry ON %[1]s (window_end, blocked_until)`, table),
+	}
+}
+
+// TakeStatement returns the upsert of MySQL, whose assignments are made from left to right, each
+// one referring to the columns assigned before it: blocked_until is assigned last, from the new
+// hit_count
+func (mysqlDialect) TakeStatement(table string) (string, bool) {
+	return fmt.Sprintf(`INSERT INTO %[1]s (rate_key, hit_count, window_end, blocked_until, last_hit)
+		VALUES (:key, 1, :window_end, IF(1 > :max, :blocked_until, 0), :now)
+		ON DUPLICATE KEY UPDATE
+			last_hit = IF(blocked_until > :now, last_hit, :now),
+			hit_count = IF(blocked_until > :now, hit_count, IF(window_end <= :now, 1, hit_count + 1)),
+			window_end = IF(blocked_until > :now OR window_end > :now, window_end, :window_end),
+			blocked_until = IF(blocked_until > :now, blocked_until, IF(hit_count > :max, :blocked_until, blocked_until))`, table), false
+}
+
+func (mysqlDialect) BlockStatement(table string) string {
+	return fmt.Sprintf(`INSERT INTO %[1]s (rate_key, hit_count, window_end, blocked_until, last_hit)
+		VALUES (:key, 0, 0, :blocked_until, 0)
+		ON DUPLICATE KEY UPDATE blocked_until = :blocked_until`, table)
+}
+
+// sqlStatement is a statement bound to the placeholders of a dialect
+type sqlStatement struct {
+	query string
+	// The names of the parameters, in the order of their placeholders
+	params []string
+}
+
+var sqlParam = regexp.MustCompile(`:[a-z_]+`)
+
+func newSQLStatement(dialect SQLDialect, statement string) sqlStatement {
+	var params []string
+	numbers := make(map[string]int)
+	query := sqlParam.ReplaceAllStringFunc(statement, func(param string) string {
+		name := param[1:]
+		if !dialect.NumberedPlaceholders() {
+			params = append(params, name)
+			return dialect.Placeholder(len(params))
+		}
+		if _, ok := numbers[name]; !ok {
+			params = append(params, name)
+			numbers[name] = len(params)
+		}
+		return dialect.Placeholder(numbers[name])
+	})
+	return sqlStatement{query, params}
+}
+
+// args returns the values of the parameters in the order of their placeholders
+func (s sqlStatement) args(values map[string]any) []any {
+	args := make([]any, len(s.params))
+	for i, param := range s.params {
+		args[i] = values[param]
+	}
+	return args
+}
+
+// sqlQuerier is implemented by *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s sqlStatement) exec(ctx context.Context, q sqlQuerier, values map[string]any) (sql.Result, error) {
+	return q.ExecContext(ctx, s.query, s.args(values)...)
+}
+
+func (s sqlStatement) queryRow(ctx context.Context, q sqlQuerier, values map[string]any) *sql.Row {
+	return q.QueryRowContext(ctx, s.query, s.args(values)...)
+}
+
+// SQLDatabase holds the counters of the SQLStores in a table of a relational database, so they
+// survive restarts and are shared by the instances using the database
+type SQLDatabase struct {
+	db        *sql.DB
+	dialect   SQLDialect
+	table     string
+	take      sqlStatement
+	returning bool
+	block     sqlStatement
+	selectRow sqlStatement
+	deleteRow sqlStatement
+	cleanup   sqlStatement
+	// Whether the database is closed with the SQLDatabase
+	ownsDB bool
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewSQLDatabase creates a SQLDatabase holding the counters in the table of a database, whose
+// schema must be created with Migrate
+func NewSQLDatabase(db *sql.DB, dialect SQLDialect, table string) *SQLDatabase {
+	take, returning := dialect.TakeStatement(table)
+	return &SQLDatabase{
+		db:        db,
+		dialect:   dialect,
+		table:     table,
+		take:      newSQLStatement(dialect, take),
+		returning: returning,
+		block:     newSQLStatement(dialect, dialect.BlockStatement(table)),
+		selectRow: newSQLStatement(dialect, "SELECT hit_count, window_end, blocked_until, last_hit FROM "+table+" WHERE rate_key = :key"),
+		deleteRow: newSQLStatement(dialect, "DELETE FROM "+table+" WHERE rate_key = :key"),
+		cleanup:   newSQLStatement(dialect, "DELETE FROM "+table+" WHERE window_end <= :now AND blocked_until <= :now"),
+	}
+}
+
+// OpenSQLDatabase opens the database of the SQL configuration, migrates its schema, and starts
+// deleting the expired counters every cleanup interval until it's closed
+func OpenSQLDatabase(cfg config.SQLConfig) (*SQLDatabase, error) {
+	name := cfg.Dialect
+	if name == "" {
+		name = cfg.Driver
+	}
+	dialect, err := SQLDialectByName(name)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == SQLiteDialect {
+		// SQLite only has a single writer (and every connection has its own in-memory database)
+		db.SetMaxOpenConns(1)
+	}
+	table := cfg.Table
+	if table == "" {
+		table = "rate_limiter_counters"
+	}
+	d := NewSQLDatabase(db, dialect, table)
+	d.ownsDB = true
+	if err := d.Migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if cfg.CleanupIntervalInSeconds > 0 {
+		d.StartCleanup(time.Duration(cfg.CleanupIntervalInSeconds) * time.Second)
+	}
+	return d, nil
+}
+
+// Migrate runs the migrations of the dialect that weren't run yet on the database, each one in its
+// own transaction, keeping track of them in the <table>_migrations table
+func (d *SQLDatabase) Migrate(ctx context.Context) error {
+	migrations := d.table + "_migrations"
+	if _, err := d.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+migrations+" (version INTEGER PRIMARY KEY)"); err != nil {
+		return err
+	}
+	applied := newSQLStatement(d.dialect, "SELECT COUNT(*) FROM "+migrations+" WHERE version = :version")
+	insert := newSQLStatement(d.dialect, "INSERT INTO "+migrations+" (version) VALUES (:version)")
+	for i, migration := range d.dialect.Migrations(d.table) {
+		values := map[string]any{"version": i + 1}
+		isApplied := func() (bool, error) {
+			var count int
+			err := applied.queryRow(ctx, d.db, values).Scan(&count)
+			return count > 0, err
+		}
+		if ok, err := isApplied(); err != nil || ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := d.migrate(ctx, migration, insert, values)
+		if err != nil {
+			// Another instance may have run the migration in the meantime
+			if ok, _ := isApplied(); ok {
+				continue
+			}
+			return fmt.Errorf("migration %d of %s: %w", i+1, d.table, err)
+		}
+	}
+	return nil
+}
+
+func (d *SQLDatabase) migrate(ctx context.Context, migration string, insert sqlStatement, values map[string]any) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := insert.exec(ctx, tx, values); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Cleanup deletes the counters whose window and block are over as of now, returning how many were
+// deleted
+func (d *SQLDatabase) Cleanup(ctx context.Context, now time.Time) (int64, error) {
+	result, err := d.cleanup.exec(ctx, d.db, map[string]any{"now": now.UnixMilli()})
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StartCleanup deletes the expired counters every interval until the SQLDatabase is closed
+func (d *SQLDatabase) StartCleanup(interval time.Duration) {
+	if d.stop != nil {
+		return
+	}
+	d.stop, d.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case now := <-ticker.C:
+				if _, err := d.Cleanup(context.Background(), now); err != nil {
+					log.Logf(log.Error, "Error deleting the expired counters of %s: %s", d.table, err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the cleanup, and closes the database when it was opened by OpenSQLDatabase
+func (d *SQLDatabase) Close() error {
+	var err error
+	d.closeOnce.Do(func() {
+		if d.stop != nil {
+			close(d.stop)
+			<-d.done
+		}
+		if d.ownsDB {
+			err = d.db.Close()
+		}
+	})
+	return err
+}
+
+// sqlRow is the counter of a key
+type sqlRow struct {
+	hitCount     uint
+	windowEnd    time.Time
+	blockedUntil time.Time
+	lastHit      time.Time
+}
+
+func scanSQLRow(row *sql.Row) (sqlRow, error) {
+	var hitCount, windowEnd, blockedUntil, lastHit int64
+	err := row.Scan(&hitCount, &windowEnd, &blockedUntil, &lastHit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sqlRow{}, nil
+	}
+	if err != nil {
+		return sqlRow{}, err
+	}
+	r := sqlRow{hitCount: uint(hitCount), windowEnd: time.UnixMilli(windowEnd), blockedUntil: time.UnixMilli(blockedUntil)}
+	if lastHit > 0 {
+		r.lastHit = time.UnixMilli(lastHit)
+	}
+	return r, nil
+}
+
+// takeRow counts a hit of the key as of now, returning its counter
+func (d *SQLDatabase) takeRow(ctx context.Context, key string, config *StoreConfig, now time.Time) (sqlRow, error) {
+	values := map[string]any{
+		"key":           key,
+		"now":           now.UnixMilli(),
+		"max":           int64(config.MaxRequests),
+		"window_end":    now.Add(config.Window()).UnixMilli(),
+		"blocked_until": now.Add(time.Duration(config.BlockInSeconds) * time.Second).UnixMilli(),
+	}
+	if d.returning {
+		return scanSQLRow(d.take.queryRow(ctx, d.db, values))
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlRow{}, err
+	}
+	defer tx.Rollback()
+	if _, err := d.take.exec(ctx, tx, values); err != nil {
+		return sqlRow{}, err
+	}
+	row, err := scanSQLRow(d.selectRow.queryRow(ctx, tx, values))
+	if err != nil {
+		return sqlRow{}, err
+	}
+	return row, tx.Commit()
+}
+
+func (d *SQLDatabase) getRow(ctx context.Context, key string) (sqlRow, error) {
+	return scanSQLRow(d.selectRow.queryRow(ctx, d.db, map[string]any{"key": key}))
+}
+
+func (d *SQLDatabase) blockRow(ctx context.Context, key string, blockedUntil time.Time) error {
+	_, err := d.block.exec(ctx, d.db, map[string]any{"key": key, "blocked_until": blockedUntil.UnixMilli()})
+	return err
+}
+
+func (d *SQLDatabase) deleteKey(ctx context.Context, key string) error {
+	_, err := d.deleteRow.exec(ctx, d.db, map[string]any{"key": key})
+	return err
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// SQLStore implements the fixed window algorithm on a SQLDatabase: every hit is counted by a single
+// upsert of the key's row, which starts a new window once the current one is over, and blocks the
+// key once the hits exceed the limit, so concurrent instances sharing the database can't
+// interleave the steps of a decision. The windows and blocks are computed from the clock of the
+// instances, which must be synchronized.
+type SQLStore struct {
+	db     *SQLDatabase
+	config *StoreConfig
+	clock  Clock
+	key    string
+	result Result
+}
+
+func NewSQLStore(db *SQLDatabase, ip string, token string, config *StoreConfig) *SQLStore {
+	return &SQLStore{db: db, config: config, clock: config.clock(), key: redisKey(ip, token)}
+}
+
+func (s *SQLStore) SetConfig(config *StoreConfig) {
+	s.config = config
+}
+
+func (s *SQLStore) Take() Result {
+	return logged(s.TakeContext(context.Background()))
+}
+
+func (s *SQLStore) TakeContext(ctx context.Context) (Result, error) {
+	now := s.clock.Now()
+	row, err := s.db.takeRow(ctx, s.key, s.config, now)
+	if err != nil {
+		s.result = Result{Err: err}
+		return s.result, err
+	}
+	result := Result{
+		Blocked:    now.Before(row.blockedUntil),
+		HitCount:   row.hitCount,
+		ResetAfter: positive(maxDuration(row.windowEnd.Sub(now), row.blockedUntil.Sub(now))),
+	}
+	result.Limited = result.Blocked || row.hitCount > s.config.MaxRequests
+	if result.Blocked {
+		result.RemainingBlockTime = uint(math.Ceil(row.blockedUntil.Sub(now).Seconds()))
+	}
+	if result.Limited {
+		result.RetryAfter = result.ResetAfter
+	}
+	s.result = result
+	return result, nil
+}
+
+// ShouldLimit returns whether the last hit was limited
+func (s *SQLStore) ShouldLimit() bool {
+	return s.result.Limited
+}
+
+// ShouldRefresh always returns false, as the window is started by Take
+func (s *SQLStore) ShouldRefresh() bool {
+	return false
+}
+
+// Refresh deletes the row of the key, so it starts over on the next hit
+func (s *SQLStore) Refresh() {
+	logFailure(s.RefreshContext(context.Background()))
+}
+
+func (s *SQLStore) RefreshContext(ctx context.Context) error {
+	return s.db.deleteKey(ctx, s.key)
+}
+
+func (s *SQLStore) IsBlocked() bool {
+	return logged(s.IsBlockedContext(context.Background()))
+}
+
+func (s *SQLStore) IsBlockedContext(ctx context.Context) (bool, error) {
+	row, err := s.db.getRow(ctx, s.key)
+	return s.clock.Now().Before(row.blockedUntil), err
+}
+
+func (s *SQLStore) RemainingBlockTime() uint {
+	return logged(s.RemainingBlockTimeContext(context.Background()))
+}
+
+func (s *SQLStore) RemainingBlockTimeContext(ctx context.Context) (uint, error) {
+	row, err := s.db.getRow(ctx, s.key)
+	remaining := row.blockedUntil.Sub(s.clock.Now())
+	if err != nil || remaining <= 0 {
+		return 0, err
+	}
+	return uint(math.Ceil(remaining.Seconds())), nil
+}
+
+func (s *SQLStore) Block() {
+	logFailure(s.BlockContext(context.Background()))
+}
+
+func (s *SQLStore) BlockContext(ctx context.Context) error {
+	if s.config.BlockInSeconds == 0 {
+		return nil
+	}
+	return s.db.blockRow(ctx, s.key, s.clock.Now().Add(time.Duration(s.config.BlockInSeconds)*time.Second))
+}
+
+func (s *SQLStore) Hit() {
+	s.Take()
+}
+
+// Expired always returns true, as the state is kept by the database
+func (s *SQLStore) Expired(now time.Time) bool {
+	return true
+}
+
+func (s *SQLStore) LastHit() time.Time {
+	return logged(s.LastHitContext(context.Background()))
+}
+
+func (s *SQLStore) LastHitContext(ctx context.Context) (time.Time, error) {
+	row, err := s.db.getRow(ctx, s.key)
+	return row.lastHit, err
+}
+
+// HitCount returns the amount of hits counted in the current window
+func (s *SQLStore) HitCount() uint {
+	return logged(s.HitCountContext(context.Background()))
+}
+
+func (s *SQLStore) HitCountContext(ctx context.Context) (uint, error) {
+	row, err := s.db.getRow(ctx, s.key)
+	if err != nil || !s.clock.Now().Before(row.windowEnd) {
+		return 0, err
+	}
+	return row.hitCount, nil
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func sqliteConfig(t *testing.T) config.SQLConfig {
+	return config.SQLConfig{Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "rate_limiter.db")}
+}
+
+func setupSQL(t *testing.T, cfg config.SQLConfig) *SQLDatabase {
+	db, err := OpenSQLDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLStore_Take(t *testing.T) {
+	db := setupSQL(t, sqliteConfig(t))
+	config := &StoreConfig{MaxRequests: 3, LimitInSeconds: 60, BlockInSeconds: 30}
+	store := NewSQLStore(db, "1.1.1.1", "", config)
+
+	for i := uint(1); i <= 3; i++ {
+		if result := store.Take(); result.Err != nil || result.Limited || result.HitCount != i {
+			t.Fatalf("Hit %d returned %+v", i, result)
+		}
+	}
+	result := store.Take()
+	if !result.Limited || !result.Blocked || result.RemainingBlockTime != 30 || result.RetryAfter < 29*time.Second {
+		t.Errorf("Hit over the limit returned %+v, expected it to be limited and blocked", result)
+	}
+	// The hits aren't counted while the key is blocked
+	if result := store.Take(); !result.Limited || result.HitCount != 4 {
+		t.Errorf("Hit while blocked returned %+v", result)
+	}
+	if !store.IsBlocked() || store.HitCount() != 4 || store.LastHit().IsZero() {
+		t.Errorf("The store is blocked %v with %d hits, last hit at %s", store.IsBlocked(), store.HitCount(), store.LastHit())
+	}
+
+	store.Refresh()
+	if result := store.Take(); result.Limited || result.HitCount != 1 {
+		t.Errorf("Hit after a refresh returned %+v", result)
+	}
+	store.Block()
+	if result := store.Take(); !result.Limited || !result.Blocked {
+		t.Errorf("Hit after a block returned %+v", result)
+	}
+}
+
+func TestSQLStore_SharedLimit(t *testing.T) {
+	db := setupSQL(t, sqliteConfig(t))
+	config := &StoreConfig{MaxRequests: 10, LimitInSeconds: 60}
+
+	// Concurrent stores of the same key never admit more hits than the limit
+	var allowed int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := NewSQLStore(db, "1.1.1.1", "", config).Take()
+			if result.Err != nil {
+				t.Error(result.Err)
+			} else if !result.Limited {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 10 {
+		t.Errorf("%d hits were allowed, expected exactly 10", allowed)
+	}
+}
+
+func TestSQLDatabase_Restart(t *testing.T) {
+	cfg := sqliteConfig(t)
+	config := &StoreConfig{MaxRequests: 3, LimitInSeconds: 60}
+	db, err := OpenSQLDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewSQLStore(db, "1.1.1.1", "", config).Take()
+	NewSQLStore(db, "1.1.1.1", "", config).Take()
+	db.Close()
+
+	// The counters survive a restart, and the migrations aren't run twice
+	db = setupSQL(t, cfg)
+	if hitCount := NewSQLStore(db, "1.1.1.1", "", config).HitCount(); hitCount != 2 {
+		t.Errorf("Counted %d hits after a restart, expected 2", hitCount)
+	}
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLDatabase_Cleanup(t *testing.T) {
+	db := setupSQL(t, sqliteConfig(t))
+	NewSQLStore(db, "1.1.1.1", "", &StoreConfig{MaxRequests: 3, LimitInSeconds: 1}).Take()
+	NewSQLStore(db, "2.2.2.2", "", &StoreConfig{MaxRequests: 0, LimitInSeconds: 1, BlockInSeconds: 60}).Take()
+
+	if deleted, err := db.Cleanup(context.Background(), time.Now()); err != nil || deleted != 0 {
+		t.Errorf("Deleted %d counters (%v) before they expired", deleted, err)
+	}
+	// The blocked key is kept until its block is over
+	if deleted, err := db.Cleanup(context.Background(), time.Now().Add(2*time.Second)); err != nil || deleted != 1 {
+		t.Errorf("Deleted %d counters (%v), expected the one whose window is over", deleted, err)
+	}
+}
+
+func TestSQLStatement(t *testing.T) {
+	statement := "SELECT :a, :b, :a"
+	for _, tt := range []struct {
+		dialect SQLDialect
+		query   string
+		params  []string
+	}{
+		{SQLiteDialect, "SELECT ?1, ?2, ?1", []string{"a", "b"}},
+		{PostgresDialect, "SELECT $1, $2, $1", []string{"a", "b"}},
+		{MySQLDialect, "SELECT ?, ?, ?", []string{"a", "b", "a"}},
+	} {
+		s := newSQLStatement(tt.dialect, statement)
+		if s.query != tt.query || !reflect.DeepEqual(s.params, tt.params) {
+			t.Errorf("%T bound %q to %q %v, expected %q %v", tt.dialect, statement, s.query, s.params, tt.query, tt.params)
+		}
+	}
+}
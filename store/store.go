@@ -1,12 +1,36 @@
 package store
 
 import (
+	"context"
 	"time"
 )
 
 const (
 	InMemoryStoreStrategy = "in_memory"
 	RedisStoreStrategy    = "redis"
+	// HybridStoreStrategy counts the hits leased from Redis locally, see HybridStore
+	HybridStoreStrategy = "hybrid"
+	// GossipStoreStrategy shares the counters between the nodes without Redis, see GossipNode
+	GossipStoreStrategy = "gossip"
+	// RemoteStoreStrategy forwards the decisions of every key to the instance owning it, see RemoteNode
+	RemoteStoreStrategy = "remote"
+	// SQLStoreStrategy counts the hits in a relational database, see SQLDatabase
+	SQLStoreStrategy = "sql"
+)
+
+const (
+	// FixedWindowAlgorithm counts the requests made within a window of LimitInSeconds
+	FixedWindowAlgorithm = "fixed_window"
+	// TokenBucketAlgorithm allows bursts of up to MaxRequests, refilling MaxRequests tokens every LimitInSeconds
+	TokenBucketAlgorithm = "token_bucket"
+	// SlidingWindowLogAlgorithm keeps the timestamp of every request made within the last LimitInSeconds
+	SlidingWindowLogAlgorithm = "sliding_window_log"
+	// SlidingWindowCounterAlgorithm weights the previous window's count by its overlap with the sliding window
+	SlidingWindowCounterAlgorithm = "sliding_window_counter"
+	// GCRAAlgorithm spaces requests evenly, only keeping the theoretical arrival time of the next one
+	GCRAAlgorithm = "gcra"
+	// LeakyBucketAlgorithm queues up to MaxRequests requests and releases them evenly over LimitInSeconds
+	LeakyBucketAlgorithm = "leaky_bucket"
 )
 
 type Store interface {
@@ -21,6 +45,77 @@ type Store interface {
 	HitCount() uint
 }
 
+// Result is the outcome of a limiter decision
+type Result struct {
+	// Whether the hit was limited
+	Limited bool
+	// Whether the key is blocked
+	Blocked bool
+	// The amount of hits counted against the limit after the decision
+	HitCount uint
+	// The remaining block time in seconds
+	RemainingBlockTime uint
+	// How long the hit must be held back before being handled (only set by a DelayedStore)
+	Delay time.Duration
+	// The time left until no hits are counted against the limit anymore
+	ResetAfter time.Duration
+	// The time left until a hit would be accepted again (only set when the hit was limited)
+	RetryAfter time.Duration
+	// The error preventing the store from taking the decision (e.g.: Redis is unavailable or the
+	// context was canceled), in which case the other fields aren't set
+	Err error
+}
+
+// AtomicStore is implemented by the stores that take a whole limiter decision in a single
+// operation, so concurrent instances sharing the store can't interleave its steps
+type AtomicStore interface {
+	Store
+	// Take counts a hit unless the key is blocked, and decides whether it's limited,
+	// blocking the key when it is
+	Take() Result
+}
+
+// ContextStore is implemented by the stores backed by a remote server (e.g.: Redis), whose
+// operations take a context bounding their calls to the server (such as the context of the
+// request being limited), and return the errors preventing them instead of only logging them.
+// A missing key isn't an error, the operations returning the values of an empty store instead.
+// The ShouldLimit, ShouldRefresh and Hit steps have no context version, as they're replaced by
+// TakeContext.
+type ContextStore interface {
+	AtomicStore
+	// TakeContext works like Take, the result also holding the returned error
+	TakeContext(ctx context.Context) (Result, error)
+	RefreshContext(ctx context.Context) error
+	IsBlockedContext(ctx context.Context) (bool, error)
+	RemainingBlockTimeContext(ctx context.Context) (uint, error)
+	BlockContext(ctx context.Context) error
+	LastHitContext(ctx context.Context) (time.Time, error)
+	HitCountContext(ctx context.Context) (uint, error)
+}
+
+// DelayedStore is implemented by the stores that hold requests back instead of limiting them right away
+type DelayedStore interface {
+	Store
+	// Delay returns how long the last accepted hit must wait before being handled
+	Delay() time.Duration
+}
+
+// ConfigurableStore is implemented by the stores whose limits can be changed without losing their counters
+type ConfigurableStore interface {
+	Store
+	// SetConfig replaces the limits of the store, which apply from its next hit on
+	SetConfig(config *StoreConfig)
+}
+
+// ExpiringStore is implemented by the stores that can tell when they hold no state anymore,
+// so a ShardedStore can delete them and create them again on the next hit without any change
+type ExpiringStore interface {
+	Store
+	// Expired reports whether the store is back to its initial state as of now (i.e.: no hits
+	// are counted against the limit anymore and the key isn't blocked)
+	Expired(now time.Time) bool
+}
+
 type TokenStore map[string]Store
 type IpStore map[string]TokenStore
 
@@ -28,6 +123,47 @@ type StoreConfig struct {
 	MaxRequests    uint
 	LimitInSeconds uint
 	BlockInSeconds uint
+	// Max time a request may be held back by a DelayedStore (0 means it's only bounded by MaxRequests)
+	MaxWaitInSeconds uint
+	// The clock the decisions are taken as of (the system clock when nil), e.g. a fake one
+	// controlled by a test. It's read when a store is created, and kept by SetConfig.
+	Clock Clock `json:"-"`
+}
+
+// Window returns the limit duration, which is at least one second
+func (c *StoreConfig) Window() time.Duration {
+	if c.LimitInSeconds == 0 {
+		return time.Second
+	}
+	return time.Duration(c.LimitInSeconds) * time.Second
+}
+
+// EmissionInterval returns the interval between two requests evenly spaced by the GCRA algorithm
+func (c *StoreConfig) EmissionInterval() time.Duration {
+	if c.MaxRequests == 0 {
+		return c.Window()
+	}
+	return c.Window() / time.Duration(c.MaxRequests)
+}
+
+// RefillRate returns the amount of tokens per second refilled by the token bucket algorithm
+func (c *StoreConfig) RefillRate() float64 {
+	return float64(c.MaxRequests) / c.Window().Seconds()
+}
+
+// positive returns d, or 0 when it's negative
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func maxDuration(a time.Duration, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
 }
 
 type StoreCreatedCallback func(store Store) Store
@@ -0,0 +1,321 @@
+// Package storetest is a conformance suite checking that an implementation of store.Store takes
+// the decisions expected from its algorithm: the window rollover, the blocking, the remaining
+// block time and the limit under concurrent hits. The suite controls the time of the stores with
+// a Clock, so the same checks run against the in-memory stores, Redis, or any other backend.
+package storetest
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eliasfeijo/go-rate-limiter/store"
+)
+
+// Backend creates the stores checked by the suite. A new Backend is created for every check, along
+// with the Clock of its stores, so the checks don't share any state.
+type Backend struct {
+	// NewStore creates the store of an ip and token, which must implement store.AtomicStore. The
+	// Clock of the check is set on the config.
+	NewStore func(ip string, token string, config *store.StoreConfig) store.Store
+	// Advance is called after the clock moved forward by d, so the backend can expire its state
+	// as of the new time (e.g.: miniredis.FastForward). It may be nil.
+	Advance func(d time.Duration)
+	// Shared reports whether the stores created for the same key share their state atomically
+	// (e.g.: they're backed by the same Redis server), in which case the concurrent hits are spread
+	// across several ShardedStores, as if they were taken by several instances
+	Shared bool
+	// Queued reports whether the hits over the limit are limited by a queue (e.g.: the leaky
+	// bucket), which doesn't block the key when it overflows, only Block does
+	Queued bool
+}
+
+// Clock is a store.Clock whose time only changes when it's advanced
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the time forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// start is the time of the clock when a check starts, which is aligned on the windows of the checks
+var start = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// sharedInstances is the amount of instances the concurrent hits are spread across when the
+// stores of the Backend are shared
+const sharedInstances = 5
+
+// harness runs a check against a new Backend, as of the Clock of its stores
+type harness struct {
+	*testing.T
+	backend Backend
+	clock   *Clock
+}
+
+// Run runs the conformance suite against the stores created by the Backends of newBackend, which
+// is given the Clock of the check to pass to the parts of the backend keeping the time themselves
+// (e.g.: a store.GossipNode)
+func Run(t *testing.T, newBackend func(t *testing.T, clock store.Clock) Backend) {
+	checks := []struct {
+		name  string
+		check func(h *harness)
+	}{
+		{"Limit", testLimit},
+		{"Block", testBlock},
+		{"Rollover", testRollover},
+		{"Refresh", testRefresh},
+		{"Keys", testKeys},
+		{"Concurrency", testConcurrency},
+	}
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			clock := NewClock(start)
+			c.check(&harness{T: t, backend: newBackend(t, clock), clock: clock})
+		})
+	}
+}
+
+// newStore creates the store of an ip and token, failing the check if it isn't atomic
+func (h *harness) newStore(ip string, token string, config *store.StoreConfig) store.AtomicStore {
+	h.Helper()
+	config.Clock = h.clock
+	s, ok := h.backend.NewStore(ip, token, config).(store.AtomicStore)
+	if !ok {
+		h.Fatalf("The store of the backend doesn't implement store.AtomicStore")
+	}
+	return s
+}
+
+// advance moves the clock and the backend forward by d
+func (h *harness) advance(d time.Duration) {
+	h.clock.Advance(d)
+	if h.backend.Advance != nil {
+		h.backend.Advance(d)
+	}
+}
+
+// take takes a hit, failing the check if the store returned an error, or a result whose timing
+// doesn't match its decision
+func (h *harness) take(s store.AtomicStore) store.Result {
+	h.Helper()
+	result := s.Take()
+	if result.Err != nil {
+		h.Fatalf("Take() returned an error: %s", result.Err)
+	}
+	if result.Limited && result.RetryAfter <= 0 {
+		h.Errorf("The limited hit returned %+v, expected a RetryAfter", result)
+	}
+	if !result.Limited && result.RetryAfter != 0 {
+		h.Errorf("The accepted hit returned %+v, expected no RetryAfter", result)
+	}
+	if result.Blocked && !result.Limited {
+		h.Errorf("The hit returned %+v, a blocked key must be limited", result)
+	}
+	return result
+}
+
+// fill takes the MaxRequests hits accepted by a new store
+func (h *harness) fill(s store.AtomicStore, config *store.StoreConfig) {
+	h.Helper()
+	for i := uint(1); i <= config.MaxRequests; i++ {
+		if result := h.take(s); result.Limited || result.HitCount != i {
+			h.Fatalf("Hit %d of %d returned %+v, expected it to be accepted", i, config.MaxRequests, result)
+		}
+	}
+}
+
+// overLimit takes the hit over the limit of a filled store, which blocks the key unless its hits
+// are queued, in which case the key is blocked by Block before taking another one
+func (h *harness) overLimit(s store.AtomicStore) store.Result {
+	h.Helper()
+	result := h.take(s)
+	if !result.Limited {
+		h.Fatalf("Hit over the limit returned %+v, expected it to be limited", result)
+	}
+	if !h.backend.Queued {
+		return result
+	}
+	if result.Blocked || s.IsBlocked() {
+		h.Errorf("Hit over the limit returned %+v, expected the queue not to block the key", result)
+	}
+	s.Block()
+	return h.take(s)
+}
+
+// testLimit checks that the hits over the limit are limited, without blocking the key when
+// there's no block duration
+func testLimit(h *harness) {
+	config := &store.StoreConfig{MaxRequests: 3, LimitInSeconds: 10}
+	s := h.newStore("1.1.1.1", "", config)
+	h.fill(s, config)
+	for i := 0; i < 2; i++ {
+		if result := h.take(s); !result.Limited || result.Blocked || result.RemainingBlockTime != 0 {
+			h.Errorf("Hit over the limit returned %+v, expected it to be limited without a block", result)
+		}
+	}
+	if s.IsBlocked() {
+		h.Error("The key is blocked without a block duration")
+	}
+}
+
+// testBlock checks that the key is blocked for the block duration once it's over the limit (or
+// blocked by Block when its hits are queued), and that the hits are accepted again once the
+// returned RetryAfter passed
+func testBlock(h *harness) {
+	config := &store.StoreConfig{MaxRequests: 3, LimitInSeconds: 10, BlockInSeconds: 30}
+	s := h.newStore("1.1.1.1", "", config)
+	h.fill(s, config)
+	result := h.overLimit(s)
+	if !result.Limited || !result.Blocked || result.RemainingBlockTime != 30 {
+		h.Fatalf("Hit over the limit returned %+v, expected it to be blocked for 30s", result)
+	}
+	if !s.IsBlocked() || s.RemainingBlockTime() != 30 {
+		h.Errorf("The store is blocked %v for %ds, expected it to be blocked for 30s", s.IsBlocked(), s.RemainingBlockTime())
+	}
+	retryAfter := result.RetryAfter
+	if retryAfter < 30*time.Second {
+		h.Errorf("Hit over the limit returned a RetryAfter of %s, expected at least the block duration", retryAfter)
+	}
+
+	// The block isn't extended by the hits taken while blocked
+	h.advance(10 * time.Second)
+	if result := h.take(s); !result.Limited || !result.Blocked || result.RemainingBlockTime != 20 {
+		h.Errorf("Hit while blocked returned %+v, expected it to be blocked for 20s", result)
+	}
+	if remaining := s.RemainingBlockTime(); remaining != 20 {
+		h.Errorf("The store is blocked for %ds, expected 20s", remaining)
+	}
+
+	h.advance(retryAfter - 10*time.Second - time.Millisecond)
+	if result := h.take(s); !result.Limited {
+		h.Errorf("Hit before the RetryAfter passed returned %+v, expected it to be limited", result)
+	}
+	h.advance(time.Millisecond)
+	if result := h.take(s); result.Limited || result.Blocked {
+		h.Errorf("Hit after the RetryAfter passed returned %+v, expected it to be accepted", result)
+	}
+	if s.IsBlocked() || s.RemainingBlockTime() != 0 {
+		h.Errorf("The store is still blocked %v for %ds after the block", s.IsBlocked(), s.RemainingBlockTime())
+	}
+}
+
+// testRollover checks that the hits are accepted again once the returned RetryAfter passed, and
+// that no hits are counted anymore once the returned ResetAfter passed
+func testRollover(h *harness) {
+	config := &store.StoreConfig{MaxRequests: 3, LimitInSeconds: 10}
+	s := h.newStore("1.1.1.1", "", config)
+	h.fill(s, config)
+	result := h.take(s)
+	if !result.Limited {
+		h.Fatalf("Hit over the limit returned %+v, expected it to be limited", result)
+	}
+	// The sliding window counter weights the hits of the previous window, so they may count for two
+	if result.RetryAfter > 2*config.Window() {
+		h.Errorf("Hit over the limit returned a RetryAfter of %s, expected at most two windows", result.RetryAfter)
+	}
+
+	h.advance(result.RetryAfter)
+	result = h.take(s)
+	if result.Limited {
+		h.Fatalf("Hit after the RetryAfter passed returned %+v, expected it to be accepted", result)
+	}
+	if result.ResetAfter <= 0 || result.ResetAfter > 2*config.Window() {
+		h.Errorf("The accepted hit returned a ResetAfter of %s, expected at most two windows", result.ResetAfter)
+	}
+
+	h.advance(result.ResetAfter)
+	if hitCount := s.HitCount(); hitCount != 0 {
+		h.Errorf("The store counted %d hits after the ResetAfter passed, expected none", hitCount)
+	}
+	h.fill(s, config)
+}
+
+// testRefresh checks that a refresh forgets the hits and the block of the key
+func testRefresh(h *harness) {
+	config := &store.StoreConfig{MaxRequests: 3, LimitInSeconds: 10, BlockInSeconds: 30}
+	s := h.newStore("1.1.1.1", "", config)
+	h.fill(s, config)
+	if result := h.overLimit(s); !result.Blocked {
+		h.Fatalf("Hit over the limit returned %+v, expected it to be blocked", result)
+	}
+	s.Refresh()
+	if s.IsBlocked() {
+		h.Error("The store is still blocked after a refresh")
+	}
+	if result := h.take(s); result.Limited {
+		h.Errorf("Hit after a refresh returned %+v, expected it to be accepted", result)
+	}
+
+	s.Block()
+	if result := h.take(s); !result.Limited || !result.Blocked || result.RemainingBlockTime != 30 {
+		h.Errorf("Hit after a block returned %+v, expected it to be blocked for 30s", result)
+	}
+}
+
+// testKeys checks that the stores of different ips and tokens don't share their hits
+func testKeys(h *harness) {
+	config := &store.StoreConfig{MaxRequests: 3, LimitInSeconds: 10, BlockInSeconds: 30}
+	s := h.newStore("1.1.1.1", "", config)
+	h.fill(s, config)
+	h.take(s)
+	for _, key := range [][2]string{{"2.2.2.2", ""}, {"1.1.1.1", "abc123"}} {
+		other := h.newStore(key[0], key[1], config)
+		if result := h.take(other); result.Limited || result.HitCount != 1 {
+			h.Errorf("The first hit of %s returned %+v, expected it to be accepted", key, result)
+		}
+	}
+}
+
+// testConcurrency checks that concurrent hits taken through store.ShardedStore.Do never exceed
+// the limit
+func testConcurrency(h *harness) {
+	config := &store.StoreConfig{MaxRequests: 10, LimitInSeconds: 10}
+	instances := make([]*store.ShardedStore, 1)
+	if h.backend.Shared {
+		instances = make([]*store.ShardedStore, sharedInstances)
+	}
+	for i := range instances {
+		instances[i] = store.NewShardedStore()
+		instances[i].SetClock(h.clock)
+	}
+	create := func() store.Store {
+		return h.newStore("1.1.1.1", "", config)
+	}
+
+	var accepted int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(ss *store.ShardedStore) {
+			defer wg.Done()
+			ss.Do("1.1.1.1", "", create, func(s store.Store, created bool) {
+				result := s.(store.AtomicStore).Take()
+				if result.Err != nil {
+					h.Error(result.Err)
+				} else if !result.Limited {
+					atomic.AddInt64(&accepted, 1)
+				}
+			})
+		}(instances[i%len(instances)])
+	}
+	wg.Wait()
+	if accepted != int64(config.MaxRequests) {
+		h.Errorf("%d concurrent hits were accepted, expected exactly %d", accepted, config.MaxRequests)
+	}
+}